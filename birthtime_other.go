@@ -0,0 +1,11 @@
+//go:build !darwin && !freebsd && !netbsd && !windows
+
+package main
+
+import "time"
+
+// fileBirthTime сообщает, что время создания файла недоступно: os.Stat на этих
+// системах его не возвращает, и источник birth в --date-source пропускается.
+func fileBirthTime(string) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// attachmentCache хранит для каждого каталога Page Bundle имена вложений,
+// скопированных туда при предыдущем запуске (--attachment-cache).
+var attachmentCache = struct {
+	sync.Mutex
+	bundles map[string][]string
+}{bundles: make(map[string][]string)}
+
+// loadAttachmentCache читает файл кэша вложений. Отсутствующий файл не считается ошибкой.
+func loadAttachmentCache(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать кэш вложений %s: %w", path, err)
+	}
+
+	attachmentCache.Lock()
+	defer attachmentCache.Unlock()
+	if err := json.Unmarshal(data, &attachmentCache.bundles); err != nil {
+		return fmt.Errorf("не удалось разобрать кэш вложений %s: %w", path, err)
+	}
+	return nil
+}
+
+// saveAttachmentCache записывает кэш вложений.
+func saveAttachmentCache(path string) error {
+	attachmentCache.Lock()
+	defer attachmentCache.Unlock()
+	data, err := json.MarshalIndent(attachmentCache.bundles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("не удалось сформировать кэш вложений: %w", err)
+	}
+	if err := writeFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("не удалось записать кэш вложений %s: %w", path, err)
+	}
+	return nil
+}
+
+// pruneStaleAttachments удаляет из bundleDir вложения, скопированные туда при
+// предыдущем запуске, на которые заметка больше не ссылается, и запоминает
+// текущий набор вложений current.
+func pruneStaleAttachments(bundleDir string, current []string) {
+	attachmentCache.Lock()
+	previous := attachmentCache.bundles[bundleDir]
+	attachmentCache.bundles[bundleDir] = current
+	attachmentCache.Unlock()
+
+	referenced := make(map[string]struct{}, len(current))
+	for _, name := range current {
+		referenced[name] = struct{}{}
+	}
+	for _, name := range previous {
+		if _, ok := referenced[name]; ok {
+			continue
+		}
+		stale := filepath.Join(bundleDir, filepath.FromSlash(name))
+		err := removeFile(stale)
+		switch {
+		case os.IsNotExist(err):
+			continue // Вложение уже удалено вручную
+		case err != nil:
+			logf(WARNING, "Не удалось удалить устаревшее вложение %s: %v", stale, err)
+			continue
+		}
+		if !*dryRun {
+			// С --dry-run удаление попадает в план, а не в журнал
+			logf(INFO, "Удалено устаревшее вложение: %s", stale)
+		}
+	}
+}
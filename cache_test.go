@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withEmptyAttachmentCache очищает кэш вложений на время теста.
+func withEmptyAttachmentCache(t *testing.T) {
+	t.Helper()
+	attachmentCache.Lock()
+	saved := attachmentCache.bundles
+	attachmentCache.bundles = make(map[string][]string)
+	attachmentCache.Unlock()
+	t.Cleanup(func() {
+		attachmentCache.Lock()
+		attachmentCache.bundles = saved
+		attachmentCache.Unlock()
+	})
+}
+
+func TestPruneStaleAttachments(t *testing.T) {
+	withEmptyAttachmentCache(t)
+	bundleDir := t.TempDir()
+	for _, name := range []string{"old.png", "kept.png", "manual.png"} {
+		if err := os.WriteFile(filepath.Join(bundleDir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attachmentCache.bundles[bundleDir] = []string{"old.png", "kept.png", "gone.png"}
+
+	pruneStaleAttachments(bundleDir, []string{"kept.png", "new.png"})
+	for name, want := range map[string]bool{"old.png": false, "kept.png": true, "manual.png": true} {
+		_, err := os.Stat(filepath.Join(bundleDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %t, want %t", name, exists, want)
+		}
+	}
+	if got, want := attachmentCache.bundles[bundleDir], []string{"kept.png", "new.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cached attachments = %v, want %v", got, want)
+	}
+}
+
+// captureLog перенаправляет журнал в буфер на время теста и включает все уровни.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	savedOutput, savedLevel := log.Writer(), currentLogLevel
+	log.SetOutput(&buf)
+	currentLogLevel = DEBUG
+	t.Cleanup(func() {
+		log.SetOutput(savedOutput)
+		currentLogLevel = savedLevel
+	})
+	return &buf
+}
+
+func TestPruneStaleAttachmentsLogging(t *testing.T) {
+	withEmptyAttachmentCache(t)
+	savedDryRun := *dryRun
+	t.Cleanup(func() {
+		*dryRun = savedDryRun
+		dryRunPlan.actions = nil
+	})
+	bundleDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bundleDir, "old.png"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Файл, удаленный вручную, не считается удаленным инструментом
+	logs := captureLog(t)
+	attachmentCache.bundles[bundleDir] = []string{"gone.png"}
+	pruneStaleAttachments(bundleDir, nil)
+	if logs.Len() != 0 {
+		t.Errorf("log for an already removed attachment = %q, want nothing", logs)
+	}
+
+	// С --dry-run удаление только планируется
+	*dryRun, dryRunPlan.actions = true, nil
+	attachmentCache.bundles[bundleDir] = []string{"old.png"}
+	pruneStaleAttachments(bundleDir, nil)
+	if logs.Len() != 0 {
+		t.Errorf("log with --dry-run = %q, want nothing", logs)
+	}
+	if _, err := os.Stat(filepath.Join(bundleDir, "old.png")); err != nil {
+		t.Error("attachment was removed with --dry-run")
+	}
+	if len(dryRunPlan.actions) != 1 || dryRunPlan.actions[0].path != filepath.Join(bundleDir, "old.png") {
+		t.Errorf("dry-run plan = %+v, want the removal of old.png", dryRunPlan.actions)
+	}
+
+	*dryRun = false
+	attachmentCache.bundles[bundleDir] = []string{"old.png"}
+	pruneStaleAttachments(bundleDir, nil)
+	if !strings.Contains(logs.String(), "Удалено устаревшее вложение") {
+		t.Errorf("log = %q, want the removal reported", logs)
+	}
+}
+
+func TestAttachmentCacheRoundTrip(t *testing.T) {
+	withEmptyAttachmentCache(t)
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := loadAttachmentCache(path); err != nil {
+		t.Fatalf("loadAttachmentCache of a missing file: %v", err)
+	}
+	attachmentCache.bundles["/site/post"] = []string{"post-1.png"}
+	if err := saveAttachmentCache(path); err != nil {
+		t.Fatal(err)
+	}
+	attachmentCache.bundles = make(map[string][]string)
+	if err := loadAttachmentCache(path); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"/site/post": {"post-1.png"}}; !reflect.DeepEqual(attachmentCache.bundles, want) {
+		t.Errorf("cache = %v, want %v", attachmentCache.bundles, want)
+	}
+}
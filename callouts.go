@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Регулярные выражения для выносок (callouts) Obsidian
+var (
+	// Паттерн для первой строки выноски: > [!type]- Заголовок
+	calloutPattern = regexp.MustCompile(`^\s*>\s*\[!([^\]]*)\]([+-]?)\s*(.*)$`)
+	// Паттерн для строки цитаты, продолжающей выноску.
+	quoteLinePattern = regexp.MustCompile(`^\s*> ?`)
+	// Паттерн для строки, похожей на начало выноски, но, возможно, некорректной.
+	calloutLikePattern = regexp.MustCompile(`^\s*>\s*\[!`)
+)
+
+// knownCalloutTypes — типы выносок, которые поддерживает Obsidian: основной тип
+// отображается на себя, синоним (summary, caution и т.п.) — на основной тип.
+var knownCalloutTypes = map[string]string{
+	"note": "note", "abstract": "abstract", "summary": "abstract", "tldr": "abstract",
+	"info": "info", "todo": "todo", "tip": "tip", "hint": "tip", "important": "tip",
+	"success": "success", "check": "success", "done": "success",
+	"question": "question", "help": "question", "faq": "question",
+	"warning": "warning", "caution": "warning", "attention": "warning",
+	"failure": "failure", "fail": "failure", "missing": "failure",
+	"danger": "danger", "error": "danger", "bug": "bug",
+	"example": "example", "quote": "quote", "cite": "quote",
+}
+
+// convertCallouts заменяет выноски Obsidian вида
+//
+//	> [!note] Заголовок
+//	> Текст
+//
+// на парный шорткод Hugo --callout-shortcode или, с --callout-html, на блок HTML.
+// Для сворачиваемых выносок ([!tip]- и [!tip]+) шорткоду передается, раскрыта ли
+// выноска, а в HTML выводится <details>. Тип выноски переводится через
+// --callout-map; синонимы сначала сводятся к основному типу Obsidian (caution → warning),
+// а типы, которых нет в --callout-map, передаются как есть. Неизвестные Obsidian типы
+// становятся --callout-default. Выноски с пустым типом, а при пустом --callout-default
+// и с неизвестным, становятся обычной цитатой. Вложенные выноски обрабатываются
+// рекурсивно, блоки кода не затрагиваются.
+func convertCallouts(content string) string {
+	mapping := parseKeyValueList(*calloutMap)
+	lines := strings.Split(content, "\n")
+	var result []string
+	inCode := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+		}
+		match := calloutPattern.FindStringSubmatch(line)
+		if inCode || match == nil {
+			if !inCode && calloutLikePattern.MatchString(line) {
+				logf(DEBUG, "Строка похожа на выноску, но не разобрана, оставляю как цитату: %s", line)
+			}
+			result = append(result, line)
+			continue
+		}
+
+		var body []string
+		for i+1 < len(lines) && quoteLinePattern.MatchString(lines[i+1]) {
+			i++
+			body = append(body, quoteLinePattern.ReplaceAllString(lines[i], ""))
+		}
+		title := strings.TrimSpace(match[3])
+
+		calloutType, ok := calloutShortcodeType(match[1], mapping)
+		if !ok {
+			logf(DEBUG, "Выноска с пустым или неизвестным типом '%s' выводится как обычная цитата.", match[1])
+			result = append(result, plainQuote(title, body)...)
+			continue
+		}
+
+		fold := match[2]
+		if title == "" && fold != "" {
+			// Свернутой выноске нужен заголовок; Obsidian в этом случае показывает тип
+			title = capitalize(strings.ToLower(strings.TrimSpace(match[1])))
+		}
+		var inner string
+		if len(body) > 0 {
+			inner = convertCallouts(strings.Join(body, "\n"))
+		}
+		if *calloutHTML {
+			result = append(result, calloutHTMLBlock(calloutType, title, fold, inner)...)
+			continue
+		}
+
+		open := fmt.Sprintf("{{< %s %s >}}", *calloutShortcode, calloutType)
+		if title != "" {
+			open = fmt.Sprintf("{{< %s %s %q >}}", *calloutShortcode, calloutType, title)
+		}
+		if fold != "" {
+			// Третий параметр — раскрыта ли выноска, как у шорткода admonition
+			open = fmt.Sprintf("{{< %s %s %q %t >}}", *calloutShortcode, calloutType, title, fold == "+")
+		}
+		result = append(result, open)
+		if inner != "" {
+			result = append(result, inner)
+		}
+		result = append(result, fmt.Sprintf("{{< /%s >}}", *calloutShortcode))
+	}
+	return strings.Join(result, "\n")
+}
+
+// calloutHTMLBlock возвращает выноску в виде блока HTML в стиле Bootstrap
+// (<div class="alert alert-тип">) или, для сворачиваемой выноски, <details>.
+// Текст отделяется пустыми строками, чтобы Hugo обработал в нем Markdown.
+func calloutHTMLBlock(calloutType, title, fold, body string) []string {
+	class := "alert alert-" + calloutType
+	var block []string
+	if fold != "" {
+		open := ""
+		if fold == "+" {
+			open = " open"
+		}
+		block = append(block, fmt.Sprintf(`<details class="%s"%s>`, class, open))
+		block = append(block, "<summary>"+html.EscapeString(title)+"</summary>")
+	} else {
+		block = append(block, fmt.Sprintf(`<div class="%s" role="alert">`, class))
+		if title != "" {
+			block = append(block, `<p class="alert-heading"><strong>`+html.EscapeString(title)+"</strong></p>")
+		}
+	}
+	if body != "" {
+		block = append(block, "", body, "")
+	}
+	if fold != "" {
+		return append(block, "</details>")
+	}
+	return append(block, "</div>")
+}
+
+// calloutShortcodeType переводит тип выноски Obsidian в тип для шорткода темы:
+// по --callout-map, а синоним — как его основной тип (caution → warning). Записи
+// --callout-map для самого синонима важнее записи для основного типа. Типы, которых
+// нет ни в Obsidian, ни в --callout-map, становятся --callout-default. Возвращает false
+// для пустого типа и для неизвестного типа, если --callout-default пуст.
+func calloutShortcodeType(obsidianType string, mapping map[string]string) (string, bool) {
+	obsidianType = strings.ToLower(strings.TrimSpace(obsidianType))
+	if mapped, ok := mapping[obsidianType]; ok && obsidianType != "" {
+		return mapped, true
+	}
+	if obsidianType == "" {
+		return "", false
+	}
+	canonical, ok := knownCalloutTypes[obsidianType]
+	if !ok {
+		return *calloutDefault, *calloutDefault != ""
+	}
+	if mapped, ok := mapping[canonical]; ok {
+		return mapped, true
+	}
+	return canonical, true
+}
+
+// plainQuote собирает обычную цитату из заголовка и текста выноски.
+// Вложенные выноски в тексте по-прежнему преобразуются.
+func plainQuote(title string, body []string) []string {
+	var quote []string
+	if title != "" {
+		quote = append(quote, "> "+title)
+	}
+	if len(body) > 0 {
+		for _, line := range strings.Split(convertCallouts(strings.Join(body, "\n")), "\n") {
+			quote = append(quote, strings.TrimRight("> "+line, " "))
+		}
+	}
+	if len(quote) == 0 {
+		quote = append(quote, ">")
+	}
+	return quote
+}
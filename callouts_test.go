@@ -0,0 +1,129 @@
+package main
+
+import "testing"
+
+// withCalloutShortcode включает вывод выносок шорткодом name на время теста.
+func withCalloutShortcode(t *testing.T, name, mapping string) {
+	t.Helper()
+	savedShortcode, savedMap := *calloutShortcode, *calloutMap
+	*calloutShortcode, *calloutMap = name, mapping
+	t.Cleanup(func() {
+		*calloutShortcode, *calloutMap = savedShortcode, savedMap
+	})
+}
+
+// Некорректные и пограничные выноски должны остаться обычными цитатами.
+func TestConvertCalloutsMalformed(t *testing.T) {
+	withCalloutShortcode(t, "admonition", "")
+	tests := []struct {
+		name, content, want string
+	}{
+		{"empty type", "> [!]\n> text", "> text"},
+		{"empty type with title", "> [!] Title\n> text", "> Title\n> text"},
+		{"blank type", "> [! ] Title", "> Title"},
+		{"unclosed marker", "> [!note Title\n> text", "> [!note Title\n> text"},
+		{"marker without quote", "[!note] Title", "[!note] Title"},
+		{"stray fold marker", "> [!]-\n> text", "> text"},
+		{"empty body", "> [!]", ">"},
+		{"inside code", "```\n> [!note] Title\n```", "```\n> [!note] Title\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := convertCallouts(tt.content); got != tt.want {
+				t.Errorf("convertCallouts(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertCalloutsWellFormed(t *testing.T) {
+	withCalloutShortcode(t, "admonition", "")
+	tests := []struct {
+		name, content, want string
+	}{
+		{"typed", "> [!note] Title\n> text", "{{< admonition note \"Title\" >}}\ntext\n{{< /admonition >}}"},
+		{"synonym", "> [!caution]\n> text", "{{< admonition warning >}}\ntext\n{{< /admonition >}}"},
+		{"nested", "> [!note] Outer\n> > [!note] Inner\n> > text", "{{< admonition note \"Outer\" >}}\n{{< admonition note \"Inner\" >}}\ntext\n{{< /admonition >}}\n{{< /admonition >}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := convertCallouts(tt.content); got != tt.want {
+				t.Errorf("convertCallouts(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertCalloutsFoldable(t *testing.T) {
+	withCalloutShortcode(t, "admonition", "")
+	savedHTML := *calloutHTML
+	t.Cleanup(func() { *calloutHTML = savedHTML })
+
+	tests := []struct {
+		name    string
+		html    bool
+		content string
+		want    string
+	}{
+		{"folded shortcode", false, "> [!note]- Hidden\n> text", "{{< admonition note \"Hidden\" false >}}\ntext\n{{< /admonition >}}"},
+		{"open shortcode without title", false, "> [!note]+\n> text", "{{< admonition note \"Note\" true >}}\ntext\n{{< /admonition >}}"},
+		{"html alert", true, "> [!note] Careful <b>\n> text", "<div class=\"alert alert-note\" role=\"alert\">\n<p class=\"alert-heading\"><strong>Careful &lt;b&gt;</strong></p>\n\ntext\n\n</div>"},
+		{"html details", true, "> [!note]+ More\n> text", "<details class=\"alert alert-note\" open>\n<summary>More</summary>\n\ntext\n\n</details>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*calloutHTML = tt.html
+			if got := convertCallouts(tt.content); got != tt.want {
+				t.Errorf("convertCallouts(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalloutShortcodeType(t *testing.T) {
+	saved := *calloutDefault
+	t.Cleanup(func() { *calloutDefault = saved })
+	*calloutDefault = "info"
+
+	mapping := parseKeyValueList("warning=warn,tldr=summary,custom=special")
+	tests := []struct {
+		obsidianType, want string
+		ok                 bool
+	}{
+		{"warning", "warn", true},
+		{"danger", "danger", true},
+		{"Danger", "danger", true},
+		{"tldr", "summary", true},
+		{"caution", "warn", true},
+		{"Attention", "warn", true},
+		{"error", "danger", true},
+		{"cite", "quote", true},
+		{"summary", "abstract", true},
+		{"custom", "special", true},
+		{"bogus", "info", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := calloutShortcodeType(tt.obsidianType, mapping)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("calloutShortcodeType(%q) = (%q, %t), want (%q, %t)", tt.obsidianType, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	withCalloutShortcode(t, "admonition", "")
+	if got, want := convertCallouts("> [!warning]\n> text"), "{{< admonition warning >}}\ntext\n{{< /admonition >}}"; got != want {
+		t.Errorf("convertCallouts without --callout-map = %q, want %q", got, want)
+	}
+	if got, want := convertCallouts("> [!bogus] Title\n> text"), "{{< admonition info \"Title\" >}}\ntext\n{{< /admonition >}}"; got != want {
+		t.Errorf("convertCallouts of an unknown type = %q, want %q", got, want)
+	}
+
+	// Без --callout-default выноска неизвестного типа остается цитатой
+	*calloutDefault = ""
+	if got, ok := calloutShortcodeType("bogus", mapping); ok {
+		t.Errorf("calloutShortcodeType(bogus) with empty --callout-default = (%q, true), want false", got)
+	}
+	if got, want := convertCallouts("> [!bogus] Title\n> text"), "> Title\n> text"; got != want {
+		t.Errorf("convertCallouts of an unknown type with empty --callout-default = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// errCleanNeedsState — удаление устаревших постов без --state-file: только по нему
+// известно, какие посты записал инструмент.
+var errCleanNeedsState = errors.New("удаление устаревших постов требует --state-file: по нему определяется, какие посты записаны инструментом")
+
+// staleBundles возвращает посты в --hugo-posts-dir (каталоги в раскладке bundle,
+// файлы .md в раскладке flat), для которых больше нет публикуемой заметки.
+// Индекс заметок должен быть уже построен. Кандидатами считаются только посты,
+// записанные самим инструментом, — те, что есть в --state-file; рукописные посты
+// не удаляются. Служебные посты (имена с '_' или '.') и каталог --generate-tag-pages
+// не удаляются никогда.
+func staleBundles() ([]string, error) {
+	if *stateFile == "" {
+		return nil, errCleanNeedsState
+	}
+	if *fileList != "" {
+		// В индексе только заметки из списка, остальные посты выглядели бы устаревшими
+		return nil, fmt.Errorf("удаление устаревших постов несовместимо с --file-list")
+	}
+	if info, err := os.Stat(*notesDir); hasGlobMeta(*notesDir) || err == nil && !info.IsDir() {
+		// То же для отдельной заметки или шаблона: в индексе не все заметки хранилища
+		return nil, fmt.Errorf("удаление устаревших постов несовместимо с --notes-dir в виде файла или шаблона")
+	}
+	expected := make(map[string]struct{}, len(noteIndex))
+	for _, note := range noteIndex {
+		expected[strings.ToLower(note.bundle)] = struct{}{}
+	}
+	syncState.Lock()
+	for path := range unindexedNotes {
+		// Заметка не разобрана, но не удалена: ее пост не устарел
+		expected[strings.ToLower(bundleName(path, bundleNaming{}))] = struct{}{}
+		if state, ok := syncState.Notes[path]; ok {
+			if post := postOfTarget(state.Target); post != "" {
+				expected[strings.ToLower(strings.TrimSuffix(filepath.Base(post), ".md"))] = struct{}{}
+			}
+		}
+	}
+
+	seen := make(map[string]struct{})
+	var candidates []string
+	for _, state := range syncState.Notes {
+		if post := postOfTarget(state.Target); post != "" {
+			if _, ok := seen[post]; !ok {
+				seen[post] = struct{}{}
+				candidates = append(candidates, post)
+			}
+		}
+	}
+	syncState.Unlock()
+
+	var stale []string
+	for _, post := range candidates {
+		name := filepath.Base(post)
+		if strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") || sameDir(post, *tagPagesDir) {
+			continue
+		}
+		info, err := os.Stat(post)
+		if err != nil {
+			continue // Пост уже удален
+		}
+		if *layout == "flat" {
+			if info.IsDir() || !strings.HasSuffix(name, ".md") {
+				continue
+			}
+			name = strings.TrimSuffix(name, ".md")
+		} else if !info.IsDir() {
+			continue
+		}
+		if _, ok := expected[strings.ToLower(name)]; !ok {
+			stale = append(stale, post)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// postOfTarget возвращает пост (каталог или файл в --hugo-posts-dir), к которому
+// относится записанный файл target, или пустую строку, если target вне каталога постов.
+func postOfTarget(target string) string {
+	rel, err := filepath.Rel(*hugoPostsDir, target)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	first, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return filepath.Join(*hugoPostsDir, first)
+}
+
+// sameDir проверяет, что пути указывают на один каталог.
+func sameDir(a, b string) bool {
+	if b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// removeStaleBundles удаляет посты, для которых больше нет публикуемой заметки,
+// и забывает их в файле состояния.
+func removeStaleBundles() error {
+	stale, err := staleBundles()
+	if err != nil {
+		return err
+	}
+	for _, post := range stale {
+		if err := removeAll(post); err != nil {
+			return fmt.Errorf("не удалось удалить устаревший пост %s: %w", post, err)
+		}
+		logf(INFO, "Удален устаревший пост: %s", post)
+
+		syncState.Lock()
+		for path, state := range syncState.Notes {
+			if postOfTarget(state.Target) == post {
+				delete(syncState.Notes, path)
+			}
+		}
+		syncState.Unlock()
+	}
+	logf(DEBUG, "Удалено устаревших постов: %d", len(stale))
+	return nil
+}
+
+// runClean выполняет подкоманду clean: удаляет устаревшие посты, ничего не конвертируя.
+func runClean() int {
+	if *stateFile != "" {
+		if err := loadState(*stateFile); err != nil {
+			logf(ERROR, "Ошибка: %v", err)
+			return exitFatal
+		}
+	}
+	notePaths, err := notePathsToProcess()
+	if err != nil {
+		logf(ERROR, "Не удалось собрать заметки: %v", err)
+		return exitFatal
+	}
+	buildNoteIndex(notePaths)
+
+	if err := removeStaleBundles(); err != nil {
+		logf(ERROR, "Ошибка: %v", err)
+		return exitFatal
+	}
+	if *stateFile != "" {
+		if err := saveState(*stateFile); err != nil {
+			logf(ERROR, "Ошибка: %v", err)
+			return exitFatal
+		}
+	}
+	if *dryRun {
+		printDryRunPlan(os.Stdout)
+	}
+	return exitOK
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRemoveStaleBundles(t *testing.T) {
+	posts := t.TempDir()
+	for _, dir := range []string{"Keep", "Gone", "Manual", "_drafts", ".git", "tags"} {
+		if err := os.MkdirAll(filepath.Join(posts, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(posts, "_index.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	savedPosts, savedTagPages, savedState, savedNotes, savedIndex := *hugoPostsDir, *tagPagesDir, *stateFile, *notesDir, noteIndex
+	t.Cleanup(func() {
+		*hugoPostsDir, *tagPagesDir, *stateFile, *notesDir, noteIndex = savedPosts, savedTagPages, savedState, savedNotes, savedIndex
+	})
+	*hugoPostsDir, *tagPagesDir, *stateFile, *notesDir = posts, filepath.Join(posts, "tags"), "", t.TempDir()
+	noteIndex = map[string]*publishedNote{"keep": {path: "/vault/Keep.md", bundle: "keep"}}
+
+	if _, err := staleBundles(); !errors.Is(err, errCleanNeedsState) {
+		t.Errorf("staleBundles without --state-file = %v, want errCleanNeedsState", err)
+	}
+
+	withEmptyState(t)
+	*stateFile = filepath.Join(t.TempDir(), "state.json")
+	syncState.Notes["/vault/Keep.md"] = &noteState{Target: filepath.Join(posts, "Keep", "index.md")}
+	syncState.Notes["/vault/Gone.md"] = &noteState{Target: filepath.Join(posts, "Gone", "index.md")}
+
+	stale, err := staleBundles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(posts, "Gone")}; !reflect.DeepEqual(stale, want) {
+		t.Errorf("staleBundles = %v, want %v", stale, want)
+	}
+
+	if err := removeStaleBundles(); err != nil {
+		t.Fatal(err)
+	}
+	if isDir(filepath.Join(posts, "Gone")) {
+		t.Error("stale post was not removed")
+	}
+	for _, kept := range []string{"Keep", "Manual", "_drafts", ".git", "tags"} {
+		if !isDir(filepath.Join(posts, kept)) {
+			t.Errorf("%s was removed", kept)
+		}
+	}
+
+	// В индексе одной заметки остальные посты выглядели бы устаревшими
+	*notesDir = filepath.Join(posts, "_index.md")
+	if _, err := staleBundles(); err == nil {
+		t.Error("staleBundles with a file --notes-dir returned no error")
+	}
+}
+
+func TestPostOfTarget(t *testing.T) {
+	saved := *hugoPostsDir
+	*hugoPostsDir = filepath.FromSlash("/site/content/posts")
+	t.Cleanup(func() { *hugoPostsDir = saved })
+
+	tests := []struct {
+		target, want string
+	}{
+		{"/site/content/posts/Note/index.md", "/site/content/posts/Note"},
+		{"/site/content/posts/Note.md", "/site/content/posts/Note.md"},
+		{"/site/content/other/Note.md", ""},
+		{"/site/content/posts", ""},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want != "" {
+			want = filepath.FromSlash(want)
+		}
+		if got := postOfTarget(filepath.FromSlash(tt.target)); got != want {
+			t.Errorf("postOfTarget(%s) = %q, want %q", tt.target, got, want)
+		}
+	}
+}
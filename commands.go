@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// command — подкоманда программы. Все подкоманды используют общие параметры запуска.
+type command struct {
+	name        string
+	description string
+	run         func() int // возвращает код завершения
+	// standalone — команда не читает конфигурацию и не требует путей к заметкам и постам
+	standalone bool
+	// readOnly — команда ничего не записывает и не требует --hugo-posts-dir
+	readOnly bool
+}
+
+// commands — доступные подкоманды. Первая выполняется, если подкоманда не указана.
+var commands = []*command{
+	{name: "convert", description: "Конвертировать заметки в посты Hugo (по умолчанию)", run: runConvert},
+	{name: "validate", description: "Проверить заметки (front matter, вложения, ссылки), ничего не записывая", run: runValidate, readOnly: true},
+	{name: "stats", description: "Вывести статистику по публикуемым заметкам", run: runStats, readOnly: true},
+	{name: "watch", description: "Конвертировать заметки и следить за изменениями (как --watch)", run: runWatch},
+	{name: "clean", description: "Удалить посты, для которых больше нет публикуемой заметки", run: runClean},
+	{name: "init", description: "Создать файл конфигурации, ответив на несколько вопросов", run: runInit, standalone: true},
+}
+
+// selectCommand определяет подкоманду по первому аргументу и возвращает ее вместе
+// с оставшимися аргументами. Без подкоманды выполняется convert.
+func selectCommand(args []string) (*command, []string) {
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if args[0] == cmd.name {
+				return cmd, args[1:]
+			}
+		}
+	}
+	return commands[0], args
+}
+
+// printCommands выводит список подкоманд для справки.
+func printCommands(w io.Writer) {
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+}
+
+// runConvert выполняет подкоманду convert.
+func runConvert() int {
+	if err := processNotes(); err != nil {
+		logf(ERROR, "Не удалось обработать заметки: %v", err)
+		return exitFatal
+	}
+	if *watchMode {
+		if err := watchNotes(); err != nil {
+			logf(ERROR, "Ошибка: %v", err)
+			return exitFatal
+		}
+		return exitOK
+	}
+	return exitCode()
+}
+
+// runWatch выполняет подкоманду watch.
+func runWatch() int {
+	*watchMode = true
+	return runConvert()
+}
+
+// runValidate выполняет подкоманду validate: индексирует заметки и проверяет
+// публикуемые так же, как при конвертации, но ничего не записывает.
+// Код завершения — как с --strict.
+func runValidate() int {
+	*strict = true
+	notePaths, err := notePathsToProcess()
+	if err != nil {
+		logf(ERROR, "Не удалось собрать заметки: %v", err)
+		return exitFatal
+	}
+	buildNoteIndex(notePaths)
+	for _, note := range publishedNotes() {
+		validateNote(note.path)
+	}
+
+	code := exitCode()
+	if code == exitOK {
+		logf(INFO, "Проблем не найдено. Проверено заметок: %d", len(noteIndex))
+	}
+	return code
+}
+
+// validateNote проверяет одну публикуемую заметку: разбор front matter, встраивания
+// заметок, наличие встроенных вложений и разрешимость вики-ссылок. Ошибки сообщаются через reportError.
+func validateNote(path string) {
+	contentBytes, release, err := readNote(path)
+	if err != nil {
+		reportError(&ParseError{Path: path, Err: err})
+		return
+	}
+	defer release()
+
+	_, content, err := parseNoteContent(string(contentBytes))
+	if err != nil {
+		reportError(&ParseError{Path: path, Err: err})
+		return
+	}
+
+	content = expandTransclusions(removeComments(content), path)
+	for _, match := range attachmentPattern.FindAllStringSubmatch(content, -1) {
+		filename, _ := parseEmbed(match[1])
+		if _, ok := findAttachment(filename, filepath.Dir(path)); !ok {
+			reportError(&AttachmentError{Path: path, Attachment: filename, Err: fmt.Errorf("не найдено в %s", attachmentSearchDescription(filepath.Dir(path)))})
+		}
+	}
+	// Ссылки на файлы вложений не являются ссылками на заметки
+	for _, link := range attachmentLinks(content, filepath.Dir(path)) {
+		content = strings.ReplaceAll(content, link.raw, link.text)
+	}
+	rewriteWikilinks(content, path)
+}
+
+// runStats выполняет подкоманду stats.
+func runStats() int {
+	notePaths, err := notePathsToProcess()
+	if err != nil {
+		logf(ERROR, "Не удалось собрать заметки: %v", err)
+		return exitFatal
+	}
+	buildNoteIndex(notePaths)
+
+	embeds, links := 0, 0
+	tags := make(map[string]int)
+	for _, note := range publishedNotes() {
+		contentBytes, release, err := readNote(note.path)
+		if err != nil {
+			continue
+		}
+		properties, content, err := parseNoteContent(string(contentBytes))
+		release()
+		if err != nil {
+			continue
+		}
+		content = removeComments(content)
+		embeds += len(attachmentPattern.FindAllString(content, -1))
+		links += len(linkedNotes(content))
+		for _, tag := range extractTags(properties) {
+			tags[tag]++
+		}
+	}
+
+	fmt.Printf("Заметок найдено: %d\n", len(notePaths))
+	fmt.Printf("Публикуется: %d (по ссылкам: %d)\n", len(noteIndex), len(followedNotes))
+	fmt.Printf("Пропущено из-за конфликта каталогов: %d\n", len(collidedNotes))
+	fmt.Printf("Встроенных вложений: %d\n", embeds)
+	fmt.Printf("Вики-ссылок: %d\n", links)
+	fmt.Printf("Тегов: %d\n", len(tags))
+
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if tags[names[i]] != tags[names[j]] {
+			return tags[names[i]] > tags[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, tag := range names {
+		fmt.Printf("  %s: %d\n", tag, tags[tag])
+	}
+	return exitOK
+}
+
+// publishedNotes возвращает опубликованные заметки из индекса в порядке путей.
+func publishedNotes() []*publishedNote {
+	notes := make([]*publishedNote, 0, len(noteIndex))
+	for _, note := range noteIndex {
+		notes = append(notes, note)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].path < notes[j].path })
+	return notes
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSelectCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantRest []string
+	}{
+		{nil, "convert", nil},
+		{[]string{"validate", "--notes-dir", "vault"}, "validate", []string{"--notes-dir", "vault"}},
+		{[]string{"stats"}, "stats", []string{}},
+		{[]string{"--notes-dir", "vault"}, "convert", []string{"--notes-dir", "vault"}},
+	}
+	for _, tt := range tests {
+		cmd, rest := selectCommand(tt.args)
+		if cmd.name != tt.wantName || !reflect.DeepEqual(rest, tt.wantRest) {
+			t.Errorf("selectCommand(%q) = %s, %q, want %s, %q", tt.args, cmd.name, rest, tt.wantName, tt.wantRest)
+		}
+	}
+}
+
+func TestValidateNoteReportsMissingAttachment(t *testing.T) {
+	notePath, _ := attachmentVault(t, "pic.png")
+	if err := os.WriteFile(notePath, []byte("---\ntitle: Note\n---\n![[pic.png]] ![[missing.png]]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	noteErrors.Lock()
+	saved := noteErrors.list
+	noteErrors.list = nil
+	noteErrors.Unlock()
+	t.Cleanup(func() { noteErrors.list = saved })
+
+	validateNote(notePath)
+
+	var attachmentErr *AttachmentError
+	if len(noteErrors.list) != 1 || !errors.As(noteErrors.list[0], &attachmentErr) {
+		t.Fatalf("validateNote reported %v, want one AttachmentError", noteErrors.list)
+	}
+	if attachmentErr.Attachment != "missing.png" {
+		t.Errorf("attachment = %q, want missing.png", attachmentErr.Attachment)
+	}
+}
+
+func TestObsidianAttachmentFolder(t *testing.T) {
+	tests := []struct {
+		settings, want string
+	}{
+		{`{"attachmentFolderPath": "/Files"}`, "Files"},
+		{`{"attachmentFolderPath": "./"}`, ""},
+		{`{}`, ""},
+		{`broken`, ""},
+	}
+	for _, tt := range tests {
+		vault := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(vault, ".obsidian"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(vault, ".obsidian", "app.json"), []byte(tt.settings), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		want := tt.want
+		if want != "" {
+			want = filepath.Join(vault, want)
+		}
+		if got := obsidianAttachmentFolder(vault); got != want {
+			t.Errorf("obsidianAttachmentFolder(%s) = %q, want %q", tt.settings, got, want)
+		}
+	}
+}
+
+func TestFindUpHugoSite(t *testing.T) {
+	site := t.TempDir()
+	if err := os.WriteFile(filepath.Join(site, "hugo.toml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(site, "content", "posts")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := findUp(nested, isHugoSite); got != site {
+		t.Errorf("findUp = %q, want %q", got, site)
+	}
+	if got := findUp(t.TempDir(), func(string) bool { return false }); got != "" {
+		t.Errorf("findUp without a match = %q, want empty", got)
+	}
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	config := map[string]interface{}{"notes-dir": "/vault", "filter-tag": "blog"}
+	for _, name := range []string{"config.yaml", "config.json"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := writeConfigFile(path, config); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		if err := yaml.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, config) {
+			t.Errorf("%s = %v, want %v", name, got, config)
+		}
+	}
+}
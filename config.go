@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix — префикс переменных окружения с параметрами: OBSIDIAN2HUGO_NOTES_DIR для --notes-dir.
+const envPrefix = "OBSIDIAN2HUGO_"
+
+// envName возвращает имя переменной окружения для параметра.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// listValue — параметр-список, который при повторных Set дополняет значение.
+// reset очищает его, чтобы заменить значение целиком.
+type listValue interface {
+	reset()
+}
+
+// loadEnv устанавливает из переменных окружения значения параметров, которые
+// не заданы в командной строке. Значения --exclude-dirs и --attachments-dir разделяются запятыми.
+// Переменные окружения важнее файла конфигурации, поэтому loadEnv вызывается после loadConfig.
+func loadEnv(setOnCommandLine map[string]struct{}) error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		if _, ok := setOnCommandLine[f.Name]; ok {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if list, isList := f.Value.(listValue); isList {
+			list.reset() // Значение из окружения заменяет значение из файла конфигурации
+		}
+		values := []string{value}
+		if _, isSlice := f.Value.(*stringSlice); isSlice {
+			values = splitList(value)
+		}
+		for _, v := range values {
+			if setErr := f.Value.Set(v); setErr != nil {
+				err = fmt.Errorf("некорректное значение переменной окружения %s: %w", envName(f.Name), setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// commandLineFlags возвращает имена параметров, заданных в командной строке.
+func commandLineFlags() map[string]struct{} {
+	set := make(map[string]struct{})
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = struct{}{}
+	})
+	return set
+}
+
+// loadConfig читает файл конфигурации (--config) и устанавливает из него значения
+// параметров, которые не заданы в командной строке. Ключи файла совпадают с именами
+// параметров (notes-dir, filter-tag, ...); подчеркивания считаются дефисами.
+// Файл — YAML или JSON.
+func loadConfig(path string, setOnCommandLine map[string]struct{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать файл конфигурации %s: %w", path, err)
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("не удалось разобрать файл конфигурации %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ReplaceAll(key, "_", "-")
+		f := flag.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("неизвестный параметр '%s' в файле конфигурации %s", key, path)
+		}
+		if _, ok := setOnCommandLine[name]; ok {
+			continue // Командная строка важнее файла
+		}
+		for _, value := range configValues(f, config[key]) {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("некорректное значение параметра '%s' в файле конфигурации %s: %w", key, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues преобразует значение из файла конфигурации в строки для flag.Value.Set.
+// Списки для --exclude-dirs и --attachments-dir передаются поэлементно, для остальных параметров
+// элементы списка объединяются через запятую. Отображения (например, для --rename-keys)
+// записываются как пары ключ=значение через запятую, для --front-matter-defaults — как YAML.
+func configValues(f *flag.Flag, value interface{}) []string {
+	if _, isDefaults := f.Value.(*frontMatterDefaults); isDefaults && value != nil {
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return []string{fmt.Sprint(value)}
+		}
+		return []string{string(data)}
+	}
+	if mapping, isMap := value.(map[string]interface{}); isMap {
+		keys := make([]string, 0, len(mapping))
+		for key := range mapping {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			pairs = append(pairs, key+"="+fmt.Sprint(mapping[key]))
+		}
+		return []string{strings.Join(pairs, ",")}
+	}
+	list, isList := value.([]interface{})
+	if !isList {
+		if value == nil {
+			return []string{""}
+		}
+		return []string{fmt.Sprint(value)}
+	}
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		items = append(items, fmt.Sprint(item))
+	}
+	if _, isSlice := f.Value.(*stringSlice); isSlice {
+		return items
+	}
+	return []string{strings.Join(items, ",")}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeConfig записывает файл конфигурации во временный каталог и возвращает путь к нему.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	savedPosts, savedDirs, savedRemove := *hugoPostsDir, excludeDirs, *removeFilterTag
+	t.Cleanup(func() {
+		*hugoPostsDir, excludeDirs, *removeFilterTag = savedPosts, savedDirs, savedRemove
+	})
+	excludeDirs = nil
+	// Параметры-списки регистрирует main
+	if flag.Lookup("exclude-dirs") == nil {
+		flag.Var(&excludeDirs, "exclude-dirs", "")
+	}
+
+	config := writeConfig(t, "hugo_posts_dir: /site/content/posts\nremove-filter-tag: true\nexclude-dirs: [Templates, Daily]\n")
+	if err := loadConfig(config, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/site/content/posts"; *hugoPostsDir != want {
+		t.Errorf("hugo-posts-dir = %q, want %q", *hugoPostsDir, want)
+	}
+	if !*removeFilterTag {
+		t.Error("remove-filter-tag = false, want true")
+	}
+	if want := (stringSlice{"Templates", "Daily"}); !reflect.DeepEqual(excludeDirs, want) {
+		t.Errorf("exclude-dirs = %v, want %v", excludeDirs, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, content := range []string{"no-such-option: 1\n", "config: other.yaml\n", "remove-filter-tag: maybe\n", "[broken"} {
+		if err := loadConfig(writeConfig(t, content), nil); err == nil {
+			t.Errorf("loadConfig(%q) returned no error", content)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	savedPosts, savedDirs, savedRemove := *hugoPostsDir, excludeDirs, *removeFilterTag
+	t.Cleanup(func() {
+		*hugoPostsDir, excludeDirs, *removeFilterTag = savedPosts, savedDirs, savedRemove
+	})
+	if flag.Lookup("exclude-dirs") == nil {
+		flag.Var(&excludeDirs, "exclude-dirs", "")
+	}
+	excludeDirs = nil
+
+	config := writeConfig(t, "hugo-posts-dir: /site/config\nexclude-dirs: [Templates]\nremove-filter-tag: true\n")
+	t.Setenv(envName("hugo-posts-dir"), "/site/env")
+	t.Setenv(envName("exclude-dirs"), "Daily, Archive")
+	t.Setenv(envName("remove-filter-tag"), "true")
+
+	onCommandLine := map[string]struct{}{"remove-filter-tag": {}}
+	if err := loadConfig(config, onCommandLine); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadEnv(onCommandLine); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "/site/env"; *hugoPostsDir != want {
+		t.Errorf("hugo-posts-dir = %q, want %q", *hugoPostsDir, want)
+	}
+	if want := (stringSlice{"Daily", "Archive"}); !reflect.DeepEqual(excludeDirs, want) {
+		t.Errorf("exclude-dirs = %v, want %v", excludeDirs, want)
+	}
+	if *removeFilterTag {
+		t.Error("remove-filter-tag = true, want the command line value false")
+	}
+}
+
+func TestConfigValuesMapping(t *testing.T) {
+	config := writeConfig(t, "rename-keys:\n  topic: categories\n  created: date\n")
+	saved := *renameKeys
+	t.Cleanup(func() { *renameKeys = saved })
+	if err := loadConfig(config, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "created=date,topic=categories"; *renameKeys != want {
+		t.Errorf("rename-keys = %q, want %q", *renameKeys, want)
+	}
+}
+
+func TestConfigEnvPrecedence(t *testing.T) {
+	savedTags, savedDirs, savedPosts, savedSlug := filterTags, attachmentsDirs, *hugoPostsDir, *slugifyBundles
+	t.Cleanup(func() {
+		filterTags, attachmentsDirs, *hugoPostsDir, *slugifyBundles = savedTags, savedDirs, savedPosts, savedSlug
+	})
+	filterTags, attachmentsDirs = tagList{tags: []string{"blog"}}, nil
+	// Параметры-списки регистрирует main
+	if flag.Lookup("filter-tag") == nil {
+		flag.Var(&filterTags, "filter-tag", "")
+		flag.Var(&attachmentsDirs, "attachments-dir", "")
+	}
+
+	config := writeConfig(t, "filter-tag: blog\nattachments_dir: [/vault/a, /vault/b]\nhugo-posts-dir: /site/config\nslugify: true\n")
+	t.Setenv(envName("filter-tag"), "til")
+	t.Setenv(envName("attachments-dir"), "/vault/env")
+	t.Setenv(envName("hugo-posts-dir"), "/site/env")
+	t.Setenv(envName("slugify"), "false")
+
+	onCommandLine := map[string]struct{}{"slugify": {}}
+	*slugifyBundles = true
+	if err := loadConfig(config, onCommandLine); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadEnv(onCommandLine); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"til"}; !reflect.DeepEqual(filterTags.tags, want) {
+		t.Errorf("filter-tag = %v, want %v", filterTags.tags, want)
+	}
+	if want := (stringSlice{"/vault/env"}); !reflect.DeepEqual(attachmentsDirs, want) {
+		t.Errorf("attachments-dir = %v, want %v", attachmentsDirs, want)
+	}
+	if want := "/site/env"; *hugoPostsDir != want {
+		t.Errorf("hugo-posts-dir = %q, want %q", *hugoPostsDir, want)
+	}
+	if !*slugifyBundles {
+		t.Errorf("slugify = false, want the command line value true")
+	}
+}
+
+func TestLoadConfigUnknownKey(t *testing.T) {
+	if err := loadConfig(writeConfig(t, "no-such-flag: 1\n"), nil); err == nil {
+		t.Error("loadConfig accepted an unknown key")
+	}
+}
+
+func TestTagListSet(t *testing.T) {
+	list := tagList{tags: []string{"blog"}}
+	for _, value := range []string{"til, notes", "draft"} {
+		if err := list.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"til", "notes", "draft"}; !reflect.DeepEqual(list.tags, want) {
+		t.Errorf("tags = %v, want %v", list.tags, want)
+	}
+}
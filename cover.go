@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// imageExtensions — расширения файлов, которые считаются картинками при поиске обложки.
+var imageExtensions = map[string]struct{}{
+	".png": {}, ".jpg": {}, ".jpeg": {}, ".gif": {}, ".webp": {}, ".svg": {}, ".avif": {}, ".bmp": {},
+}
+
+// firstEmbeddedImage возвращает имя файла первой встроенной картинки ![[...]] в тексте заметки.
+func firstEmbeddedImage(content string) (string, bool) {
+	for _, match := range attachmentPattern.FindAllStringSubmatch(content, -1) {
+		filename, _ := parseEmbed(match[1])
+		if _, ok := imageExtensions[strings.ToLower(filepath.Ext(filename))]; ok {
+			return filename, true
+		}
+	}
+	return "", false
+}
+
+// coverTarget возвращает имя файла из значения свойства с обложкой: pic.png,
+// [[pic.png]] или ![[pic.png|Подпись]].
+func coverTarget(value interface{}) (string, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return "", false
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "!"))
+	if inner, ok := strings.CutPrefix(text, "[["); ok {
+		text, _ = strings.CutSuffix(inner, "]]")
+	}
+	filename, _ := parseEmbed(text)
+	return filename, filename != ""
+}
+
+// applyCover заполняет свойство --cover-key (например, cover.image) адресом обложки
+// внутри каталога поста. Обложкой становится вложение из свойства --cover-property
+// или, если его нет, первая встроенная картинка заметки image. Файл копируется
+// так же, как остальные вложения. Если --cover-key уже указывает на вложение,
+// оно копируется, а путь заменяется; внешние адреса не меняются.
+func applyCover(properties map[string]interface{}, image string, copier *attachmentCopier) {
+	if current, ok := nestedValue(properties, *coverKey); ok {
+		if filename, ok := coverTarget(current); ok && isAttachmentFile(filename, copier.noteDir) {
+			if newFilename, ok := copier.copy(filename); ok {
+				setNestedValue(properties, *coverKey, attachmentURL(newFilename))
+			}
+		}
+		return
+	}
+
+	source := "первой картинки в тексте"
+	if value, ok := properties[*coverProperty]; ok && *coverProperty != "" {
+		if filename, ok := coverTarget(value); ok && isAttachmentFile(filename, copier.noteDir) {
+			delete(properties, *coverProperty) // Значение переносится в --cover-key
+			image, source = filename, "свойства '"+*coverProperty+"'"
+		}
+	}
+	if image == "" {
+		return
+	}
+	newFilename, ok := copier.copy(image)
+	if !ok {
+		return
+	}
+	if setNestedValue(properties, *coverKey, attachmentURL(newFilename)) {
+		logf(DEBUG, "Свойство '%s' взято из %s: %s", *coverKey, source, newFilename)
+	}
+}
+
+// nestedValue возвращает значение свойства по пути через точку (cover.image).
+func nestedValue(properties map[string]interface{}, key string) (interface{}, bool) {
+	parts := strings.Split(key, ".")
+	current := properties
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	value, ok := current[parts[len(parts)-1]]
+	return value, ok
+}
+
+// setNestedValue устанавливает свойство по пути через точку, создавая недостающие
+// отображения. Если на пути встречается значение, не являющееся отображением,
+// свойство не устанавливается.
+func setNestedValue(properties map[string]interface{}, key string, value interface{}) bool {
+	parts := strings.Split(key, ".")
+	current := properties
+	for _, part := range parts[:len(parts)-1] {
+		existing, ok := current[part]
+		if !ok {
+			next := make(map[string]interface{})
+			current[part] = next
+			current = next
+			continue
+		}
+		next, ok := existing.(map[string]interface{})
+		if !ok {
+			logf(WARNING, "Свойство '%s' не является отображением, '%s' не установлено.", part, key)
+			return false
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+	return true
+}
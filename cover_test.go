@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFirstEmbeddedImage(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+		ok      bool
+	}{
+		{"Text ![[doc.pdf]] and ![[Pic.PNG|Caption]] and ![[other.jpg]]", "Pic.PNG", true},
+		{"Only ![[doc.pdf]] and [[link]]", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := firstEmbeddedImage(tt.content)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("firstEmbeddedImage(%q) = %q, %v, want %q, %v", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCoverTarget(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+		ok    bool
+	}{
+		{"pic.png", "pic.png", true},
+		{"[[pic.png]]", "pic.png", true},
+		{" ![[pic.png|Подпись]] ", "pic.png", true},
+		{"", "", false},
+		{42, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := coverTarget(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("coverTarget(%v) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNestedValue(t *testing.T) {
+	properties := map[string]interface{}{"title": "Note"}
+	if !setNestedValue(properties, "cover.image", "cover.png") {
+		t.Fatal("setNestedValue(cover.image) returned false")
+	}
+	want := map[string]interface{}{"title": "Note", "cover": map[string]interface{}{"image": "cover.png"}}
+	if !reflect.DeepEqual(properties, want) {
+		t.Errorf("properties = %v, want %v", properties, want)
+	}
+	if value, ok := nestedValue(properties, "cover.image"); !ok || value != "cover.png" {
+		t.Errorf("nestedValue(cover.image) = %v, %v", value, ok)
+	}
+	if _, ok := nestedValue(properties, "title.image"); ok {
+		t.Error("nestedValue(title.image) found a value inside a string")
+	}
+	if setNestedValue(properties, "title.image", "cover.png") {
+		t.Error("setNestedValue(title.image) replaced a string property")
+	}
+}
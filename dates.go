@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// filenameDatePattern — дата в начале имени заметки (2024-03-15 Заметка, 2024-03-15_заметка)
+// и разделитель после нее.
+var filenameDatePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})(?:[\s_-]+|$)`)
+
+// filenameDate возвращает дату из начала имени заметки для --date-from-filename.
+func filenameDate(path string) (string, bool) {
+	match := filenameDatePattern.FindStringSubmatch(noteName(path))
+	if match == nil {
+		return "", false
+	}
+	if _, err := time.Parse("2006-01-02", match[1]); err != nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// postName возвращает имя заметки для заголовка и каталога поста: с --date-from-filename
+// без даты в начале. Имя, состоящее из одной даты (ежедневная заметка), не меняется.
+func postName(path string) string {
+	name := noteName(path)
+	if !*dateFromFilename {
+		return name
+	}
+	if _, ok := filenameDate(path); !ok {
+		return name
+	}
+	if stripped := filenameDatePattern.ReplaceAllString(name, ""); stripped != "" {
+		return stripped
+	}
+	return name
+}
+
+// propertyDate ищет среди свойств заметки первое из keys (без учета регистра) с датой
+// и возвращает ключ и значение для Hugo. Даты из YAML сохраняются как есть, строки
+// в формате dateLayouts приводятся к RFC 3339; дата без времени остается датой.
+func propertyDate(properties map[string]interface{}, keys []string) (string, interface{}, bool) {
+	for _, want := range keys {
+		for key, value := range properties {
+			if !strings.EqualFold(key, want) {
+				continue
+			}
+			switch v := value.(type) {
+			case time.Time:
+				if isDateOnly(v) {
+					return key, v.Format("2006-01-02"), true
+				}
+				return key, v, true
+			case string:
+				date, ok := parseDate(v)
+				if !ok {
+					continue
+				}
+				if _, err := time.Parse("2006-01-02", strings.TrimSpace(v)); err == nil {
+					return key, strings.TrimSpace(v), true
+				}
+				return key, date.Format(time.RFC3339), true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// applyObsidianDates заполняет свойства 'date' и 'lastmod', если их нет, из свойств
+// с датами создания и изменения, которые пишут Obsidian и его плагины
+// (created, modified, date created и т.п., см. --created-keys и --modified-keys).
+func applyObsidianDates(properties map[string]interface{}, path string) {
+	targets := []struct{ name, keys string }{
+		{"date", *createdKeys},
+		{"lastmod", *modifiedKeys},
+	}
+	for _, target := range targets {
+		if _, ok := properties[target.name]; ok {
+			continue
+		}
+		if key, value, ok := propertyDate(properties, splitList(target.keys)); ok {
+			properties[target.name] = value
+			logf(DEBUG, "Свойство '%s' заметки '%s' взято из '%s'.", target.name, filepath.Base(path), key)
+		}
+	}
+}
+
+// dateSources — источники свойства 'date' для --date-source, кроме property.
+// Каждый возвращает дату для заметки path или false, если ее нет.
+var dateSources = map[string]func(path string) (time.Time, bool){
+	"mtime": func(path string) (time.Time, bool) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return info.ModTime(), true
+	},
+	"birth": fileBirthTime,
+	"now": func(string) (time.Time, bool) {
+		return time.Now(), true
+	},
+}
+
+// applyDateSource устанавливает свойство 'date' из первого источника --date-source,
+// который дает дату. property означает уже заданное свойство 'date' (в том числе из
+// --date-from-inline и --created-keys): если он стоит не первым, предыдущие источники
+// важнее свойства. previous — дата из поста target, сгенерированного прошлым запуском.
+func applyDateSource(properties map[string]interface{}, path, target string) {
+	for _, source := range splitList(*dateSource) {
+		switch source {
+		case "property":
+			if _, ok := properties["date"]; ok {
+				return
+			}
+			continue
+		case "previous":
+			if date, ok := previousDate(target); ok {
+				properties["date"] = date
+				logf(DEBUG, "Свойство 'date' заметки '%s' взято из %s: '%s'", filepath.Base(path), target, date)
+				return
+			}
+			continue
+		}
+		if date, ok := dateSources[source](path); ok {
+			properties["date"] = date.Format(time.RFC3339)
+			logf(DEBUG, "Свойство 'date' заметки '%s' взято из источника %s: '%s'", filepath.Base(path), source, properties["date"])
+			return
+		}
+	}
+}
+
+// previousDate возвращает свойство 'date' уже сгенерированного поста target в любом
+// из форматов --front-matter-format, чтобы повторный запуск не менял дату публикации.
+func previousDate(target string) (string, bool) {
+	return generatedProperty(target, "date")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilenameDate(t *testing.T) {
+	tests := []struct {
+		path, want string
+		ok         bool
+	}{
+		{"/vault/2024-03-15 Note.md", "2024-03-15", true},
+		{"/vault/2024-03-15_note.md", "2024-03-15", true},
+		{"/vault/2024-03-15.md", "2024-03-15", true},
+		{"/vault/2024-13-45 Note.md", "", false},
+		{"/vault/Note 2024-03-15.md", "", false},
+		{"/vault/2024-03-15x.md", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := filenameDate(tt.path); got != tt.want || ok != tt.ok {
+			t.Errorf("filenameDate(%q) = (%q, %t), want (%q, %t)", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPostName(t *testing.T) {
+	saved := *dateFromFilename
+	t.Cleanup(func() { *dateFromFilename = saved })
+
+	tests := []struct {
+		fromFilename bool
+		path, want   string
+	}{
+		{false, "/vault/2024-03-15 Note.md", "2024-03-15 Note"},
+		{true, "/vault/2024-03-15 Note.md", "Note"},
+		{true, "/vault/2024-03-15.md", "2024-03-15"},
+		{true, "/vault/Note.md", "Note"},
+	}
+	for _, tt := range tests {
+		*dateFromFilename = tt.fromFilename
+		if got := postName(tt.path); got != tt.want {
+			t.Errorf("postName(%q) with --date-from-filename=%t = %q, want %q", tt.path, tt.fromFilename, got, tt.want)
+		}
+	}
+}
+
+func TestPropertyDate(t *testing.T) {
+	local := time.Date(2024, 3, 15, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		keys       []string
+		key        string
+		want       interface{}
+		ok         bool
+	}{
+		{"date only", map[string]interface{}{"created": "2024-03-15"}, []string{"created"}, "created", "2024-03-15", true},
+		{"date and time", map[string]interface{}{"created": "2024-03-15 10:30"}, []string{"created"}, "created", local.Format(time.RFC3339), true},
+		{"yaml date", map[string]interface{}{"created": time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)}, []string{"created"}, "created", "2024-03-15", true},
+		{"case-insensitive key", map[string]interface{}{"Date Created": "2024-03-15"}, []string{"date created"}, "Date Created", "2024-03-15", true},
+		{"key order", map[string]interface{}{"created": "2024-03-15", "ctime": "2024-01-01"}, []string{"ctime", "created"}, "ctime", "2024-01-01", true},
+		{"not a date", map[string]interface{}{"created": "yesterday"}, []string{"created"}, "", nil, false},
+		{"missing", map[string]interface{}{}, []string{"created"}, "", nil, false},
+	}
+	for _, tt := range tests {
+		key, value, ok := propertyDate(tt.properties, tt.keys)
+		if key != tt.key || value != tt.want || ok != tt.ok {
+			t.Errorf("%s: propertyDate = (%q, %v, %t), want (%q, %v, %t)", tt.name, key, value, ok, tt.key, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestApplyObsidianDates(t *testing.T) {
+	properties := map[string]interface{}{"date": "2024-01-01", "created": "2024-03-15", "updated": "2024-04-01"}
+	applyObsidianDates(properties, "/vault/Note.md")
+	if properties["date"] != "2024-01-01" {
+		t.Errorf("date = %v, want the existing value kept", properties["date"])
+	}
+	if properties["lastmod"] != "2024-04-01" {
+		t.Errorf("lastmod = %v, want the value of 'updated'", properties["lastmod"])
+	}
+}
+
+func TestApplyDateSource(t *testing.T) {
+	saved := *dateSource
+	t.Cleanup(func() { *dateSource = saved })
+
+	dir := t.TempDir()
+	notePath := filepath.Join(dir, "Note.md")
+	if err := os.WriteFile(notePath, []byte("Text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2023, 5, 6, 7, 8, 9, 0, time.Local)
+	if err := os.Chtimes(notePath, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	previous := filepath.Join(dir, "index.md")
+	if err := os.WriteFile(previous, []byte("---\ndate: 2022-01-01\n---\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, source, target string
+		properties           map[string]interface{}
+		want                 interface{}
+	}{
+		{"property first", "property,mtime", previous, map[string]interface{}{"date": "2024-01-01"}, "2024-01-01"},
+		{"mtime before property", "mtime,property", previous, map[string]interface{}{"date": "2024-01-01"}, mtime.Format(time.RFC3339)},
+		{"previous post", "property,previous,mtime", previous, map[string]interface{}{}, "2022-01-01"},
+		{"no previous post", "property,previous,mtime", filepath.Join(dir, "missing.md"), map[string]interface{}{}, mtime.Format(time.RFC3339)},
+		{"no source", "property", previous, map[string]interface{}{}, nil},
+	}
+	for _, tt := range tests {
+		*dateSource = tt.source
+		applyDateSource(tt.properties, notePath, tt.target)
+		if got := tt.properties["date"]; got != tt.want {
+			t.Errorf("%s: date = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// plannedAction — действие с файловой системой, которое было бы выполнено без --dry-run.
+type plannedAction struct {
+	verb, path, source string
+}
+
+// dryRunPlan накапливает действия в режиме --dry-run.
+var dryRunPlan = struct {
+	sync.Mutex
+	actions []plannedAction
+}{}
+
+// planAction записывает действие в план --dry-run.
+func planAction(verb, path, source string) {
+	dryRunPlan.Lock()
+	defer dryRunPlan.Unlock()
+	dryRunPlan.actions = append(dryRunPlan.actions, plannedAction{verb: verb, path: path, source: source})
+}
+
+// writeFile записывает файл или, с --dry-run, добавляет запись в план: создать,
+// обновить или без изменений, если содержимое совпадает с уже записанным.
+func writeFile(path string, data []byte) error {
+	if !*dryRun {
+		return os.WriteFile(path, data, 0644)
+	}
+	existing, err := os.ReadFile(path)
+	switch {
+	case err != nil:
+		planAction("создать", path, "")
+	case bytes.Equal(existing, data):
+		planAction("без изменений", path, "")
+	default:
+		planAction("обновить", path, "")
+	}
+	return nil
+}
+
+// mkdirAll создает каталог со всеми родительскими или, с --dry-run, добавляет его
+// в план, если каталога еще нет.
+func mkdirAll(path string) error {
+	if !*dryRun {
+		return os.MkdirAll(path, 0755)
+	}
+	if !isDir(path) {
+		planAction("создать каталог", path, "")
+	}
+	return nil
+}
+
+// removeFile удаляет файл или, с --dry-run, добавляет удаление в план.
+func removeFile(path string) error {
+	if !*dryRun {
+		return os.Remove(path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	planAction("удалить", path, "")
+	return nil
+}
+
+// printDryRunPlan выводит план --dry-run, отсортированный по целевому пути.
+// Повторяющиеся действия (один каталог для нескольких заметок) выводятся один раз.
+func printDryRunPlan(w io.Writer) {
+	dryRunPlan.Lock()
+	defer dryRunPlan.Unlock()
+
+	actions := dryRunPlan.actions
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].path < actions[j].path })
+	counts := make(map[string]int)
+	seen := make(map[plannedAction]struct{})
+	for _, action := range actions {
+		if _, ok := seen[action]; ok {
+			continue
+		}
+		seen[action] = struct{}{}
+		counts[action.verb]++
+		if rel, err := filepath.Rel(*hugoPostsDir, action.path); err == nil && !filepath.IsAbs(rel) && rel[0] != '.' {
+			action.path = rel
+		}
+		if action.source != "" {
+			fmt.Fprintf(w, "%-16s %s <- %s\n", action.verb, action.path, action.source)
+		} else {
+			fmt.Fprintf(w, "%-16s %s\n", action.verb, action.path)
+		}
+	}
+	fmt.Fprintf(w, "Итого: создать %d, обновить %d, без изменений %d, скопировать %d, удалить %d, новых каталогов %d\n",
+		counts["создать"], counts["обновить"], counts["без изменений"], counts["скопировать"], counts["удалить"], counts["создать каталог"])
+}
+
+// removeAll удаляет каталог со всем содержимым или, с --dry-run, добавляет удаление в план.
+func removeAll(path string) error {
+	if !*dryRun {
+		return os.RemoveAll(path)
+	}
+	planAction("удалить", path, "")
+	return nil
+}
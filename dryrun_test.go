@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRunPlansInsteadOfWriting(t *testing.T) {
+	posts := t.TempDir()
+	savedDryRun, savedPosts := *dryRun, *hugoPostsDir
+	*dryRun, *hugoPostsDir = true, posts
+	dryRunPlan.actions = nil
+	t.Cleanup(func() {
+		*dryRun, *hugoPostsDir = savedDryRun, savedPosts
+		dryRunPlan.actions = nil
+	})
+
+	same := filepath.Join(posts, "same.md")
+	changed := filepath.Join(posts, "changed.md")
+	for _, path := range []string{same, changed} {
+		if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newDir := filepath.Join(posts, "new")
+	if err := mkdirAll(newDir); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{filepath.Join(newDir, "index.md"): "new", same: "old", changed: "new"} {
+		if err := writeFile(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := removeFile(same); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeFile(filepath.Join(posts, "missing.md")); err == nil {
+		t.Error("removeFile of a missing file returned no error")
+	}
+
+	if isDir(newDir) {
+		t.Error("mkdirAll created a directory with --dry-run")
+	}
+	if data, _ := os.ReadFile(changed); string(data) != "old" {
+		t.Errorf("writeFile changed the file with --dry-run: %q", data)
+	}
+	if _, err := os.Stat(same); err != nil {
+		t.Error("removeFile deleted the file with --dry-run")
+	}
+
+	var out bytes.Buffer
+	printDryRunPlan(&out)
+	for _, want := range []string{
+		"создать          " + filepath.Join("new", "index.md"),
+		"обновить         changed.md",
+		"без изменений    same.md",
+		"удалить          same.md",
+		"Итого: создать 1, обновить 1, без изменений 1, скопировать 0, удалить 1, новых каталогов 1",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
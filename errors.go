@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ошибки заметок хранят путь к исходной заметке, а имя для сообщения получают
+// из него: так ошибки заметок с одинаковыми именами в разных каталогах различимы.
+
+// ParseError — не удалось разобрать front matter заметки.
+type ParseError struct {
+	Path string // путь к заметке
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("не удалось разобрать front matter для %s: %v", noteName(e.Path), e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// AttachmentError — вложение заметки не найдено или не скопировано.
+type AttachmentError struct {
+	Path       string // путь к заметке
+	Attachment string // имя вложения, как оно записано в заметке
+	Err        error
+}
+
+func (e *AttachmentError) Error() string {
+	return fmt.Sprintf("вложение '%s' заметки '%s': %v", e.Attachment, noteName(e.Path), e.Err)
+}
+
+func (e *AttachmentError) Unwrap() error { return e.Err }
+
+// CollisionError — две заметки претендуют на одно и то же имя.
+type CollisionError struct {
+	Path      string // путь к заметке, которая уступает имя
+	OtherPath string // путь к заметке, которой имя досталось
+	Name      string // спорное имя (псевдоним, каталог поста и т.п.)
+}
+
+func (e *CollisionError) Error() string {
+	other := noteName(e.OtherPath)
+	return fmt.Sprintf("заметки '%s' и '%s' претендуют на имя '%s', используется '%s'", other, noteName(e.Path), e.Name, other)
+}
+
+// LinkError — вики-ссылка не может быть разрешена полностью.
+type LinkError struct {
+	Path   string // путь к заметке со ссылкой
+	Target string // цель ссылки
+	Reason string
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("ссылка из заметки '%s' на '%s': %s", noteName(e.Path), e.Target, e.Reason)
+}
+
+// Коды завершения программы
+const (
+	exitOK          = 0
+	exitFatal       = 1 // обработка прервана
+	exitUsage       = 2 // неизвестная команда или лишние аргументы, как у ошибок разбора параметров в пакете flag
+	exitParseErrors = 3 // с --strict: есть заметки с неразобранным front matter
+	exitAttachments = 4 // с --strict: есть проблемы с вложениями
+	exitCollisions  = 5 // с --strict: есть конфликты имен
+	exitLinks       = 6 // с --strict: есть неразрешенные ссылки
+)
+
+// noteErrors собирает ошибки отдельных заметок, которые не прерывают обработку.
+var noteErrors struct {
+	sync.Mutex
+	list []error
+}
+
+// reportError выводит ошибку заметки в лог и запоминает ее для кода завершения.
+func reportError(err error) {
+	logf(errorLevel(err), "%s", capitalize(err.Error()))
+	noteErrors.Lock()
+	noteErrors.list = append(noteErrors.list, err)
+	noteErrors.Unlock()
+}
+
+// resetNoteErrors забывает ошибки заметок перед повторной конвертацией (--watch).
+func resetNoteErrors() {
+	noteErrors.Lock()
+	noteErrors.list = nil
+	noteErrors.Unlock()
+}
+
+// errorLevel возвращает уровень логирования для ошибки заметки.
+func errorLevel(err error) LogLevel {
+	var collision *CollisionError
+	if errors.As(err, &collision) {
+		return ERROR
+	}
+	return WARNING
+}
+
+// exitCode возвращает код завершения по собранным ошибкам заметок.
+// Без --strict ошибки отдельных заметок не влияют на код завершения.
+func exitCode() int {
+	if !*strict {
+		return exitOK
+	}
+	noteErrors.Lock()
+	defer noteErrors.Unlock()
+
+	code := exitOK
+	for _, err := range noteErrors.list {
+		var (
+			parseErr      *ParseError
+			attachmentErr *AttachmentError
+			collisionErr  *CollisionError
+			linkErr       *LinkError
+		)
+		errCode := exitOK
+		switch {
+		case errors.As(err, &parseErr):
+			errCode = exitParseErrors
+		case errors.As(err, &attachmentErr):
+			errCode = exitAttachments
+		case errors.As(err, &collisionErr):
+			errCode = exitCollisions
+		case errors.As(err, &linkErr):
+			errCode = exitLinks
+		}
+		// Самый важный вид ошибок — с наименьшим кодом
+		if errCode != exitOK && (code == exitOK || errCode < code) {
+			code = errCode
+		}
+	}
+	return code
+}
+
+// capitalize делает первую букву сообщения заглавной.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// hasNoteErrors проверяет, были ли ошибки при обработке заметки path. Заметки
+// сравниваются по пути: одноименные заметки в разных каталогах не смешиваются.
+func hasNoteErrors(path string) bool {
+	noteErrors.Lock()
+	defer noteErrors.Unlock()
+	for _, err := range noteErrors.list {
+		var note string
+		switch e := err.(type) {
+		case *ParseError:
+			note = e.Path
+		case *AttachmentError:
+			note = e.Path
+		case *CollisionError:
+			note = e.Path
+		case *LinkError:
+			note = e.Path
+		}
+		if note == path {
+			return true
+		}
+	}
+	return false
+}
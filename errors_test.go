@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestHasNoteErrorsMatchesPath(t *testing.T) {
+	resetNoteErrors()
+	t.Cleanup(resetNoteErrors)
+
+	reportError(&LinkError{Path: "/vault/a/Index.md", Target: "Missing", Reason: "заметка не найдена или не опубликована"})
+	if !hasNoteErrors("/vault/a/Index.md") {
+		t.Errorf("hasNoteErrors(a/Index.md) = false, want true")
+	}
+	if hasNoteErrors("/vault/b/Index.md") {
+		t.Errorf("hasNoteErrors(b/Index.md) = true, want false for a note with the same name in another folder")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// tagExpr — логическое выражение над тегами заметки (--filter).
+type tagExpr interface {
+	eval(tags []string) bool
+	// positiveTags возвращает теги, наличие которых выражение требует, а не запрещает.
+	positiveTags() []string
+}
+
+type tagTerm string
+
+type notExpr struct{ operand tagExpr }
+
+type binaryExpr struct {
+	and         bool
+	left, right tagExpr
+}
+
+func (t tagTerm) eval(tags []string) bool {
+	_, ok := findNestedTag(tags, string(t))
+	return ok
+}
+func (t tagTerm) positiveTags() []string { return []string{string(t)} }
+
+func (e notExpr) eval(tags []string) bool { return !e.operand.eval(tags) }
+func (e notExpr) positiveTags() []string  { return nil }
+
+func (e binaryExpr) eval(tags []string) bool {
+	if e.and {
+		return e.left.eval(tags) && e.right.eval(tags)
+	}
+	return e.left.eval(tags) || e.right.eval(tags)
+}
+
+func (e binaryExpr) positiveTags() []string {
+	return append(e.left.positiveTags(), e.right.positiveTags()...)
+}
+
+// noteFilter — разобранное выражение --filter или nil, если оно не задано.
+var noteFilter tagExpr
+
+// parseTagExpr разбирает выражение вида "blog AND NOT draft" или "(blog || til) && !private".
+// NOT (!) связывает сильнее AND (&&), AND — сильнее OR (||). Ключевые слова пишутся
+// заглавными буквами, все остальные слова считаются тегами.
+func parseTagExpr(expression string) (tagExpr, error) {
+	tokens, err := tokenizeTagExpr(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("пустое выражение")
+	}
+	p := &tagExprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("лишний элемент '%s'", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+// tokenizeTagExpr разбивает выражение на теги, операторы и скобки. Операторы
+// приводятся к виду AND, OR и NOT. Ведущий # у тегов отбрасывается.
+func tokenizeTagExpr(expression string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '!':
+			tokens = append(tokens, "NOT")
+			i++
+		case r == '&' || r == '|':
+			if i+1 >= len(runes) || runes[i+1] != r {
+				return nil, fmt.Errorf("ожидался оператор '%c%c'", r, r)
+			}
+			if r == '&' {
+				tokens = append(tokens, "AND")
+			} else {
+				tokens = append(tokens, "OR")
+			}
+			i += 2
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()!&|", runes[i]) {
+				i++
+			}
+			tag := strings.TrimPrefix(string(runes[start:i]), "#")
+			if tag == "" {
+				return nil, fmt.Errorf("пустой тег")
+			}
+			tokens = append(tokens, tag)
+		}
+	}
+	return tokens, nil
+}
+
+// tagExprParser — рекурсивный спуск по токенам выражения --filter.
+type tagExprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *tagExprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *tagExprParser) parseOr() (tagExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseAnd() (tagExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "AND" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseNot() (tagExpr, error) {
+	if p.peek() == "NOT" {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *tagExprParser) parsePrimary() (tagExpr, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("выражение оборвано")
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("не закрыта скобка")
+		}
+		p.pos++
+		return expr, nil
+	case ")", "AND", "OR":
+		return nil, fmt.Errorf("неожиданный элемент '%s'", token)
+	}
+	p.pos++
+	return tagTerm(token), nil
+}
+
+// propertyFilter — условия --filter-property: свойство -> требуемое значение.
+var propertyFilter map[string]string
+
+// parsePropertyFilter разбирает список условий вида "publish=true,status=done".
+func parsePropertyFilter(list string) (map[string]string, error) {
+	for _, pair := range splitList(list) {
+		if key, _, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("условие '%s' должно иметь вид свойство=значение", pair)
+		}
+	}
+	return parseKeyValueList(list), nil
+}
+
+// propertyMatches проверяет, что значение свойства равно want без учета регистра
+// (true подходит и к true, и к True). Для списков достаточно одного элемента.
+func propertyMatches(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, item := range v {
+			if propertyMatches(item, want) {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.EqualFold(fmt.Sprint(value), want)
+}
+
+// selectNote проверяет, отбирается ли заметка со свойствами properties и тегами tags
+// по --filter-property, --filter или --filter-tag, и возвращает причину для журнала.
+// --filter-property заменяет отбор по тегам, если --filter и --filter-tag не заданы явно,
+// иначе заметка должна подходить под оба условия.
+func selectNote(properties map[string]interface{}, tags []string) (string, bool) {
+	if len(propertyFilter) > 0 {
+		keys := make([]string, 0, len(propertyFilter))
+		for key := range propertyFilter {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !propertyMatches(properties[key], propertyFilter[key]) {
+				return fmt.Sprintf("свойство '%s' не равно '%s'", key, propertyFilter[key]), false
+			}
+		}
+		if noteFilter == nil && !filterTags.set {
+			return "подходит под --filter-property", true
+		}
+	}
+	if noteFilter != nil {
+		if noteFilter.eval(tags) {
+			return "подходит под --filter", true
+		}
+		return "теги не подходят под --filter", false
+	}
+	if len(tags) == 0 {
+		return "у нее нет тегов", false
+	}
+	if tag, ok := matchFilterTag(tags); ok {
+		return fmt.Sprintf("найден тег '%s'", tag), true
+	}
+	return fmt.Sprintf("у нее нет тегов '%s'", filterTags.String()), false
+}
+
+// selectionTags возвращает теги, которые удаляет --remove-filter-tag: теги
+// --filter-tag или теги, которых требует выражение --filter.
+func selectionTags() []string {
+	if noteFilter != nil {
+		return noteFilter.positiveTags()
+	}
+	return filterTags.tags
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		tags []string
+		want bool
+	}{
+		{"blog", []string{"blog"}, true},
+		{"blog", []string{"blog/golang"}, true},
+		{"#blog", []string{"blog"}, true},
+		{"blog AND NOT draft", []string{"blog"}, true},
+		{"blog AND NOT draft", []string{"blog", "draft"}, false},
+		{"blog && !draft", []string{"blog", "draft"}, false},
+		{"blog OR til", []string{"til"}, true},
+		{"blog || til && private", []string{"blog"}, true},
+		{"(blog || til) && private", []string{"blog"}, false},
+		{"(blog || til) && !private", []string{"til"}, true},
+		{"NOT NOT blog", []string{"blog"}, true},
+		{"and || or", []string{"or"}, true},
+	}
+	for _, tt := range tests {
+		expr, err := parseTagExpr(tt.expr)
+		if err != nil {
+			t.Errorf("parseTagExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := expr.eval(tt.tags); got != tt.want {
+			t.Errorf("parseTagExpr(%q).eval(%v) = %t, want %t", tt.expr, tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestParseTagExprErrors(t *testing.T) {
+	for _, expr := range []string{"", "  ", "blog &", "blog & til", "blog |", "(blog", "blog)", "AND blog", "blog NOT", "blog til", "#", "!"} {
+		if _, err := parseTagExpr(expr); err == nil {
+			t.Errorf("parseTagExpr(%q) returned no error", expr)
+		}
+	}
+}
+
+func TestTagExprPositiveTags(t *testing.T) {
+	expr, err := parseTagExpr("(blog || til) && !draft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := expr.positiveTags(), []string{"blog", "til"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("positiveTags = %v, want %v", got, want)
+	}
+}
+
+func TestParsePropertyFilter(t *testing.T) {
+	got, err := parsePropertyFilter("publish=true, status = done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"publish": "true", "status": "done"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePropertyFilter = %v, want %v", got, want)
+	}
+	for _, list := range []string{"publish", "=true", "publish=true,status"} {
+		if _, err := parsePropertyFilter(list); err == nil {
+			t.Errorf("parsePropertyFilter(%q) returned no error", list)
+		}
+	}
+}
+
+func TestPropertyMatches(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+		ok    bool
+	}{
+		{true, "true", true},
+		{"True", "true", true},
+		{"done", "DONE", true},
+		{3, "3", true},
+		{[]interface{}{"draft", "done"}, "done", true},
+		{[]interface{}{"draft"}, "done", false},
+		{nil, "", false},
+		{false, "true", false},
+	}
+	for _, tt := range tests {
+		if got := propertyMatches(tt.value, tt.want); got != tt.ok {
+			t.Errorf("propertyMatches(%v, %q) = %t, want %t", tt.value, tt.want, got, tt.ok)
+		}
+	}
+}
+
+func TestSelectNote(t *testing.T) {
+	savedTags, savedFilter, savedProperties := filterTags, noteFilter, propertyFilter
+	t.Cleanup(func() { filterTags, noteFilter, propertyFilter = savedTags, savedFilter, savedProperties })
+	expr, err := parseTagExpr("til && !private")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := map[string]interface{}{"publish": true}
+	tests := []struct {
+		name       string
+		tags       tagList
+		filter     tagExpr
+		properties map[string]string
+		noteProps  map[string]interface{}
+		noteTags   []string
+		want       bool
+	}{
+		{"default tag", tagList{tags: []string{"blog"}}, nil, nil, nil, []string{"blog"}, true},
+		{"nested tag", tagList{tags: []string{"blog"}}, nil, nil, nil, []string{"blog/go"}, true},
+		{"no tags", tagList{tags: []string{"blog"}}, nil, nil, nil, nil, false},
+		{"other tag", tagList{tags: []string{"blog"}}, nil, nil, nil, []string{"go"}, false},
+		{"any of several tags", tagList{tags: []string{"blog", "til"}, set: true}, nil, nil, nil, []string{"til"}, true},
+		{"expression", tagList{tags: []string{"blog"}}, expr, nil, nil, []string{"til"}, true},
+		{"expression rejects", tagList{tags: []string{"blog"}}, expr, nil, nil, []string{"blog", "private"}, false},
+		{"property replaces tags", tagList{tags: []string{"blog"}}, nil, map[string]string{"publish": "true"}, published, nil, true},
+		{"property mismatch", tagList{tags: []string{"blog"}}, nil, map[string]string{"publish": "true"}, nil, []string{"blog"}, false},
+		{"property and explicit tag", tagList{tags: []string{"blog"}, set: true}, nil, map[string]string{"publish": "true"}, published, []string{"go"}, false},
+	}
+	for _, tt := range tests {
+		filterTags, noteFilter, propertyFilter = tt.tags, tt.filter, tt.properties
+		if reason, got := selectNote(tt.noteProps, tt.noteTags); got != tt.want {
+			t.Errorf("%s: selectNote = (%q, %t), want %t", tt.name, reason, got, tt.want)
+		}
+	}
+}
+
+func TestSelectionTags(t *testing.T) {
+	savedTags, savedFilter := filterTags, noteFilter
+	t.Cleanup(func() { filterTags, noteFilter = savedTags, savedFilter })
+
+	filterTags, noteFilter = tagList{tags: []string{"blog", "til"}}, nil
+	if got, want := selectionTags(), []string{"blog", "til"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selectionTags with --filter-tag = %v, want %v", got, want)
+	}
+	expr, err := parseTagExpr("notes && !draft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteFilter = expr
+	if got, want := selectionTags(), []string{"notes"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("selectionTags with --filter = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatterSerializers сериализуют front matter в формате --front-matter-format.
+// Каждая функция получает ключи в итоговом порядке и свойства заметки и возвращает
+// блок front matter вместе с разделителями.
+var frontMatterSerializers = map[string]func(node *yaml.Node, keys []string, properties map[string]interface{}) (string, error){
+	"yaml": serializeYAML,
+	"toml": serializeTOML,
+	"json": serializeJSON,
+}
+
+// formatFrontMatter возвращает блок front matter для узла node, собранного
+// buildFrontMatterNode. Для пустого front matter возвращается пустая строка.
+func formatFrontMatter(node *yaml.Node, properties map[string]interface{}) (string, error) {
+	var keys []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keys = append(keys, node.Content[i].Value)
+	}
+	if len(keys) == 0 {
+		return "", nil
+	}
+	serialize, ok := frontMatterSerializers[*frontMatterFormat]
+	if !ok {
+		serialize = serializeYAML
+	}
+	return serialize(node, keys, properties)
+}
+
+// serializeYAML выводит front matter в YAML между разделителями ---.
+// Используется сам узел, поэтому сохраняются комментарии и стиль значений.
+func serializeYAML(node *yaml.Node, _ []string, _ map[string]interface{}) (string, error) {
+	out, err := marshalYAMLNode(node)
+	if err != nil {
+		return "", fmt.Errorf("не удалось преобразовать front matter в YAML: %w", err)
+	}
+	return "---\n" + string(out) + "---\n", nil
+}
+
+// serializeJSON выводит front matter как JSON-объект, который Hugo распознает без разделителей.
+func serializeJSON(_ *yaml.Node, keys []string, properties map[string]interface{}) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for i, key := range keys {
+		item := jsonValue(properties[key])
+		if date, ok := item.(time.Time); ok && isDateOnly(date) {
+			// Дата без времени остается датой, как в исходном YAML
+			item = date.Format("2006-01-02")
+		}
+		value, err := marshalJSON(item, "  ")
+		if err != nil {
+			return "", fmt.Errorf("не удалось преобразовать свойство '%s' в JSON: %w", key, err)
+		}
+		name, _ := marshalJSON(key, "")
+		sb.WriteString("  " + name + ": " + value)
+		if i < len(keys)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+// jsonValue приводит значения из YAML к виду, который понимает encoding/json:
+// отображения с нестроковыми ключами превращаются в map[string]interface{}.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = jsonValue(item)
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = jsonValue(item)
+		}
+		return result
+	}
+	return value
+}
+
+// marshalJSON кодирует значение в JSON с отступами, не экранируя <, > и &.
+func marshalJSON(value interface{}, prefix string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(prefix, "  ")
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// tomlBareKey — ключи TOML, которые можно писать без кавычек.
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlDateKeys — свойства Hugo с датами. Их строковые значения в формате даты
+// выводятся в TOML как даты, а не как строки.
+var tomlDateKeys = map[string]struct{}{"date": {}, "lastmod": {}, "publishDate": {}, "expiryDate": {}}
+
+// serializeTOML выводит front matter в TOML между разделителями +++. Простые значения
+// и списки идут первыми в исходном порядке, затем таблицы: в TOML все, что следует
+// за заголовком таблицы, относится к ней.
+func serializeTOML(_ *yaml.Node, keys []string, properties map[string]interface{}) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("+++\n")
+	if err := writeTOMLTable(&sb, "", keys, properties); err != nil {
+		return "", err
+	}
+	sb.WriteString("+++\n")
+	return sb.String(), nil
+}
+
+// writeTOMLTable записывает ключи keys таблицы values с путем prefix.
+func writeTOMLTable(sb *strings.Builder, prefix string, keys []string, values map[string]interface{}) error {
+	var tables []string
+	for _, key := range keys {
+		value := jsonValue(values[key])
+		if value == nil {
+			logf(DEBUG, "Свойство '%s' без значения пропущено: в TOML нет null.", key)
+			continue
+		}
+		if isTOMLTable(value) {
+			tables = append(tables, key)
+			continue
+		}
+		if _, isDate := tomlDateKeys[key]; isDate && prefix == "" {
+			if date, ok := tomlDate(value); ok {
+				sb.WriteString(tomlKey(key) + " = " + date + "\n")
+				continue
+			}
+		}
+		encoded, err := tomlValue(value)
+		if err != nil {
+			return fmt.Errorf("не удалось преобразовать свойство '%s' в TOML: %w", key, err)
+		}
+		sb.WriteString(tomlKey(key) + " = " + encoded + "\n")
+	}
+
+	for _, key := range tables {
+		path := tomlKey(key)
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		switch v := jsonValue(values[key]).(type) {
+		case map[string]interface{}:
+			sb.WriteString("\n[" + path + "]\n")
+			if err := writeTOMLTable(sb, path, sortedKeys(v), v); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, item := range v {
+				table := item.(map[string]interface{})
+				sb.WriteString("\n[[" + path + "]]\n")
+				if err := writeTOMLTable(sb, path, sortedKeys(table), table); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isTOMLTable проверяет, выводится ли значение как таблица ([ключ]) или массив
+// таблиц ([[ключ]]), а не как значение ключ = ....
+func isTOMLTable(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		if len(v) == 0 {
+			return false
+		}
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// tomlValue кодирует значение TOML в строчной форме.
+func tomlValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return tomlString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan", nil
+		case math.IsInf(v, 1):
+			return "inf", nil
+		case math.IsInf(v, -1):
+			return "-inf", nil
+		}
+		encoded := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(encoded, ".eEn") {
+			encoded += ".0"
+		}
+		return encoded, nil
+	case time.Time:
+		date, _ := tomlDate(v)
+		return date, nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if item == nil {
+				continue
+			}
+			encoded, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, encoded)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]interface{}:
+		items := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			if v[key] == nil {
+				continue
+			}
+			encoded, err := tomlValue(v[key])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, tomlKey(key)+" = "+encoded)
+		}
+		return "{" + strings.Join(items, ", ") + "}", nil
+	}
+	return "", fmt.Errorf("неподдерживаемый тип %T", value)
+}
+
+// tomlDate возвращает дату TOML для time.Time или строки в формате RFC 3339
+// либо ГГГГ-ММ-ДД. Дата без времени выводится как локальная дата TOML.
+func tomlDate(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		if isDateOnly(v) {
+			return v.Format("2006-01-02"), true
+		}
+		return v.Format(time.RFC3339Nano), true
+	case string:
+		if date, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return date.Format(time.RFC3339Nano), true
+		}
+		if date, err := time.Parse("2006-01-02", v); err == nil {
+			return date.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+// isDateOnly проверяет, что время получено из даты без времени (ГГГГ-ММ-ДД в YAML).
+func isDateOnly(t time.Time) bool {
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 && t.Location() == time.UTC
+}
+
+// tomlKey возвращает ключ TOML, при необходимости в кавычках.
+func tomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+// tomlString кодирует строку TOML. Экранирование JSON совместимо с базовыми строками TOML.
+func tomlString(s string) string {
+	encoded, _ := marshalJSON(s, "")
+	return encoded
+}
+
+// sortedKeys возвращает ключи отображения по алфавиту.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
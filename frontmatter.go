@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatterNode возвращает исходный front matter заметки в виде узла-отображения YAML.
+// В отличие от map, узел хранит порядок ключей и комментарии. Если front matter нет
+// или он не является отображением, возвращается nil.
+func frontMatterNode(fullContent string) *yaml.Node {
+	matches := frontMatterPattern.FindStringSubmatch(fullContent)
+	if len(matches) < 2 {
+		return nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(matches[1]), &doc); err != nil {
+		return nil
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return doc.Content[0]
+}
+
+// generatedFrontMatterNode возвращает front matter уже сгенерированного файла
+// в виде узла-отображения: YAML между --- или JSON-объект в начале файла
+// (--front-matter-format json). TOML не читается.
+func generatedFrontMatterNode(fullContent string) *yaml.Node {
+	if !strings.HasPrefix(strings.TrimLeft(fullContent, " \t\r\n"), "{") {
+		return frontMatterNode(fullContent)
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(fullContent)).Decode(&raw); err != nil {
+		return nil
+	}
+	// JSON — подмножество YAML, поэтому объект разбирается тем же парсером
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return doc.Content[0]
+}
+
+// tomlKeyPattern — строка TOML вида ключ = "значение" в сгенерированном front matter.
+var tomlKeyPattern = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=\s*"?([^"]+?)"?\s*$`)
+
+// generatedProperty возвращает строковое значение ключа верхнего уровня key из front
+// matter уже сгенерированного файла target в любом из форматов --front-matter-format.
+func generatedProperty(target, key string) (string, bool) {
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return "", false
+	}
+	content := string(data)
+	if block, ok := strings.CutPrefix(content, "+++\n"); ok {
+		end := strings.Index(block, "\n+++")
+		if end < 0 {
+			return "", false
+		}
+		for _, l := range strings.Split(block[:end], "\n") {
+			if l == "" || strings.HasPrefix(l, "[") {
+				break // Дальше идут таблицы, а нужен ключ верхнего уровня
+			}
+			if match := tomlKeyPattern.FindStringSubmatch(l); match != nil && match[1] == key {
+				return match[2], true
+			}
+		}
+		return "", false
+	}
+	node := generatedFrontMatterNode(content)
+	if node == nil {
+		return "", false
+	}
+	if value := mappingValue(node, key); value != nil && value.Kind == yaml.ScalarNode && value.Value != "" {
+		return value.Value, true
+	}
+	return "", false
+}
+
+// usesYAMLAliases проверяет, используются ли в front matter якоря (&x), ссылки (*x)
+// или ключи слияния (<<). При разборе в map они разворачиваются в обычные значения,
+// поэтому в итоговый файл попадают уже без них.
+func usesYAMLAliases(fullContent string) bool {
+	node := frontMatterNode(fullContent)
+	return node != nil && hasAliasNodes(node)
+}
+
+// hasAliasNodes рекурсивно ищет в дереве YAML якоря и ссылки на них.
+func hasAliasNodes(node *yaml.Node) bool {
+	if node.Anchor != "" || node.Kind == yaml.AliasNode {
+		return true
+	}
+	for _, child := range node.Content {
+		if hasAliasNodes(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyProtectedKeys переносит защищенные ключи (--protect-keys) из уже сгенерированного
+// файла targetPath в свойства заметки. Значения берутся без изменений вместе с комментариями;
+// ключ остается на своем месте в исходном front matter, а ключи, которых в заметке нет,
+// добавляются в том порядке, в каком они идут в сгенерированном файле.
+// Возвращает узел, который нужно использовать как исходный при записи.
+func applyProtectedKeys(properties map[string]interface{}, original *yaml.Node, targetPath string) *yaml.Node {
+	existingBytes, err := os.ReadFile(targetPath)
+	if err != nil {
+		return original
+	}
+	existing := generatedFrontMatterNode(string(existingBytes))
+	if existing == nil {
+		return original
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if original != nil {
+		merged.Content = append(merged.Content, original.Content...)
+	}
+
+	for _, key := range splitList(*protectKeys) {
+		valueNode := mappingValue(existing, key)
+		if valueNode == nil {
+			continue
+		}
+		var value interface{}
+		if err := valueNode.Decode(&value); err != nil {
+			logf(WARNING, "Не удалось прочитать защищенное свойство '%s' из %s: %v", key, targetPath, err)
+			continue
+		}
+		properties[key] = value
+
+		replaced := false
+		for i := 0; i+1 < len(merged.Content); i += 2 {
+			if merged.Content[i].Value == key {
+				merged.Content[i+1] = valueNode
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+			merged.Content = append(merged.Content, keyNode, valueNode)
+		}
+		logf(DEBUG, "Сохраняю защищенное свойство '%s' из %s", key, targetPath)
+	}
+	return merged
+}
+
+// mapAliases обрабатывает псевдонимы Obsidian в свойстве 'aliases' по --aliases.
+// В режиме redirect псевдонимы становятся адресами в разделе постов, построенными
+// так же, как адреса каталогов постов, и Hugo перенаправляет с них на пост.
+func mapAliases(properties map[string]interface{}) {
+	value, ok := properties["aliases"]
+	if !ok {
+		return
+	}
+	switch mode := *aliasesMode; {
+	case mode == "drop":
+		delete(properties, "aliases")
+		logf(DEBUG, "Свойство 'aliases' удалено.")
+	case mode == "redirect":
+		var paths []string
+		for _, alias := range extractStringList(value) {
+			if strings.HasPrefix(alias, "/") {
+				paths = append(paths, alias) // Уже адрес
+				continue
+			}
+			name := alias
+			if *slugifyBundles {
+				name = slugify(alias)
+			}
+			if name = pagePath(name); name != "" {
+				paths = append(paths, sectionURL()+name+"/")
+			}
+		}
+		if len(paths) > 0 {
+			properties["aliases"] = paths
+		} else {
+			delete(properties, "aliases")
+		}
+		logf(DEBUG, "Псевдонимы преобразованы в адреса перенаправлений: %v", paths)
+	default:
+		key := strings.TrimPrefix(mode, "rename:")
+		delete(properties, "aliases")
+		properties[key] = value
+		logf(DEBUG, "Свойство 'aliases' перенесено в '%s'.", key)
+	}
+}
+
+// renameKeyMap и copyKeyMap — разобранные --rename-keys и --copy-keys: исходный ключ -> ключ Hugo.
+var renameKeyMap, copyKeyMap map[string]string
+
+// listValuedKeys — свойства, которые Hugo и темы ожидают списком; одиночное значение,
+// перенесенное в них по --rename-keys или --copy-keys, оборачивается в список.
+var listValuedKeys = map[string]struct{}{"tags": {}, "categories": {}, "keywords": {}, "images": {}, "aliases": {}}
+
+// parseKeyMapping разбирает список вида "created=date,cover=images".
+func parseKeyMapping(list string) (map[string]string, error) {
+	for _, pair := range splitList(list) {
+		key, target, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(target) == "" {
+			return nil, fmt.Errorf("запись '%s' должна иметь вид свойство=ключ", pair)
+		}
+	}
+	return parseKeyValueList(list), nil
+}
+
+// mapKeys переносит (--rename-keys) или копирует (--copy-keys) свойства заметки в ключи,
+// которые ожидает тема Hugo. Значение, уже заданное в целевом ключе, не перезаписывается;
+// при переименовании исходный ключ удаляется в любом случае.
+func mapKeys(properties map[string]interface{}) {
+	for _, mapping := range []struct {
+		keys   map[string]string
+		rename bool
+	}{{copyKeyMap, false}, {renameKeyMap, true}} {
+		sources := make([]string, 0, len(mapping.keys))
+		for source := range mapping.keys {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			value, ok := properties[source]
+			if !ok {
+				continue
+			}
+			target := mapping.keys[source]
+			if mapping.rename {
+				delete(properties, source)
+			}
+			if _, exists := properties[target]; exists {
+				logf(DEBUG, "Свойство '%s' уже задано, значение '%s' не используется.", target, source)
+				continue
+			}
+			if date, ok := value.(time.Time); ok && isDateOnly(date) {
+				value = date.Format("2006-01-02") // Как в исходной заметке, без времени
+			}
+			if _, isList := value.([]interface{}); !isList && value != nil {
+				if _, ok := listValuedKeys[target]; ok {
+					value = []interface{}{value}
+				}
+			}
+			properties[target] = value
+			logf(DEBUG, "Свойство '%s' перенесено в '%s'.", source, target)
+		}
+	}
+}
+
+// frontMatterDefaults — свойства --front-matter-defaults, которые получает каждый пост.
+// Значение параметра — отображение YAML ("{author: Иван, showToc: true}"); при повторении
+// параметра отображения объединяются, в файле конфигурации его можно задать отображением.
+type frontMatterDefaults struct {
+	values map[string]interface{}
+}
+
+func (d *frontMatterDefaults) String() string {
+	if len(d.values) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(d.values)
+	return string(data)
+}
+
+func (d *frontMatterDefaults) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal([]byte(value), &values); err != nil {
+		return fmt.Errorf("ожидается отображение YAML: %w", err)
+	}
+	if d.values == nil {
+		d.values = make(map[string]interface{})
+	}
+	for key, v := range values {
+		d.values[key] = v
+	}
+	return nil
+}
+
+// Get возвращает свойства отображением, чтобы --dump-config выводил их как YAML.
+func (d *frontMatterDefaults) Get() interface{} {
+	return d.values
+}
+
+// apply добавляет в свойства заметки значения по умолчанию, которых в ней нет.
+// Каждая заметка получает собственную копию значений: списки и вложенные
+// отображения потом могут меняться при обработке.
+func (d *frontMatterDefaults) apply(properties map[string]interface{}) {
+	data, err := yaml.Marshal(d.values)
+	if err != nil {
+		return
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return
+	}
+	for key, value := range values {
+		if _, ok := properties[key]; !ok {
+			properties[key] = value
+			logf(DEBUG, "Свойство '%s' не найдено. Установлено значение по умолчанию.", key)
+		}
+	}
+}
+
+// mappingValue возвращает узел значения для ключа в узле-отображении или nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// buildFrontMatterNode собирает узел-отображение для итогового front matter.
+// Ключи из исходного узла идут в прежнем порядке вместе со своими комментариями;
+// значения, которые не менялись, переносятся как есть. Новые ключи добавляются в конец:
+// сначала подставленные инструментом title, date и type, затем остальные по алфавиту.
+func buildFrontMatterNode(properties map[string]interface{}, original *yaml.Node) (*yaml.Node, error) {
+	result := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	seen := make(map[string]struct{})
+
+	if original != nil {
+		for i := 0; i+1 < len(original.Content); i += 2 {
+			keyNode, valueNode := original.Content[i], original.Content[i+1]
+			value, ok := properties[keyNode.Value]
+			if !ok {
+				continue
+			}
+			seen[keyNode.Value] = struct{}{}
+
+			newValue, err := reuseOrEncode(valueNode, value)
+			if err != nil {
+				return nil, err
+			}
+			result.Content = append(result.Content, keyNode, newValue)
+		}
+	}
+
+	var newKeys []string
+	for key := range properties {
+		if _, ok := seen[key]; !ok {
+			newKeys = append(newKeys, key)
+		}
+	}
+	sort.Slice(newKeys, func(i, j int) bool {
+		ri, rj := injectedKeyRank(newKeys[i]), injectedKeyRank(newKeys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return newKeys[i] < newKeys[j]
+	})
+
+	for _, key := range newKeys {
+		valueNode, err := encodeNode(properties[key])
+		if err != nil {
+			return nil, err
+		}
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+		result.Content = append(result.Content, keyNode, valueNode)
+	}
+	return result, nil
+}
+
+// injectedKeyOrder — порядок, в котором в конец front matter добавляются
+// свойства, подставленные инструментом.
+var injectedKeyOrder = []string{"title", "date", "type"}
+
+// injectedKeyRank возвращает позицию ключа в injectedKeyOrder или len(injectedKeyOrder)
+// для остальных ключей.
+func injectedKeyRank(key string) int {
+	for i, k := range injectedKeyOrder {
+		if k == key {
+			return i
+		}
+	}
+	return len(injectedKeyOrder)
+}
+
+// reuseOrEncode возвращает исходный узел значения, если значение не изменилось
+// и не содержит якорей YAML, иначе кодирует новое значение. Комментарии исходного
+// узла и его стиль (например, список в квадратных скобках) переносятся на новый.
+func reuseOrEncode(original *yaml.Node, value interface{}) (*yaml.Node, error) {
+	var decoded interface{}
+	if err := original.Decode(&decoded); err == nil && reflect.DeepEqual(decoded, value) && !hasAliasNodes(original) {
+		return original, nil
+	}
+
+	node, err := encodeNode(value)
+	if err != nil {
+		return nil, err
+	}
+	if node.Kind == original.Kind {
+		node.Style = original.Style
+	}
+	node.HeadComment = original.HeadComment
+	node.LineComment = original.LineComment
+	node.FootComment = original.FootComment
+	return node, nil
+}
+
+// encodeNode кодирует значение в узел YAML.
+func encodeNode(value interface{}) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// marshalYAMLNode кодирует узел в YAML с отступом в два пробела, как записывает
+// свойства Obsidian, чтобы неизмененные списки и вложенные значения не меняли вид.
+func marshalYAMLNode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// reservedParamIssues проверяет свойства, имеющие особое значение для Hugo, и
+// возвращает описания подозрительных значений: например, url не строкой или
+// weight не целым числом. Такие свойства часто появляются от плагинов Obsidian.
+func reservedParamIssues(properties map[string]interface{}) []string {
+	var issues []string
+	for _, key := range []string{"url", "slug", "layout", "type", "linkTitle"} {
+		value, ok := properties[key]
+		if !ok {
+			continue
+		}
+		if str, isString := value.(string); !isString || strings.TrimSpace(str) == "" {
+			issues = append(issues, fmt.Sprintf("'%s' должно быть непустой строкой, а задано %v", key, value))
+		} else if key != "layout" && key != "linkTitle" && strings.ContainsAny(str, " \t") {
+			issues = append(issues, fmt.Sprintf("'%s' содержит пробелы: '%s'", key, str))
+		}
+	}
+	if url, ok := properties["url"].(string); ok && url != "" && !strings.HasPrefix(url, "/") && !strings.Contains(url, "://") {
+		issues = append(issues, fmt.Sprintf("'url' задает адрес страницы и обычно начинается с '/', а задано '%s'", url))
+	}
+	if value, ok := properties["weight"]; ok {
+		if _, isInt := value.(int); !isInt {
+			issues = append(issues, fmt.Sprintf("'weight' должно быть целым числом, а задано %v", value))
+		}
+	}
+	for _, key := range []string{"draft", "headless"} {
+		if value, ok := properties[key]; ok {
+			if _, isBool := value.(bool); !isBool {
+				issues = append(issues, fmt.Sprintf("'%s' должно быть true или false, а задано %v", key, value))
+			}
+		}
+	}
+	for _, key := range []string{"date", "publishDate", "lastmod", "expiryDate"} {
+		switch value := properties[key].(type) {
+		case nil, time.Time:
+		case string:
+			if _, ok := parseDate(value); !ok {
+				issues = append(issues, fmt.Sprintf("'%s' не похоже на дату: '%s'", key, value))
+			}
+		default:
+			issues = append(issues, fmt.Sprintf("'%s' не похоже на дату: %v", key, value))
+		}
+	}
+	// С другими режимами --aliases свойство уже преобразовано или удалено
+	if aliases := extractStringList(properties["aliases"]); *aliasesMode == "keep" && len(aliases) > 0 {
+		issues = append(issues, fmt.Sprintf("'aliases' в Hugo задает адреса перенаправлений, а не псевдонимы заметки: %v", aliases))
+	}
+	return issues
+}
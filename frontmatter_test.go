@@ -0,0 +1,346 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFinalNoteKeepsOrderAndComments(t *testing.T) {
+	fullContent := "---\n# Заметка\ntitle: Note\ntags: [blog, go] # теги\nauthor: me\n---\nText"
+	properties := map[string]interface{}{
+		"title":  "Note",
+		"tags":   []interface{}{"blog", "go"},
+		"author": "someone",
+		"date":   "2024-01-01",
+	}
+	got, err := writeFinalNote(properties, frontMatterNode(fullContent), "Text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "---\n# Заметка\ntitle: Note\ntags: [blog, go] # теги\nauthor: someone\ndate: \"2024-01-01\"\n---\n"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("writeFinalNote = %q, want prefix %q", got, want)
+	}
+}
+
+func TestApplyProtectedKeys(t *testing.T) {
+	saved := *protectKeys
+	*protectKeys = "weight, summary"
+	t.Cleanup(func() { *protectKeys = saved })
+
+	target := filepath.Join(t.TempDir(), "index.md")
+	if err := os.WriteFile(target, []byte("---\ntitle: Old\nweight: 5 # вручную\nsummary: Hand-written\n---\nText"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fullContent := "---\ntitle: New\nweight: 1\n---\nText"
+	properties := map[string]interface{}{"title": "New", "weight": 1}
+	original := applyProtectedKeys(properties, frontMatterNode(fullContent), target)
+	if properties["weight"] != 5 || properties["summary"] != "Hand-written" || properties["title"] != "New" {
+		t.Errorf("properties = %v, want protected keys from the generated file", properties)
+	}
+	got, err := writeFinalNote(properties, original, "Text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "---\ntitle: New\nweight: 5 # вручную\nsummary: Hand-written\n---\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("writeFinalNote = %q, want prefix %q", got, want)
+	}
+
+	// Если сгенерированного файла нет, исходный узел не меняется
+	node := frontMatterNode(fullContent)
+	if got := applyProtectedKeys(map[string]interface{}{}, node, filepath.Join(t.TempDir(), "missing.md")); got != node {
+		t.Error("applyProtectedKeys without a generated file changed the original node")
+	}
+}
+
+func TestGeneratedFrontMatterNodeJSON(t *testing.T) {
+	tests := []struct {
+		name, content string
+		wantKeys      int
+	}{
+		{"json", "{\n  \"title\": \"Note\",\n  \"weight\": 5\n}\n\nText {braces}", 2},
+		{"yaml", "---\ntitle: Note\n---\nText", 1},
+		{"broken json", "{\"title\": ", -1},
+		{"json array", "[1, 2]\nText", -1},
+	}
+	for _, tt := range tests {
+		node := generatedFrontMatterNode(tt.content)
+		switch {
+		case tt.wantKeys < 0 && node != nil:
+			t.Errorf("%s: generatedFrontMatterNode = %v, want nil", tt.name, node)
+		case tt.wantKeys >= 0 && (node == nil || len(node.Content) != 2*tt.wantKeys):
+			t.Errorf("%s: generatedFrontMatterNode = %v, want %d keys", tt.name, node, tt.wantKeys)
+		}
+	}
+}
+
+func TestMapAliases(t *testing.T) {
+	savedMode, savedPosts, savedURL, savedSlugify := *aliasesMode, *hugoPostsDir, *postsURL, *slugifyBundles
+	t.Cleanup(func() {
+		*aliasesMode, *hugoPostsDir, *postsURL, *slugifyBundles = savedMode, savedPosts, savedURL, savedSlugify
+	})
+	*hugoPostsDir, *postsURL = "/site/content/posts", ""
+
+	tests := []struct {
+		mode string
+		want map[string]interface{}
+	}{
+		{"drop", map[string]interface{}{}},
+		{"rename:obsidianAliases", map[string]interface{}{"obsidianAliases": []interface{}{"Old Name", "/legacy/"}}},
+		{"redirect", map[string]interface{}{"aliases": []string{"/posts/old-name/", "/legacy/"}}},
+	}
+	*slugifyBundles = false
+	for _, tt := range tests {
+		*aliasesMode = tt.mode
+		properties := map[string]interface{}{"aliases": []interface{}{"Old Name", "/legacy/"}}
+		mapAliases(properties)
+		if !reflect.DeepEqual(properties, tt.want) {
+			t.Errorf("--aliases=%s: properties = %v, want %v", tt.mode, properties, tt.want)
+		}
+	}
+
+	*aliasesMode, *slugifyBundles = "redirect", true
+	properties := map[string]interface{}{"aliases": []interface{}{"Старое имя"}}
+	mapAliases(properties)
+	if want := []string{"/posts/staroe-imya/"}; !reflect.DeepEqual(properties["aliases"], want) {
+		t.Errorf("--aliases=redirect with --slugify: aliases = %v, want %v", properties["aliases"], want)
+	}
+	properties = map[string]interface{}{"aliases": []interface{}{"!!!"}}
+	mapAliases(properties)
+	if want := []string{"/posts/" + slugify("!!!") + "/"}; !reflect.DeepEqual(properties["aliases"], want) {
+		t.Errorf("--aliases=redirect with an alias without letters: aliases = %v, want %v", properties["aliases"], want)
+	}
+}
+
+func TestMapKeys(t *testing.T) {
+	savedRename, savedCopy := renameKeyMap, copyKeyMap
+	t.Cleanup(func() { renameKeyMap, copyKeyMap = savedRename, savedCopy })
+	var err error
+	if renameKeyMap, err = parseKeyMapping("created=date, topic=categories, summary=description"); err != nil {
+		t.Fatal(err)
+	}
+	if copyKeyMap, err = parseKeyMapping("cover=images"); err != nil {
+		t.Fatal(err)
+	}
+
+	properties := map[string]interface{}{
+		"created":     time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		"topic":       "go",
+		"cover":       "cover.png",
+		"summary":     "From the note",
+		"description": "Already set",
+	}
+	mapKeys(properties)
+	want := map[string]interface{}{
+		"date":        "2024-03-15",
+		"categories":  []interface{}{"go"},
+		"cover":       "cover.png",
+		"images":      []interface{}{"cover.png"},
+		"description": "Already set",
+	}
+	if !reflect.DeepEqual(properties, want) {
+		t.Errorf("mapKeys = %v, want %v", properties, want)
+	}
+}
+
+func TestFilterKeys(t *testing.T) {
+	savedKeep, savedDrop := *keepKeys, *dropKeys
+	t.Cleanup(func() { *keepKeys, *dropKeys = savedKeep, savedDrop })
+
+	tests := []struct {
+		keep, drop string
+		want       []string
+	}{
+		{"", "cssclasses, dg-*", []string{"cover", "cover-alt", "draft", "title"}},
+		{"cover*", "", []string{"cover", "cover-alt", "draft", "title"}},
+		{"cover*, cssclasses", "cover-alt", []string{"cover", "cssclasses", "draft", "title"}},
+		{"summary", "title", []string{"draft"}},
+	}
+	for _, tt := range tests {
+		*keepKeys, *dropKeys = tt.keep, tt.drop
+		properties := map[string]interface{}{
+			"title":      "Note",
+			"draft":      false,
+			"cover":      "cover.png",
+			"cover-alt":  "Cover",
+			"cssclasses": "wide",
+			"dg-publish": true,
+		}
+		filterKeys(properties)
+		var got []string
+		for key := range properties {
+			got = append(got, key)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterKeys(keep=%q, drop=%q) = %v, want %v", tt.keep, tt.drop, got, tt.want)
+		}
+	}
+}
+
+func TestFrontMatterDefaults(t *testing.T) {
+	var defaults frontMatterDefaults
+	for _, value := range []string{"{author: Иван, tags: [blog]}", "{showToc: true}", ""} {
+		if err := defaults.Set(value); err != nil {
+			t.Fatalf("Set(%q): %v", value, err)
+		}
+	}
+	if err := defaults.Set("[not, a, mapping]"); err == nil {
+		t.Error("Set of a YAML list returned no error")
+	}
+
+	first := map[string]interface{}{"author": "Петр"}
+	defaults.apply(first)
+	want := map[string]interface{}{"author": "Петр", "showToc": true, "tags": []interface{}{"blog"}}
+	if !reflect.DeepEqual(first, want) {
+		t.Errorf("apply = %v, want %v", first, want)
+	}
+
+	// Изменение списка в одной заметке не должно попадать в другие
+	first["tags"] = append(first["tags"].([]interface{}), "go")
+	second := map[string]interface{}{}
+	defaults.apply(second)
+	if tags := second["tags"].([]interface{}); len(tags) != 1 {
+		t.Errorf("tags of the second note = %v, want [blog]", tags)
+	}
+}
+
+func TestParseKeyMappingErrors(t *testing.T) {
+	for _, list := range []string{"created", "=date", "created=", "created=date,topic"} {
+		if _, err := parseKeyMapping(list); err == nil {
+			t.Errorf("parseKeyMapping(%q) returned no error", list)
+		}
+	}
+}
+
+func TestReservedParamIssues(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		want       int
+	}{
+		{"valid", map[string]interface{}{"url": "/posts/note/", "slug": "note", "weight": 2, "draft": false, "date": "2024-01-01"}, 0},
+		{"url not a string", map[string]interface{}{"url": 5}, 1},
+		{"url without slash", map[string]interface{}{"url": "posts/note"}, 1},
+		{"slug with spaces", map[string]interface{}{"slug": "my note"}, 1},
+		{"layout with spaces", map[string]interface{}{"layout": "wide page"}, 0},
+		{"weight not an integer", map[string]interface{}{"weight": "2"}, 1},
+		{"draft as text", map[string]interface{}{"draft": "yes"}, 1},
+		{"bad date", map[string]interface{}{"date": "yesterday", "lastmod": 5}, 2},
+		{"aliases", map[string]interface{}{"aliases": []interface{}{"Other name"}}, 1},
+	}
+	for _, tt := range tests {
+		if got := reservedParamIssues(tt.properties); len(got) != tt.want {
+			t.Errorf("%s: reservedParamIssues = %q, want %d issues", tt.name, got, tt.want)
+		}
+	}
+}
+
+// roundTrip пропускает заметку через разбор и запись front matter без других преобразований.
+func roundTrip(t *testing.T, note string, edit func(properties map[string]interface{})) string {
+	t.Helper()
+	properties, body, err := parseNoteContent(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		edit(properties)
+	}
+	out, err := writeFinalNote(properties, frontMatterNode(note), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFrontMatterRoundTripIsByteStable(t *testing.T) {
+	tests := []struct {
+		name, note string
+	}{
+		{"key order", "---\ntitle: Заметка\ndate: 2024-01-02\ndraft: false\ntags:\n  - go\n  - hugo\n---\n\nТекст"},
+		{"comments and styles", "---\n# Заголовок\ntitle: \"Заметка: часть 1\" # в кавычках\ntags: [go, hugo]\ncover:\n  image: pic.png\n  alt: Картинка\n---\n\nТекст"},
+		{"timestamps and numbers", "---\ntitle: Заметка\ndate: 2024-01-02T10:30:00+03:00\nweight: 10\nratio: 0.5\n---\n\nТекст"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once := roundTrip(t, tt.note, nil)
+			if once != tt.note {
+				t.Errorf("round trip changed the note:\n got: %q\nwant: %q", once, tt.note)
+			}
+			if twice := roundTrip(t, once, nil); twice != once {
+				t.Errorf("second round trip changed the note:\n got: %q\nwant: %q", twice, once)
+			}
+		})
+	}
+}
+
+func TestFrontMatterKeepsKeyOrder(t *testing.T) {
+	note := "---\ndraft: true\ntags:\n  - go\n  - publish\nauthor: Я\n---\n\nТекст"
+	got := roundTrip(t, note, func(properties map[string]interface{}) {
+		properties["tags"] = []interface{}{"go"}
+		properties["zeta"] = 1
+		properties["type"] = "post"
+		properties["date"] = "2024-01-02"
+		properties["title"] = "Заметка"
+	})
+	want := "---\ndraft: true\ntags:\n  - go\nauthor: Я\ntitle: Заметка\ndate: \"2024-01-02\"\ntype: post\nzeta: 1\n---\n\nТекст"
+	if got != want {
+		t.Errorf("front matter:\n got: %q\nwant: %q", got, want)
+	}
+	if !strings.HasPrefix(roundTrip(t, got, nil), "---\ndraft: true\ntags:") {
+		t.Errorf("key order changed on the second pass")
+	}
+}
+
+func TestReservedParamIssuesAliases(t *testing.T) {
+	saved := *aliasesMode
+	t.Cleanup(func() { *aliasesMode = saved })
+
+	tests := []struct {
+		mode  string
+		warns bool
+	}{
+		{"keep", true},
+		{"redirect", false},
+	}
+	for _, tt := range tests {
+		*aliasesMode = tt.mode
+		properties := map[string]interface{}{"aliases": []interface{}{"Other Name"}}
+		if tt.mode != "keep" {
+			mapAliases(properties)
+		}
+		issues := reservedParamIssues(properties)
+		if warns := len(issues) > 0; warns != tt.warns {
+			t.Errorf("--aliases=%s: reservedParamIssues = %v, want warning %t", tt.mode, issues, tt.warns)
+		}
+	}
+}
+
+func TestGeneratedProperty(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, content, want string
+		ok                  bool
+	}{
+		{"yaml", "---\ntitle: Note\ndate: 2024-01-02T10:00:00Z\n---\n\nText", "2024-01-02T10:00:00Z", true},
+		{"toml", "+++\ntitle = \"Note\"\ndate = \"2024-01-02T10:00:00Z\"\n+++\n\nText", "2024-01-02T10:00:00Z", true},
+		{"toml table", "+++\ntitle = \"Note\"\n[params]\ndate = \"2024-01-02\"\n+++\n", "", false},
+		{"toml similar key", "+++\ndates = \"2024-01-02\"\n+++\n", "", false},
+		{"json", "{\n  \"date\": \"2024-01-02\"\n}\n\nText", "2024-01-02", true},
+		{"missing", "---\ntitle: Note\n---\n", "", false},
+	}
+	for _, tt := range tests {
+		target := filepath.Join(dir, tt.name+".md")
+		if err := os.WriteFile(target, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := generatedProperty(target, "date"); got != tt.want || ok != tt.ok {
+			t.Errorf("%s: generatedProperty = (%q, %t), want (%q, %t)", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPath — файл, который создает init, если --config не указан.
+const defaultConfigPath = "obsidian2hugo.yaml"
+
+// hugoConfigFiles — имена файлов конфигурации, по которым распознается сайт Hugo.
+var hugoConfigFiles = []string{"hugo.toml", "hugo.yaml", "hugo.json", "config.toml", "config.yaml", "config.json"}
+
+// runInit выполняет подкоманду init: спрашивает пути к хранилищу, вложениям и
+// каталогу постов Hugo и записывает файл конфигурации. Предлагаемые ответы
+// определяются по каталогу .obsidian и файлу конфигурации Hugo; параметры,
+// указанные в командной строке, используются как ответы по умолчанию.
+func runInit() int {
+	path := *configPath
+	if path == "" {
+		path = defaultConfigPath
+	}
+	in := bufio.NewReader(os.Stdin)
+
+	if _, err := os.Stat(path); err == nil {
+		if !confirm(in, fmt.Sprintf("Файл %s уже существует. Перезаписать?", path)) {
+			return exitOK
+		}
+	}
+
+	vault := *notesDir
+	if vault == "" {
+		vault = findUp(".", func(dir string) bool { return isDir(filepath.Join(dir, ".obsidian")) })
+	}
+	vault = ask(in, "Каталог хранилища Obsidian", vault)
+
+	attachments := strings.Join(attachmentsDirs, ", ")
+	if attachments == "" && vault != "" {
+		attachments = obsidianAttachmentFolder(vault)
+	}
+	attachments = ask(in, "Каталоги вложений (через запятую)", attachments)
+
+	posts := *hugoPostsDir
+	if posts == "" {
+		if site := findUp(".", isHugoSite); site != "" {
+			posts = filepath.Join(site, "content", "posts")
+		}
+	}
+	posts = ask(in, "Каталог постов Hugo", posts)
+
+	tag := ask(in, "Теги для публикации (через запятую)", filterTags.String())
+
+	if vault == "" || posts == "" {
+		logf(ERROR, "Ошибка: Пути к хранилищу и каталогу постов обязательны.")
+		return exitFatal
+	}
+	if attachments == "" && !isDir(filepath.Join(vault, ".obsidian")) {
+		logf(ERROR, "Ошибка: Путь к вложениям обязателен, если в каталоге хранилища нет .obsidian.")
+		return exitFatal
+	}
+
+	config := map[string]interface{}{
+		"notes-dir":      vault,
+		"hugo-posts-dir": posts,
+		"filter-tag":     tag,
+	}
+	// Без --attachments-dir вложения ищутся по настройкам хранилища
+	if dirs := splitList(attachments); len(dirs) == 1 {
+		config["attachments-dir"] = dirs[0]
+	} else if len(dirs) > 1 {
+		config["attachments-dir"] = dirs
+	}
+	if err := writeConfigFile(path, config); err != nil {
+		logf(ERROR, "Не удалось записать конфигурацию %s: %v", path, err)
+		return exitFatal
+	}
+	logf(INFO, "Конфигурация сохранена в %s. Запуск: %s --config %s", path, os.Args[0], path)
+	return exitOK
+}
+
+// ask задает вопрос и возвращает ответ или def, если ответ пустой.
+func ask(in *bufio.Reader, question, def string) string {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
+	}
+	answer, _ := in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// confirm задает вопрос да/нет. Пустой ответ означает «нет».
+func confirm(in *bufio.Reader, question string) bool {
+	answer := strings.ToLower(ask(in, question+" (y/N)", ""))
+	return answer == "y" || answer == "yes" || answer == "д" || answer == "да"
+}
+
+// findUp ищет каталог, удовлетворяющий match, начиная с dir и поднимаясь к корню.
+// Возвращает пустую строку, если такого каталога нет.
+func findUp(dir string, match func(string) bool) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if match(dir) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// isHugoSite проверяет, лежит ли в каталоге файл конфигурации Hugo.
+func isHugoSite(dir string) bool {
+	for _, name := range hugoConfigFiles {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return isDir(filepath.Join(dir, "config", "_default"))
+}
+
+// isDir проверяет, что путь существует и является каталогом.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// obsidianAttachmentFolder возвращает каталог вложений из настроек хранилища
+// (.obsidian/app.json, attachmentFolderPath) или пустую строку, если вложения
+// хранятся в корне хранилища или рядом с заметками.
+func obsidianAttachmentFolder(vault string) string {
+	folder := readAttachmentFolderSetting(vault)
+	if folder == "/" || strings.HasPrefix(folder, ".") {
+		return ""
+	}
+	return filepath.Join(vault, strings.TrimPrefix(folder, "/"))
+}
+
+// writeConfigFile записывает конфигурацию в формате YAML или JSON (по расширению .json).
+func writeConfigFile(path string, config map[string]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return encodeConfig(file, path, config)
+}
+
+// encodeConfig кодирует конфигурацию в w; формат выбирается по расширению path.
+func encodeConfig(w io.Writer, path string, config map[string]interface{}) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
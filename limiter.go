@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// memoryLimiter ограничивает суммарный размер заметок, одновременно загруженных в память.
+// Заметка, которая больше всего лимита, все равно загружается, но только в одиночку.
+type memoryLimiter struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	inUse int64
+}
+
+// noteMemory — общий ограничитель памяти для чтения заметок (--max-memory).
+var noteMemory *memoryLimiter
+
+// newMemoryLimiter создает ограничитель на limit байт. При limit <= 0 ограничения нет.
+func newMemoryLimiter(limit int64) *memoryLimiter {
+	l := &memoryLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire резервирует n байт, ожидая, пока другие заметки освободят память.
+func (l *memoryLimiter) acquire(n int64) {
+	if l == nil || l.limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.inUse > 0 && l.inUse+n > l.limit {
+		l.cond.Wait()
+	}
+	l.inUse += n
+}
+
+// release освобождает n байт, зарезервированных через acquire.
+func (l *memoryLimiter) release(n int64) {
+	if l == nil || l.limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	l.inUse -= n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// readNote читает заметку, учитывая ее размер в ограничителе памяти.
+// Возвращенную функцию нужно вызвать, когда содержимое заметки больше не нужно.
+func readNote(path string) ([]byte, func(), error) {
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	noteMemory.acquire(size)
+	release := func() { noteMemory.release(size) }
+
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		release()
+		return nil, func() {}, err
+	}
+	return contentBytes, release, nil
+}
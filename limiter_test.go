@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := newMemoryLimiter(100)
+	limiter.acquire(60)
+
+	acquired := make(chan struct{})
+	go func() {
+		limiter.acquire(60)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquire did not wait for the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.release(60)
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire still waits after release")
+	}
+	limiter.release(60)
+
+	// Заметка больше всего лимита загружается, если память свободна
+	limiter.acquire(500)
+	limiter.release(500)
+}
+
+func TestMemoryLimiterDisabled(t *testing.T) {
+	for _, limiter := range []*memoryLimiter{nil, newMemoryLimiter(0)} {
+		limiter.acquire(1 << 40)
+		limiter.acquire(1 << 40)
+		limiter.release(1 << 40)
+		limiter.release(1 << 40)
+	}
+}
+
+func TestReadNoteReleasesMemory(t *testing.T) {
+	saved := noteMemory
+	noteMemory = newMemoryLimiter(10)
+	t.Cleanup(func() { noteMemory = saved })
+
+	path := filepath.Join(t.TempDir(), "Note.md")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		content, release, err := readNote(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "0123456789" {
+			t.Errorf("readNote = %q", content)
+		}
+		release()
+	}
+	if _, release, err := readNote(filepath.Join(filepath.Dir(path), "Missing.md")); err == nil {
+		t.Error("readNote of a missing note returned no error")
+	} else {
+		release()
+	}
+	if noteMemory.inUse != 0 {
+		t.Errorf("inUse = %d after all notes were released, want 0", noteMemory.inUse)
+	}
+}
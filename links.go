@@ -0,0 +1,502 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// publishedNote описывает заметку, прошедшую фильтр, для разрешения вики-ссылок.
+type publishedNote struct {
+	path    string              // путь к исходной заметке
+	bundle  string              // имя каталога Page Bundle
+	anchors map[string]struct{} // якоря заголовков заметки в формате Hugo
+	blocks  map[string]struct{} // идентификаторы блоков (^id) в нижнем регистре
+}
+
+// noteIndex отображает имя заметки (в нижнем регистре, без .md) на опубликованную заметку.
+var noteIndex = make(map[string]*publishedNote)
+
+// aliasIndex отображает псевдоним заметки (свойство 'aliases', в нижнем регистре)
+// на ключ опубликованной заметки в noteIndex.
+var aliasIndex = make(map[string]string)
+
+// bundleOwners отображает имя каталога поста (в нижнем регистре) на путь
+// к заметке, которой этот каталог достался.
+var bundleOwners = make(map[string]string)
+
+// collidedNotes — пути к заметкам, которые не публикуются, потому что их каталог
+// поста уже занят другой заметкой.
+var collidedNotes = make(map[string]struct{})
+
+// vaultNotes отображает ключ заметки на сведения о ней для всех найденных заметок,
+// в том числе неопубликованных: их текст можно встраивать в опубликованные (![[Заметка]]).
+var vaultNotes = make(map[string]*scannedNote)
+
+// followedNotes — пути к заметкам без тега фильтрации, которые публикуются,
+// потому что на них ссылаются опубликованные заметки (--follow-links).
+var followedNotes = make(map[string]struct{})
+
+// unindexedNotes — пути к заметкам, которые не удалось прочитать или разобрать при
+// индексации. Их посты не считаются устаревшими (--clean).
+var unindexedNotes = make(map[string]struct{})
+
+// resetNoteIndex очищает индекс перед повторной индексацией заметок (--watch).
+func resetNoteIndex() {
+	noteIndex = make(map[string]*publishedNote)
+	aliasIndex = make(map[string]string)
+	bundleOwners = make(map[string]string)
+	collidedNotes = make(map[string]struct{})
+	followedNotes = make(map[string]struct{})
+	vaultNotes = make(map[string]*scannedNote)
+	unindexedNotes = make(map[string]struct{})
+}
+
+// Регулярные выражения для заголовков и блоков кода
+var (
+	// Паттерн для поиска ATX-заголовков Markdown (# Заголовок).
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	// Паттерн для поиска границ блоков кода (``` или ~~~).
+	codeFencePattern = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// scannedNote — сведения о заметке, собранные при индексации.
+type scannedNote struct {
+	path    string
+	links   []string // ключи заметок, на которые ведут вики-ссылки
+	aliases []string // псевдонимы из свойства 'aliases'
+	anchors map[string]struct{}
+	blocks  map[string]struct{}
+	embeds  []string     // цели встраиваний ![[...]] и ссылок на файлы вложений по порядку
+	naming  bundleNaming // свойства, от которых зависит имя каталога поста
+	hidden  bool         // публикация запрещена свойством --publish-override-key
+}
+
+// buildNoteIndex читает заметки и запоминает те, что проходят фильтр по тегу,
+// вместе с якорями их заголовков. С --follow-links неопубликованные заметки,
+// на которые ссылаются опубликованные, тоже публикуются.
+func buildNoteIndex(notePaths []string) {
+	scanned := make(map[string]*scannedNote)
+	var queue []string
+	for _, path := range notePaths {
+		contentBytes, release, err := readNote(path)
+		if err != nil {
+			logf(WARNING, "Не удалось прочитать заметку %s при индексации: %v", path, err)
+			unindexedNotes[path] = struct{}{}
+			continue
+		}
+
+		properties, content, err := parseNoteContent(string(contentBytes))
+		if err != nil {
+			// Ошибку разбора сообщит второй проход
+			release()
+			unindexedNotes[path] = struct{}{}
+			continue
+		}
+		// Ссылки из комментариев не должны публиковать заметки (--follow-links)
+		content = removeComments(content)
+
+		key := noteKey(noteName(path))
+		note := &scannedNote{
+			path:    path,
+			links:   linkedNotes(content),
+			aliases: extractStringList(properties["aliases"]),
+			anchors: collectHeadingAnchors(content),
+			blocks:  collectBlockIDs(content),
+			embeds:  embedTargets(content, filepath.Dir(path)),
+		}
+		note.naming = bundleNamingOf(properties)
+		release()
+		if _, duplicate := scanned[key]; !duplicate {
+			scanned[key] = note
+		}
+		publish, overridden := publishOverride(properties)
+		tags := noteTags(properties, content)
+		// Пропускаемые черновики, как и заметки с запретом публикации, не публикуются по ссылкам
+		note.hidden = overridden && !publish || *draftMode == "skip" && isDraft(properties, tags)
+		_, selected := selectNote(properties, tags)
+		if !note.hidden && (overridden && publish || !overridden && (*noFilter || selected)) {
+			if claimBundle(note) {
+				addToIndex(key, note)
+				queue = append(queue, key)
+			}
+		}
+	}
+
+	scannedAliases := indexAliases(scanned, false)
+
+	// Обходим граф ссылок, начиная с опубликованных заметок.
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		for _, target := range scanned[key].links {
+			if _, ok := scanned[target]; !ok {
+				target = scannedAliases[target]
+			}
+			if _, ok := noteIndex[target]; ok {
+				continue
+			}
+			note, ok := scanned[target]
+			if !ok {
+				continue
+			}
+			if *followLinks && !note.hidden && claimBundle(note) {
+				logf(INFO, "Заметка '%s' будет опубликована, так как на нее ссылается '%s'.", noteName(note.path), noteName(scanned[key].path))
+				followedNotes[note.path] = struct{}{}
+				addToIndex(target, note)
+				queue = append(queue, target)
+			}
+			// Об остальных ссылках на неопубликованные заметки сообщит renderWikilink
+		}
+	}
+
+	vaultNotes = scanned
+
+	published := make(map[string]*scannedNote)
+	for key := range noteIndex {
+		published[key] = scanned[key]
+	}
+	for alias, key := range indexAliases(published, true) {
+		aliasIndex[alias] = key
+	}
+	logf(DEBUG, "Проиндексировано публикуемых заметок: %d", len(noteIndex))
+
+	if *layout == "flat" {
+		claimFlatAttachmentNames()
+	}
+}
+
+// embedTargets возвращает цели встраиваний ![[...]] (вложений и заметок) и ссылок
+// на файлы вложений в тексте заметки из каталога noteDir в порядке их появления.
+func embedTargets(content, noteDir string) []string {
+	var targets []string
+	for _, match := range attachmentPattern.FindAllStringSubmatch(content, -1) {
+		filename, _ := parseEmbed(match[1])
+		targets = append(targets, filename)
+	}
+	for _, link := range attachmentLinks(content, noteDir) {
+		targets = append(targets, link.filename)
+	}
+	return targets
+}
+
+// indexAliases строит отображение псевдонимов на ключи заметок. Имена заметок
+// имеют приоритет над псевдонимами, а при совпадении псевдонимов у нескольких
+// заметок выигрывает та, чей путь идет раньше по алфавиту. С warn о конфликтах
+// выводятся предупреждения.
+func indexAliases(notes map[string]*scannedNote, warn bool) map[string]string {
+	keys := make([]string, 0, len(notes))
+	for key := range notes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return notes[keys[i]].path < notes[keys[j]].path })
+
+	aliases := make(map[string]string)
+	for _, key := range keys {
+		for _, alias := range notes[key].aliases {
+			aliasKey := strings.ToLower(strings.TrimSpace(alias))
+			if aliasKey == "" || aliasKey == key {
+				continue
+			}
+			if _, ok := notes[aliasKey]; ok {
+				if warn {
+					logf(WARNING, "Псевдоним '%s' заметки '%s' совпадает с именем другой заметки и будет проигнорирован.", alias, noteName(notes[key].path))
+				}
+				continue
+			}
+			if other, ok := aliases[aliasKey]; ok {
+				if warn && other != key {
+					reportError(&CollisionError{Path: notes[key].path, OtherPath: notes[other].path, Name: alias})
+				}
+				continue
+			}
+			aliases[aliasKey] = key
+		}
+	}
+	return aliases
+}
+
+// claimBundle закрепляет каталог поста за заметкой. Если каталог (без учета регистра)
+// уже достался другой заметке, сообщается о конфликте и заметка не публикуется.
+func claimBundle(note *scannedNote) bool {
+	bundle := bundleName(note.path, note.naming)
+	owner, taken := bundleOwners[strings.ToLower(bundle)]
+	if taken && owner != note.path {
+		reportError(&CollisionError{Path: note.path, OtherPath: owner, Name: bundle})
+		collidedNotes[note.path] = struct{}{}
+		return false
+	}
+	bundleOwners[strings.ToLower(bundle)] = note.path
+	return true
+}
+
+// addToIndex добавляет заметку в индекс опубликованных.
+func addToIndex(key string, note *scannedNote) {
+	noteIndex[key] = &publishedNote{
+		path:    note.path,
+		bundle:  bundleName(note.path, note.naming),
+		anchors: note.anchors,
+		blocks:  note.blocks,
+	}
+}
+
+// noteKey возвращает ключ индекса для цели вики-ссылки: имя файла
+// без каталогов и расширения .md в нижнем регистре.
+func noteKey(target string) string {
+	target = target[strings.LastIndex(target, "/")+1:]
+	return strings.ToLower(strings.TrimSuffix(target, ".md"))
+}
+
+// linkedNotes возвращает ключи заметок, на которые ведут вики-ссылки в тексте вне кода.
+func linkedNotes(content string) []string {
+	var keys []string
+	transformOutsideCode(content, func(text string) string {
+		for _, loc := range wikilinkPattern.FindAllStringSubmatchIndex(text, -1) {
+			if loc[0] > 0 && text[loc[0]-1] == '!' {
+				continue
+			}
+			if target, _, _ := parseWikilink(text[loc[2]:loc[3]]); target != "" {
+				keys = append(keys, noteKey(target))
+			}
+		}
+		return text
+	})
+	return keys
+}
+
+// collectHeadingAnchors возвращает якоря всех заголовков заметки.
+// Повторяющиеся якоря получают суффиксы -1, -2 и т.д., как это делает Hugo.
+func collectHeadingAnchors(content string) map[string]struct{} {
+	anchors := make(map[string]struct{})
+	inCode := false
+	for _, line := range strings.Split(content, "\n") {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		match := headingPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		// Идентификатор блока в заголовке (## Заголовок ^id) в якорь не входит
+		anchor := headingAnchor(blockIDPattern.ReplaceAllString(match[2], ""))
+		unique := anchor
+		for i := 1; ; i++ {
+			if _, exists := anchors[unique]; !exists {
+				break
+			}
+			unique = fmt.Sprintf("%s-%d", anchor, i)
+		}
+		anchors[unique] = struct{}{}
+	}
+	return anchors
+}
+
+// collectBlockIDs возвращает идентификаторы блоков (^id) заметки вне блоков кода.
+func collectBlockIDs(content string) map[string]struct{} {
+	blocks := make(map[string]struct{})
+	transformOutsideCode(content, func(text string) string {
+		for _, match := range blockIDPattern.FindAllStringSubmatch(text, -1) {
+			blocks[strings.ToLower(match[2])] = struct{}{}
+		}
+		return text
+	})
+	return blocks
+}
+
+// headingAnchor преобразует текст заголовка в якорь так же, как Hugo
+// (autoHeadingIDType "github"): нижний регистр, пробелы заменяются дефисами,
+// знаки препинания удаляются.
+func headingAnchor(heading string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			sb.WriteRune(r)
+		case unicode.IsSpace(r):
+			sb.WriteRune('-')
+		}
+	}
+	return sb.String()
+}
+
+// parseWikilink разбирает содержимое вики-ссылки вида Заметка#Заголовок|Текст
+// на цель, заголовок и отображаемый текст. Отображаемым текстом становится только
+// правая часть, а заголовок в него не попадает. Экранированная черта \| считается
+// обычным символом, а не разделителем.
+func parseWikilink(inner string) (target, heading, alias string) {
+	target = inner
+	if i := unescapedPipe(target); i >= 0 {
+		target, alias = target[:i], strings.TrimSpace(unescapePipes(target[i+1:]))
+	}
+	target = unescapePipes(target)
+	if i := strings.Index(target, "#"); i >= 0 {
+		target, heading = target[:i], target[i+1:]
+		// Цепочка [[Заметка#Раздел#Подраздел]] ведет на последний заголовок
+		heading = strings.TrimSpace(heading[strings.LastIndex(heading, "#")+1:])
+	}
+	return strings.TrimSpace(target), heading, alias
+}
+
+// unescapedPipe возвращает позицию первой неэкранированной черты | или -1.
+func unescapedPipe(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '|' && (i == 0 || s[i-1] != '\\') {
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapePipes заменяет экранированные черты \| на обычные.
+func unescapePipes(s string) string {
+	return strings.ReplaceAll(s, "\\|", "|")
+}
+
+// inTableRow проверяет, находится ли позиция pos в строке таблицы Markdown.
+func inTableRow(content string, pos int) bool {
+	lineStart := strings.LastIndex(content[:pos], "\n") + 1
+	return strings.HasPrefix(strings.TrimSpace(content[lineStart:pos]), "|")
+}
+
+// rewriteWikilinks заменяет вики-ссылки на опубликованные заметки ссылками Hugo,
+// а остальные вики-ссылки — их отображаемым текстом. Встраивания ![[...]] и код
+// не затрагиваются: Hugo выполняет шорткоды relref и внутри блоков кода.
+// currentPath — путь к заметке, в которой стоят ссылки.
+func rewriteWikilinks(content, currentPath string) string {
+	return transformOutsideCode(content, func(text string) string {
+		return rewriteWikilinksInText(text, currentPath)
+	})
+}
+
+// rewriteWikilinksInText заменяет вики-ссылки во фрагменте текста вне кода.
+func rewriteWikilinksInText(content, currentPath string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range wikilinkPattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 && content[start-1] == '!' {
+			continue
+		}
+		sb.WriteString(content[last:start])
+		link := renderWikilink(content[loc[2]:loc[3]], currentPath)
+		if inTableRow(content, start) {
+			// Черта в ячейке таблицы должна оставаться экранированной
+			link = strings.ReplaceAll(unescapePipes(link), "|", "\\|")
+		}
+		sb.WriteString(link)
+		last = end
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// renderWikilink возвращает замену для одной вики-ссылки.
+func renderWikilink(inner, currentPath string) string {
+	target, heading, alias := parseWikilink(inner)
+
+	lookup := target
+	if lookup == "" {
+		// Ссылка на заголовок в текущей заметке: [[#Заголовок]]
+		lookup = noteName(currentPath)
+	}
+
+	note, ok := noteIndex[noteKey(lookup)]
+	if !ok {
+		// Ссылка может вести на псевдоним заметки
+		note, ok = noteIndex[aliasIndex[strings.ToLower(lookup)]]
+	}
+
+	text := alias
+	if text == "" {
+		text = target
+		if text == "" {
+			text = heading
+		}
+	}
+
+	if !ok {
+		reportError(&LinkError{Path: currentPath, Target: lookup, Reason: "заметка не найдена или не опубликована"})
+		return unresolvedLink(inner, text)
+	}
+
+	anchor := ""
+	if id, isBlock := strings.CutPrefix(heading, "^"); isBlock {
+		// Ссылка на блок: [[Заметка#^id]]
+		if _, exists := note.blocks[strings.ToLower(id)]; !exists {
+			reportError(&LinkError{Path: currentPath, Target: inner, Reason: fmt.Sprintf("блок '^%s' не найден в заметке '%s', ссылка будет вести на начало заметки", id, noteName(note.path))})
+		} else if *blockAnchors {
+			anchor = blockAnchorID(id)
+		}
+		if alias == "" && target == "" {
+			text = noteName(note.path)
+		}
+	} else if heading != "" {
+		anchor = headingAnchor(heading)
+		if _, exists := note.anchors[anchor]; !exists {
+			reportError(&LinkError{Path: currentPath, Target: inner, Reason: fmt.Sprintf("заголовок '%s' не найден в заметке '%s', ссылка будет вести на начало заметки", heading, noteName(note.path))})
+			anchor = ""
+		}
+	}
+
+	if target == "" && anchor != "" {
+		return fmt.Sprintf("[%s](#%s)", text, anchor)
+	}
+	return fmt.Sprintf("[%s](%s)", text, noteURL(note, anchor))
+}
+
+// unresolvedLink возвращает замену для вики-ссылки, заметка которой не найдена,
+// согласно --unresolved-link-style: текст ссылки, исходная ссылка [[...]] или
+// текст в <span> с классом --unresolved-link-class.
+func unresolvedLink(inner, text string) string {
+	switch *unresolvedStyle {
+	case "keep":
+		return "[[" + inner + "]]"
+	case "marker":
+		return fmt.Sprintf(`<span class="%s">%s</span>`, html.EscapeString(*unresolvedClass), html.EscapeString(text))
+	default:
+		return text
+	}
+}
+
+// noteURL возвращает адрес опубликованной заметки с учетом раскладки постов и
+// --link-style: шорткод relref для Page Bundle, адрес страницы в разделе постов для
+// flat или относительный путь к соседней странице.
+func noteURL(note *publishedNote, anchor string) string {
+	if anchor != "" {
+		anchor = "#" + anchor
+	}
+	page := pagePath(note.bundle)
+	if *linkStyle == "relative" {
+		if *layout == "flat" && *uglyURLs {
+			return page + ".html" + anchor
+		}
+		return "../" + page + "/" + anchor
+	}
+	if *layout == "flat" {
+		if *uglyURLs {
+			return sectionURL() + page + ".html" + anchor
+		}
+		return sectionURL() + page + "/" + anchor
+	}
+	if strings.Contains(note.bundle, `"`) {
+		// Имя с кавычкой передается шорткоду строкой в обратных кавычках
+		return fmt.Sprintf("{{< relref `%s` >}}", note.bundle+anchor)
+	}
+	return fmt.Sprintf(`{{< relref "%s" >}}`, note.bundle+anchor)
+}
+
+// pagePath возвращает часть адреса страницы для каталога или файла поста так, как
+// ее строит Hugo по умолчанию: в нижнем регистре и с дефисами вместо пробелов.
+// Пробелов в адресе не остается, поэтому его можно подставить в ссылку Markdown.
+func pagePath(bundle string) string {
+	return strings.ToLower(strings.Join(strings.Fields(bundle), "-"))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBuildNoteIndexFollowLinks(t *testing.T) {
+	vault := t.TempDir()
+	notes := map[string]string{
+		"Post":   "---\ntags: [blog]\n---\nSee [[Draft]].",
+		"Draft":  "---\ntags: [notes]\n---\nSee [[Deeper|more]].",
+		"Deeper": "Text.",
+		"Other":  "---\ntags: [notes]\n---\nUnlinked.",
+	}
+	var paths []string
+	for name, content := range notes {
+		path := filepath.Join(vault, name+".md")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	savedIndex, savedFollowed, savedFollow := noteIndex, followedNotes, *followLinks
+	t.Cleanup(func() { noteIndex, followedNotes, *followLinks = savedIndex, savedFollowed, savedFollow })
+
+	tests := []struct {
+		follow bool
+		want   []string
+	}{
+		{false, []string{"post"}},
+		{true, []string{"post", "draft", "deeper"}},
+	}
+	for _, tt := range tests {
+		noteIndex, followedNotes, *followLinks = make(map[string]*publishedNote), make(map[string]struct{}), tt.follow
+		buildNoteIndex(paths)
+		if len(noteIndex) != len(tt.want) {
+			t.Errorf("--follow-links=%t: %d notes published, want %v", tt.follow, len(noteIndex), tt.want)
+		}
+		for _, key := range tt.want {
+			if _, ok := noteIndex[key]; !ok {
+				t.Errorf("--follow-links=%t: note %q is not published", tt.follow, key)
+			}
+		}
+		if want := len(tt.want) - 1; len(followedNotes) != want {
+			t.Errorf("--follow-links=%t: %d followed notes, want %d", tt.follow, len(followedNotes), want)
+		}
+	}
+}
+
+func TestBuildNoteIndexSkipsDrafts(t *testing.T) {
+	vault := t.TempDir()
+	notes := map[string]string{
+		"Post": "---\ntags: [blog]\n---\nSee [[Wip]] and [[Idea]].",
+		"Wip":  "---\ntags: [blog]\ndraft: true\n---\nText.",
+		"Idea": "---\ntags: [notes, draft]\n---\nText.",
+	}
+	var paths []string
+	for name, content := range notes {
+		path := filepath.Join(vault, name+".md")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	savedFollow, savedDrafts := *followLinks, *draftMode
+	t.Cleanup(func() {
+		*followLinks, *draftMode = savedFollow, savedDrafts
+		resetNoteIndex()
+	})
+	*followLinks = true
+
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"keep", []string{"idea", "post", "wip"}},
+		{"skip", []string{"post"}},
+	}
+	for _, tt := range tests {
+		*draftMode = tt.mode
+		resetNoteIndex()
+		buildNoteIndex(paths)
+		var got []string
+		for key := range noteIndex {
+			got = append(got, key)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("--drafts=%s: published %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+// withPublishedNotes подменяет индекс опубликованных заметок на время теста.
+func withPublishedNotes(t *testing.T, notes ...*publishedNote) {
+	t.Helper()
+	saved := noteIndex
+	noteIndex = make(map[string]*publishedNote)
+	t.Cleanup(func() { noteIndex = saved })
+	for _, note := range notes {
+		noteIndex[noteKey(noteName(note.path))] = note
+	}
+}
+
+func TestParseWikilink(t *testing.T) {
+	tests := []struct {
+		inner, target, heading, alias string
+	}{
+		{"Target", "Target", "", ""},
+		{"My Note|click here", "My Note", "", "click here"},
+		{"My Note#Some Heading", "My Note", "Some Heading", ""},
+		{"My Note#Some Heading|Display text", "My Note", "Some Heading", "Display text"},
+		{" My Note | display text with spaces ", "My Note", "", "display text with spaces"},
+		{"#Local Heading", "", "Local Heading", ""},
+		{"Note#Section#Subsection", "Note", "Subsection", ""},
+		{"Note|alias|with pipe", "Note", "", "alias|with pipe"},
+	}
+	for _, tt := range tests {
+		target, heading, alias := parseWikilink(tt.inner)
+		if target != tt.target || heading != tt.heading || alias != tt.alias {
+			t.Errorf("parseWikilink(%q) = (%q, %q, %q), want (%q, %q, %q)",
+				tt.inner, target, heading, alias, tt.target, tt.heading, tt.alias)
+		}
+	}
+}
+
+func TestRewriteWikilinks(t *testing.T) {
+	withPublishedNotes(t, &publishedNote{
+		path:    "/vault/My Note.md",
+		bundle:  "My Note",
+		anchors: map[string]struct{}{"some-heading": {}},
+	})
+	tests := []struct {
+		name, content, want string
+	}{
+		{"plain", "[[My Note]]", `[My Note]({{< relref "My Note" >}})`},
+		{"display text", "[[My Note|click here]]", `[click here]({{< relref "My Note" >}})`},
+		{"display text with spaces", "[[My Note| see  this note ]]", `[see  this note]({{< relref "My Note" >}})`},
+		{"heading", "[[My Note#Some Heading]]", `[My Note]({{< relref "My Note#some-heading" >}})`},
+		{"heading and display text", "[[My Note#Some Heading|there]]", `[there]({{< relref "My Note#some-heading" >}})`},
+		{"chained heading", "[[My Note#Intro#Some Heading]]", `[My Note]({{< relref "My Note#some-heading" >}})`},
+		{"case-insensitive target", "[[my note]]", `[my note]({{< relref "My Note" >}})`},
+		{"embed is kept", "![[My Note]]", "![[My Note]]"},
+		{"unresolved keeps display text", "[[Missing|the text]]", "the text"},
+		{"unresolved heading link", "[[Missing#Part]]", "Missing"},
+		{"inline code", "`[[My Note]]`", "`[[My Note]]`"},
+		{"fenced code", "```\n[[My Note]]\n```", "```\n[[My Note]]\n```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteWikilinks(tt.content, "/vault/Current.md"); got != tt.want {
+				t.Errorf("rewriteWikilinks(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWikilinkEscapedPipe(t *testing.T) {
+	tests := []struct {
+		inner, target, alias string
+	}{
+		{`Page\|not an alias`, "Page|not an alias", ""},
+		{`Page\|part|shown text`, "Page|part", "shown text"},
+		{`Page|shown \| text`, "Page", "shown | text"},
+	}
+	for _, tt := range tests {
+		target, _, alias := parseWikilink(tt.inner)
+		if target != tt.target || alias != tt.alias {
+			t.Errorf("parseWikilink(%q) = (%q, %q), want (%q, %q)", tt.inner, target, alias, tt.target, tt.alias)
+		}
+	}
+}
+
+func TestRewriteWikilinksEscapedPipes(t *testing.T) {
+	withPublishedNotes(t, &publishedNote{path: "/vault/My Note.md", bundle: "My Note"})
+	tests := []struct {
+		name, content, want string
+	}{
+		{"literal pipe outside table", `[[Page\|not an alias]]`, "Page|not an alias"},
+		{"literal pipe in table cell", `| a | [[Page\|not an alias]] |`, `| a | Page\|not an alias |`},
+		{"escaped cell text is kept", `| x \| y | [[My Note]] |`, `| x \| y | [My Note]({{< relref "My Note" >}}) |`},
+		{"display text pipe in table cell", `| [[My Note|a \| b]] |`, `| [a \| b]({{< relref "My Note" >}}) |`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteWikilinks(tt.content, "/vault/Current.md"); got != tt.want {
+				t.Errorf("rewriteWikilinks(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexAliases(t *testing.T) {
+	notes := map[string]*scannedNote{
+		"go notes": {path: "/vault/Go Notes.md", aliases: []string{"Golang", "Go", " "}},
+		"go":       {path: "/vault/Go.md", aliases: []string{"go notes"}},
+		"z-golang": {path: "/vault/z-golang.md", aliases: []string{"golang", "z"}},
+	}
+	want := map[string]string{"golang": "go notes", "z": "z-golang"}
+	if got := indexAliases(notes, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexAliases = %v, want %v", got, want)
+	}
+}
+
+func TestNoteURL(t *testing.T) {
+	savedLayout, savedPosts, savedURL, savedUgly := *layout, *hugoPostsDir, *postsURL, *uglyURLs
+	t.Cleanup(func() { *layout, *hugoPostsDir, *postsURL, *uglyURLs = savedLayout, savedPosts, savedURL, savedUgly })
+	*hugoPostsDir = filepath.FromSlash("/site/content/posts")
+	note := &publishedNote{bundle: "My Note"}
+
+	tests := []struct {
+		layout, postsURL string
+		ugly             bool
+		anchor, want     string
+	}{
+		{"bundle", "", false, "part", `{{< relref "My Note#part" >}}`},
+		{"flat", "", false, "", "/posts/my-note/"},
+		{"flat", "/blog", false, "part", "/blog/my-note/#part"},
+		{"flat", "", true, "", "/posts/my-note.html"},
+	}
+	for _, tt := range tests {
+		*layout, *postsURL, *uglyURLs = tt.layout, tt.postsURL, tt.ugly
+		if got := noteURL(note, tt.anchor); got != tt.want {
+			t.Errorf("noteURL with --layout=%s --posts-url=%q --ugly-urls=%t = %q, want %q", tt.layout, tt.postsURL, tt.ugly, got, tt.want)
+		}
+	}
+
+	*layout = "bundle"
+	if got, want := noteURL(&publishedNote{bundle: `Say "hi"`}, ""), "{{< relref `Say \"hi\"` >}}"; got != want {
+		t.Errorf("noteURL for a bundle with quotes = %q, want %q", got, want)
+	}
+}
+
+func TestUnresolvedLink(t *testing.T) {
+	savedStyle, savedClass := *unresolvedStyle, *unresolvedClass
+	t.Cleanup(func() { *unresolvedStyle, *unresolvedClass = savedStyle, savedClass })
+
+	tests := []struct {
+		style, class, want string
+	}{
+		{"plain", "broken-link", "the text"},
+		{"keep", "broken-link", "[[Missing|the text]]"},
+		{"marker", "broken-link", `<span class="broken-link">the text</span>`},
+		{"marker", "missing", `<span class="missing">the text</span>`},
+	}
+	for _, tt := range tests {
+		*unresolvedStyle, *unresolvedClass = tt.style, tt.class
+		if got := unresolvedLink("Missing|the text", "the text"); got != tt.want {
+			t.Errorf("unresolvedLink with --unresolved-link-style=%s = %q, want %q", tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteWikilinksAliases(t *testing.T) {
+	withPublishedNotes(t, &publishedNote{path: "/vault/Some Note.md", bundle: "Some Note"})
+	saved := *unresolvedStyle
+	t.Cleanup(func() { *unresolvedStyle = saved })
+
+	tests := []struct {
+		name, style, content, want string
+	}{
+		{"resolved", "plain", "See [[Some Note|display text]].", `See [display text]({{< relref "Some Note" >}}).`},
+		{"resolved in table cell", "plain", "| [[Some Note|display text]] |", `| [display text]({{< relref "Some Note" >}}) |`},
+		{"unresolved", "plain", "See [[Other Note|display text]].", "See display text."},
+		{"unresolved marker", "marker", "[[Other Note|display text]]", `<span class="broken-link">display text</span>`},
+		{"unresolved marker escaped", "marker", "[[Other Note|a <b> & c]]", `<span class="broken-link">a &lt;b&gt; &amp; c</span>`},
+		{"unresolved kept", "keep", "[[Other Note|display text]]", "[[Other Note|display text]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*unresolvedStyle = tt.style
+			if got := rewriteWikilinks(tt.content, "/vault/Current.md"); got != tt.want {
+				t.Errorf("rewriteWikilinks(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
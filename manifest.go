@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// manifestEntry — запланированное копирование вложения при --attachment-mode=manifest.
+type manifestEntry struct {
+	source, target string
+}
+
+// attachmentManifest накапливает запланированные копирования вложений.
+var attachmentManifest = struct {
+	sync.Mutex
+	entries []manifestEntry
+	seen    map[manifestEntry]struct{}
+}{seen: make(map[manifestEntry]struct{})}
+
+// resetAttachmentManifest забывает запланированные копирования перед повторной конвертацией (--watch).
+func resetAttachmentManifest() {
+	attachmentManifest.Lock()
+	defer attachmentManifest.Unlock()
+	attachmentManifest.entries = nil
+	attachmentManifest.seen = make(map[manifestEntry]struct{})
+}
+
+// copyLocks — блокировки по целевому пути вложения для параллельной обработки заметок.
+var copyLocks sync.Map
+
+// attachmentNames — целевые пути вложений с исходными именами и файлы, которые в них
+// копируются, чтобы разные файлы с одинаковым именем не перезаписывали друг друга.
+var attachmentNames = struct {
+	sync.Mutex
+	sources map[string]string
+}{sources: make(map[string]string)}
+
+// resetAttachmentNames забывает занятые имена вложений перед повторной конвертацией (--watch).
+func resetAttachmentNames() {
+	attachmentNames.Lock()
+	defer attachmentNames.Unlock()
+	attachmentNames.sources = make(map[string]string)
+}
+
+// claimAttachmentName возвращает имя для вложения source в каталоге dir: name или,
+// если это имя уже занято другим файлом, name с номером (image-2.png, image-3.png, ...).
+func claimAttachmentName(dir, name, source string) string {
+	attachmentNames.Lock()
+	defer attachmentNames.Unlock()
+	extension := filepath.Ext(name)
+	candidate := name
+	for i := 2; ; i++ {
+		target := filepath.Join(dir, candidate)
+		if owner, taken := attachmentNames.sources[target]; !taken || owner == source {
+			attachmentNames.sources[target] = source
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, extension), i, extension)
+	}
+}
+
+// claimFlatAttachmentNames заранее занимает имена вложений опубликованных заметок
+// в раскладке flat, где все вложения лежат в одном каталоге. Заметки обходятся по
+// алфавиту путей, а вложения — в порядке появления, включая вложения встроенных
+// заметок, поэтому имена (image.png, image-2.png) не зависят от порядка, в котором
+// заметки обрабатываются параллельно.
+func claimFlatAttachmentNames() {
+	if *attachmentNaming != "original" && *attachmentNaming != "slug" {
+		return
+	}
+	keys := make([]string, 0, len(noteIndex))
+	for key := range noteIndex {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return noteIndex[keys[i]].path < noteIndex[keys[j]].path })
+
+	var claim func(note *scannedNote, visited map[string]struct{})
+	claim = func(note *scannedNote, visited map[string]struct{}) {
+		if _, ok := visited[note.path]; ok {
+			return
+		}
+		visited[note.path] = struct{}{}
+		for _, target := range note.embeds {
+			if embedded, ok := vaultNotes[noteKey(target)]; ok {
+				claim(embedded, visited)
+				continue
+			}
+			if source, ok := findAttachment(target, filepath.Dir(note.path)); ok {
+				claimAttachmentName(*hugoPostsDir, attachmentFileName(source), source)
+			}
+		}
+	}
+	for _, key := range keys {
+		if note, ok := vaultNotes[key]; ok {
+			claim(note, make(map[string]struct{}))
+		}
+	}
+}
+
+// attachmentFileName возвращает имя вложения source в каталоге поста для схем
+// именования original (исходное имя) и slug (имя в виде slug).
+func attachmentFileName(source string) string {
+	if *attachmentNaming != "slug" {
+		return filepath.Base(source)
+	}
+	extension := filepath.Ext(source)
+	name := slugify(strings.TrimSuffix(filepath.Base(source), extension))
+	if name == "" {
+		name = "attachment"
+	}
+	return name + strings.ToLower(extension)
+}
+
+// placeAttachment копирует вложение src в dst или, в режиме manifest и с --dry-run,
+// только записывает это копирование в манифест. Если в dst уже лежит такой же файл,
+// он не перезаписывается: время изменения остается прежним, и rsync не передает его заново.
+func placeAttachment(src, dst string) error {
+	if *dryRun {
+		if sameFileContent(src, dst) {
+			planAction("без изменений", dst, src)
+		} else {
+			planAction("скопировать", dst, src)
+		}
+	} else if *attachmentMode != "manifest" {
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		// Одно и то же вложение (в раскладке flat) могут копировать сразу несколько заметок
+		lock, _ := copyLocks.LoadOrStore(dst, &sync.Mutex{})
+		lock.(*sync.Mutex).Lock()
+		defer lock.(*sync.Mutex).Unlock()
+		if sameFileContent(src, dst) {
+			logf(DEBUG, "Вложение '%s' не изменилось, копирование пропущено.", dst)
+			return nil
+		}
+		return copyFile(src, dst)
+	}
+	entry := manifestEntry{source: src, target: dst}
+	attachmentManifest.Lock()
+	defer attachmentManifest.Unlock()
+	if _, ok := attachmentManifest.seen[entry]; !ok {
+		attachmentManifest.seen[entry] = struct{}{}
+		attachmentManifest.entries = append(attachmentManifest.entries, entry)
+	}
+	return nil
+}
+
+// sameFileContent проверяет, что файл dst существует и совпадает с src по размеру и MD5.
+func sameFileContent(src, dst string) bool {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil || dstInfo.IsDir() || dstInfo.Size() != srcInfo.Size() {
+		return false
+	}
+	srcHash, err := calculateMD5(src)
+	if err != nil {
+		return false
+	}
+	dstHash, err := calculateMD5(dst)
+	return err == nil && srcHash == dstHash
+}
+
+// plannedAttachments возвращает вложения, размещенные в каталоге dir (включая
+// подкаталоги --attachment-sharding): путь относительно dir, как в ссылках, и путь,
+// откуда файл можно скопировать. В режиме manifest и с --dry-run файлов в dir еще нет,
+// поэтому они берутся из манифеста.
+func plannedAttachments(dir string) (map[string]string, error) {
+	attachments := make(map[string]string)
+	if *attachmentMode == "manifest" || *dryRun {
+		attachmentManifest.Lock()
+		defer attachmentManifest.Unlock()
+		for _, entry := range attachmentManifest.entries {
+			rel, err := filepath.Rel(dir, entry.target)
+			if err == nil && !strings.HasPrefix(rel, "..") {
+				attachments[filepath.ToSlash(rel)] = entry.source
+			}
+		}
+		return attachments, nil
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		attachments[filepath.ToSlash(rel)] = path
+		return nil
+	})
+	return attachments, err
+}
+
+// writeAttachmentManifest записывает манифест копирования: по строке на вложение,
+// исходный и целевой путь разделены табуляцией.
+func writeAttachmentManifest(path string) error {
+	attachmentManifest.Lock()
+	defer attachmentManifest.Unlock()
+
+	var sb strings.Builder
+	for _, entry := range attachmentManifest.entries {
+		sb.WriteString(entry.source + "\t" + entry.target + "\n")
+	}
+	if err := writeFile(path, []byte(sb.String())); err != nil {
+		return fmt.Errorf("не удалось записать манифест вложений %s: %w", path, err)
+	}
+	logf(INFO, "Манифест вложений (%d файлов) сохранен как: %s", len(attachmentManifest.entries), path)
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttachmentManifestMode(t *testing.T) {
+	savedMode := *attachmentMode
+	attachmentManifest.Lock()
+	savedEntries, savedSeen := attachmentManifest.entries, attachmentManifest.seen
+	attachmentManifest.entries, attachmentManifest.seen = nil, make(map[manifestEntry]struct{})
+	attachmentManifest.Unlock()
+	t.Cleanup(func() {
+		*attachmentMode = savedMode
+		attachmentManifest.Lock()
+		attachmentManifest.entries, attachmentManifest.seen = savedEntries, savedSeen
+		attachmentManifest.Unlock()
+	})
+	*attachmentMode = "manifest"
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "image.png")
+	bundleDir := filepath.Join(dir, "post")
+	target := filepath.Join(bundleDir, "post-1.png")
+	for i := 0; i < 2; i++ {
+		if err := placeAttachment(source, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("attachment was copied in manifest mode: %v", err)
+	}
+
+	planned, err := plannedAttachments(bundleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"post-1.png": source}; !reflect.DeepEqual(planned, want) {
+		t.Errorf("plannedAttachments = %v, want %v", planned, want)
+	}
+
+	manifest := filepath.Join(dir, "attachments.manifest")
+	if err := writeAttachmentManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := source + "\t" + target + "\n"; string(data) != want {
+		t.Errorf("manifest = %q, want %q", data, want)
+	}
+}
+
+func TestPlaceAttachmentSkipsUnchanged(t *testing.T) {
+	saved := *attachmentMode
+	*attachmentMode = "copy"
+	t.Cleanup(func() { *attachmentMode = saved })
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.png"), filepath.Join(dir, "post", "dst.png")
+	if err := os.WriteFile(src, []byte("image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := placeAttachment(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(dst, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := placeAttachment(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dst); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("unchanged attachment was copied again")
+	}
+
+	if err := os.WriteFile(src, []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := placeAttachment(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "other" {
+		t.Errorf("changed attachment = %q, want the new content", data)
+	}
+}
+
+func TestClaimAttachmentName(t *testing.T) {
+	resetAttachmentNames()
+	t.Cleanup(resetAttachmentNames)
+
+	tests := []struct {
+		name, source, want string
+	}{
+		{"image.png", "/vault/a/image.png", "image.png"},
+		{"image.png", "/vault/b/image.png", "image-2.png"},
+		{"image.png", "/vault/a/image.png", "image.png"},
+		{"image.png", "/vault/c/image.png", "image-3.png"},
+		{"other.png", "/vault/b/other.png", "other.png"},
+	}
+	for _, tt := range tests {
+		if got := claimAttachmentName("/site/posts", tt.name, tt.source); got != tt.want {
+			t.Errorf("claimAttachmentName(%q, %q) = %q, want %q", tt.name, tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestAttachmentFileName(t *testing.T) {
+	saved := *attachmentNaming
+	t.Cleanup(func() { *attachmentNaming = saved })
+
+	tests := []struct {
+		naming, source, want string
+	}{
+		{"original", "/vault/My Image.PNG", "My Image.PNG"},
+		{"slug", "/vault/My Image.PNG", "my-image.png"},
+	}
+	for _, tt := range tests {
+		*attachmentNaming = tt.naming
+		if got := attachmentFileName(tt.source); got != tt.want {
+			t.Errorf("%s: attachmentFileName(%q) = %q, want %q", tt.naming, tt.source, got, tt.want)
+		}
+	}
+}
+
+// Имена вложений в раскладке flat не должны зависеть от порядка обработки заметок.
+func TestFlatAttachmentNamesAreDeterministic(t *testing.T) {
+	notePath, _ := attachmentVault(t, "a/image.png", "b/image.png")
+	vault := filepath.Dir(notePath)
+	notes := map[string]string{
+		"A.md": "![[a/image.png]]\n",
+		"B.md": "![[b/image.png]]\n",
+	}
+	for name, content := range notes {
+		if err := os.WriteFile(filepath.Join(vault, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	savedNotes, savedPosts, savedNoFilter, savedLayout, savedNaming := *notesDir, *hugoPostsDir, *noFilter, *layout, *attachmentNaming
+	*notesDir, *noFilter, *layout, *attachmentNaming = vault, true, "flat", "original"
+	t.Cleanup(func() {
+		*notesDir, *hugoPostsDir, *noFilter, *layout, *attachmentNaming = savedNotes, savedPosts, savedNoFilter, savedLayout, savedNaming
+		resetNoteIndex()
+		resetAttachmentNames()
+	})
+
+	// Заметки обрабатываются в обратном порядке, но B все равно получает image-2.png
+	for _, order := range [][]string{{"A.md", "B.md"}, {"B.md", "A.md"}} {
+		*hugoPostsDir = t.TempDir()
+		resetNoteIndex()
+		resetAttachmentNames()
+		var notePaths []string
+		for _, name := range order {
+			notePaths = append(notePaths, filepath.Join(vault, name))
+		}
+		buildNoteIndex(notePaths)
+		if err := processNotesConcurrently(notePaths, 1); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]string{"A.md": "image.png", "B.md": "image-2.png"} {
+			data, err := os.ReadFile(filepath.Join(*hugoPostsDir, strings.TrimSuffix(name, ".md")+".md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), want) {
+				t.Errorf("order %v: %s = %q, want it to embed %s", order, name, data, want)
+			}
+		}
+	}
+}
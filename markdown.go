@@ -0,0 +1,591 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Регулярные выражения для преобразования текста заметки
+var (
+	// Паттерн для поиска встроенного кода (`код` или ``код``).
+	inlineCodePattern = regexp.MustCompile("``[^`]*``|`[^`\n]+`")
+	// Паттерн для поиска шорткодов Hugo ({{< ... >}} и {{% ... %}}).
+	shortcodePattern = regexp.MustCompile(`\{\{([<%])(.*?)([>%])\}\}`)
+	// Паттерн для поиска маркера краткого содержания Hugo.
+	moreMarkerPattern = regexp.MustCompile(`<!--\s*more\s*-->`)
+	// Паттерн для поиска адресов http(s) в тексте.
+	bareURLPattern = regexp.MustCompile(`https?://[^\s<>()\[\]{}"'` + "`" + `]+`)
+	// Паттерн для фрагментов, адреса в которых уже оформлены: ссылки Markdown,
+	// HTML-теги и шорткоды Hugo.
+	linkedSpanPattern = regexp.MustCompile(`!?\[[^\]]*\]\([^)]*\)|<[^>\n]*>|\{\{[<%].*?[>%]\}\}`)
+	// Паттерн для выделения Obsidian (==текст==); текст не начинается и не кончается пробелом.
+	highlightPattern = regexp.MustCompile(`==(\S(?:[^\n]*?\S)?)==`)
+	// Паттерн для идентификаторов блоков Obsidian (^id в конце строки или отдельной строкой).
+	blockIDPattern = regexp.MustCompile(`(?m)(^|[ \t]+)\^([A-Za-z0-9-]+)[ \t]*$`)
+	// Паттерн для ссылок Markdown: картинка (с !) или текст ссылки в первой группе.
+	markdownLinkPattern = regexp.MustCompile(`(!?)\[([^\]]*)\]\([^)]*\)`)
+	// Паттерн для сносок ([^1]), разметки выделения и HTML-тегов, которые не нужны в кратком описании.
+	summaryMarkupPattern = regexp.MustCompile(`\[\^[^\]]*\]|\*\*|__|~~|==|\*|<[^>\n]*>`)
+	// Паттерн для маркеров списков (и задач) в начале строки.
+	lineMarkerPattern = regexp.MustCompile(`^\s*(?:[-*+]\s+(?:\[.\]\s+)?|\d+[.)]\s+)?`)
+	// Паттерн для пробелов перед знаками препинания, остающихся после удаления разметки.
+	spaceBeforePunctPattern = regexp.MustCompile(`\s+([.,;:!?])`)
+)
+
+// moreMarker — маркер, которым Hugo отделяет краткое содержание от текста.
+const moreMarker = "<!--more-->"
+
+// transformOutsideCode применяет fn к фрагментам текста вне блоков кода и встроенного кода.
+// Содержимое кода остается без изменений.
+func transformOutsideCode(content string, fn func(string) string) string {
+	var sb strings.Builder
+	var text []string
+	flushText := func() {
+		if len(text) == 0 {
+			return
+		}
+		sb.WriteString(transformOutsideInlineCode(strings.Join(text, "\n"), fn))
+		text = nil
+	}
+
+	lines := strings.Split(content, "\n")
+	inCode := false
+	for i, line := range lines {
+		newline := "\n"
+		if i == len(lines)-1 {
+			newline = ""
+		}
+		if codeFencePattern.MatchString(line) || inCode {
+			if codeFencePattern.MatchString(line) {
+				inCode = !inCode
+			}
+			if len(text) > 0 {
+				flushText()
+				sb.WriteString("\n")
+			}
+			sb.WriteString(line + newline)
+			continue
+		}
+		text = append(text, line)
+	}
+	flushText()
+	return sb.String()
+}
+
+// transformOutsideInlineCode применяет fn к тексту между фрагментами встроенного кода.
+func transformOutsideInlineCode(text string, fn func(string) string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range inlineCodePattern.FindAllStringIndex(text, -1) {
+		sb.WriteString(fn(text[last:loc[0]]))
+		sb.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	sb.WriteString(fn(text[last:]))
+	return sb.String()
+}
+
+// escapeShortcodes экранирует шорткоды Hugo, встречающиеся в тексте заметки,
+// чтобы Hugo вывел их как текст: {{< x >}} превращается в {{</* x */>}}.
+func escapeShortcodes(content string) string {
+	return transformOutsideCode(content, func(text string) string {
+		return shortcodePattern.ReplaceAllStringFunc(text, func(shortcode string) string {
+			parts := shortcodePattern.FindStringSubmatch(shortcode)
+			inner := parts[2]
+			if strings.HasPrefix(inner, "/*") && strings.HasSuffix(inner, "*/") {
+				return shortcode // Уже экранирован
+			}
+			return "{{" + parts[1] + "/*" + inner + "*/" + parts[3] + "}}"
+		})
+	})
+}
+
+// insertMoreMarker вставляет маркер <!--more--> после первого абзаца (position "paragraph")
+// или в конце раздела с заданным заголовком (position "heading:Заголовок").
+// Если маркер уже есть в тексте или место для него не найдено, текст не меняется.
+func insertMoreMarker(content, position string) (string, bool) {
+	if moreMarkerPattern.MatchString(content) {
+		return content, false
+	}
+
+	lines := strings.Split(content, "\n")
+	insertAt := -1
+	if heading, ok := strings.CutPrefix(position, "heading:"); ok {
+		insertAt = sectionEnd(lines, heading)
+	} else if position == "paragraph" {
+		insertAt = firstParagraphEnd(lines)
+	}
+	if insertAt < 0 {
+		return content, false
+	}
+
+	result := append([]string{}, lines[:insertAt]...)
+	result = append(result, "", moreMarker)
+	if insertAt < len(lines) && strings.TrimSpace(lines[insertAt]) != "" {
+		result = append(result, "")
+	}
+	result = append(result, lines[insertAt:]...)
+	return strings.Join(result, "\n"), true
+}
+
+// firstParagraphEnd возвращает индекс строки сразу после первого абзаца текста
+// (заголовки и блоки кода абзацами не считаются) или -1, если абзаца нет.
+func firstParagraphEnd(lines []string) int {
+	inCode, inParagraph := false, false
+	for i, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			if inParagraph {
+				return i
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		blank := strings.TrimSpace(line) == ""
+		switch {
+		case inParagraph && (blank || headingPattern.MatchString(line)):
+			return i
+		case !blank && !headingPattern.MatchString(line):
+			inParagraph = true
+		}
+	}
+	if inParagraph {
+		return len(lines)
+	}
+	return -1
+}
+
+// sectionEnd возвращает индекс строки, с которой начинается заголовок того же или
+// более высокого уровня, следующий за разделом heading (или конец текста), либо -1,
+// если раздел не найден. Подзаголовки раздела входят в него, как в Obsidian.
+func sectionEnd(lines []string, heading string) int {
+	inCode, inSection := false, false
+	level := 0
+	for i, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		match := headingPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if inSection && len(match[1]) <= level {
+			return trimTrailingBlank(lines, i)
+		}
+		if !inSection && strings.EqualFold(strings.TrimSpace(match[2]), strings.TrimSpace(heading)) {
+			inSection, level = true, len(match[1])
+		}
+	}
+	if inSection {
+		return trimTrailingBlank(lines, len(lines))
+	}
+	return -1
+}
+
+// headingSection возвращает раздел с заголовком heading (сравниваются якоря, как
+// у ссылок) вместе с самим заголовком — до следующего заголовка того же или более
+// высокого уровня.
+func headingSection(content, heading string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	anchor := headingAnchor(heading)
+	start, level := -1, 0
+	inCode := false
+	for i, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		match := headingPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if start >= 0 && len(match[1]) <= level {
+			return strings.TrimSpace(strings.Join(lines[start:i], "\n")), true
+		}
+		if start < 0 && headingAnchor(blockIDPattern.ReplaceAllString(match[2], "")) == anchor {
+			start, level = i, len(match[1])
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(strings.Join(lines[start:], "\n")), true
+}
+
+// blockText возвращает блок с идентификатором ^id: абзац (или список), в последней
+// строке которого стоит идентификатор, либо блок перед строкой с одним идентификатором.
+func blockText(content, id string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	inCode := false
+	for i, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		match := blockIDPattern.FindStringSubmatch(line)
+		if inCode || match == nil || !strings.EqualFold(match[2], id) {
+			continue
+		}
+		end := i + 1
+		if strings.TrimSpace(line[:len(line)-len(match[0])]) == "" {
+			// Идентификатор отдельной строкой помечает предыдущий блок
+			end = trimTrailingBlank(lines, i)
+		}
+		start := end - 1
+		for start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+			start--
+		}
+		return strings.TrimSpace(strings.Join(lines[start:end], "\n")), start < end
+	}
+	return "", false
+}
+
+// trimTrailingBlank сдвигает индекс end назад через пустые строки.
+func trimTrailingBlank(lines []string, end int) int {
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return end
+}
+
+// autolinkURLs оборачивает адреса http(s), не оформленные ссылками, в угловые скобки
+// (<https://example.com>), чтобы они были кликабельны при любых настройках Markdown в Hugo.
+// Адреса внутри ссылок, HTML-тегов, шорткодов и кода не затрагиваются.
+func autolinkURLs(content string) string {
+	return transformOutsideCode(content, func(text string) string {
+		var sb strings.Builder
+		last := 0
+		for _, loc := range linkedSpanPattern.FindAllStringIndex(text, -1) {
+			sb.WriteString(wrapBareURLs(text[last:loc[0]]))
+			sb.WriteString(text[loc[0]:loc[1]])
+			last = loc[1]
+		}
+		sb.WriteString(wrapBareURLs(text[last:]))
+		return sb.String()
+	})
+}
+
+// wrapBareURLs оборачивает адреса в тексте без ссылок в угловые скобки. Завершающие
+// знаки препинания в адрес не включаются.
+func wrapBareURLs(text string) string {
+	return bareURLPattern.ReplaceAllStringFunc(text, func(url string) string {
+		trimmed := strings.TrimRight(url, ".,;:!?")
+		return "<" + trimmed + ">" + url[len(trimmed):]
+	})
+}
+
+// stripBlockIDs удаляет из текста идентификаторы блоков Obsidian (^id), на которые
+// ведут ссылки [[Заметка#^id]]. Строка, состоящая из одного идентификатора (так
+// помечаются списки и таблицы), удаляется целиком. С anchors на месте идентификатора
+// остается HTML-якорь <span id="block-id"></span>, чтобы ссылка вела к блоку.
+func stripBlockIDs(content string, anchors bool) string {
+	return transformOutsideCode(content, func(text string) string {
+		lines := strings.Split(text, "\n")
+		result := make([]string, 0, len(lines))
+		for _, line := range lines {
+			match := blockIDPattern.FindStringSubmatchIndex(line)
+			if match == nil {
+				result = append(result, line)
+				continue
+			}
+			id := line[match[4]:match[5]]
+			rest := line[:match[0]]
+			switch {
+			case anchors && strings.TrimSpace(rest) == "":
+				result = append(result, rest+blockAnchor(id))
+			case anchors:
+				result = append(result, rest+" "+blockAnchor(id))
+			case strings.TrimSpace(rest) != "":
+				result = append(result, rest)
+			}
+		}
+		return strings.Join(result, "\n")
+	})
+}
+
+// blockAnchor возвращает HTML-якорь для блока с идентификатором id.
+func blockAnchor(id string) string {
+	return fmt.Sprintf(`<span id="%s"></span>`, blockAnchorID(id))
+}
+
+// blockAnchorID возвращает значение атрибута id для якоря блока.
+func blockAnchorID(id string) string {
+	return "block-" + strings.ToLower(id)
+}
+
+// convertHighlights заменяет выделения ==текст== вне кода тегом <mark> (style "mark")
+// или парным шорткодом (style "shortcode:имя").
+func convertHighlights(content, style string) string {
+	open, closing := "<mark>", "</mark>"
+	if name, ok := strings.CutPrefix(style, "shortcode:"); ok {
+		open, closing = "{{< "+name+" >}}", "{{< /"+name+" >}}"
+	}
+	return transformOutsideCode(content, func(text string) string {
+		return highlightPattern.ReplaceAllString(text, open+"$1"+closing)
+	})
+}
+
+// stripComments удаляет комментарии Obsidian: %%в строке%% и многострочные блоки
+// между %%. Незакрытый комментарий, как и в Obsidian, продолжается до конца текста.
+// Строки, которые состояли только из комментария, удаляются целиком. Блоки кода
+// и встроенный код не затрагиваются.
+func stripComments(content string) string {
+	lines := strings.Split(content, "\n")
+	result := make([]string, 0, len(lines))
+	inCode, inComment := false, false
+	for _, line := range lines {
+		if !inComment && codeFencePattern.MatchString(line) {
+			inCode = !inCode
+		}
+		if inCode {
+			result = append(result, line)
+			continue
+		}
+
+		var sb strings.Builder
+		commented := inComment
+		for i := 0; i < len(line); {
+			if inComment {
+				end := strings.Index(line[i:], "%%")
+				if end < 0 {
+					break
+				}
+				i += end + 2
+				inComment = false
+				continue
+			}
+			if line[i] == '`' {
+				// Встроенный код копируется целиком до закрывающих обратных кавычек
+				run := len(line[i:]) - len(strings.TrimLeft(line[i:], "`"))
+				end := strings.Index(line[i+run:], strings.Repeat("`", run))
+				if end < 0 {
+					sb.WriteString(line[i:])
+					break
+				}
+				sb.WriteString(line[i : i+run+end+run])
+				i += run + end + run
+				continue
+			}
+			if strings.HasPrefix(line[i:], "%%") {
+				inComment, commented = true, true
+				i += 2
+				continue
+			}
+			sb.WriteByte(line[i])
+			i++
+		}
+
+		if !commented {
+			result = append(result, line)
+		} else if text := strings.TrimRight(sb.String(), " \t"); strings.TrimSpace(text) != "" {
+			result = append(result, text)
+		}
+	}
+	return strings.Join(result, "\n")
+}
+
+// removeComments удаляет комментарии Obsidian, если не указан --keep-comments.
+func removeComments(content string) string {
+	if *keepComments {
+		return content
+	}
+	return stripComments(content)
+}
+
+// shiftHeadings понижает уровень всех заголовков вне блоков кода на shift (H1 → H2 и т.д.).
+// Уровень не может превысить H6.
+func shiftHeadings(content string, shift int) string {
+	lines := strings.Split(content, "\n")
+	inCode := false
+	for i, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		match := headingPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		level := len(match[1]) + shift
+		if level > 6 {
+			level = 6
+		}
+		lines[i] = strings.Repeat("#", level) + line[len(match[1]):]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripTitleHeading удаляет заголовок первого уровня в начале текста,
+// если он совпадает с названием заметки.
+func stripTitleHeading(content, title string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	first := 0
+	for first < len(lines) && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+	if first == len(lines) {
+		return content, false
+	}
+	match := headingPattern.FindStringSubmatch(lines[first])
+	if match == nil || len(match[1]) != 1 || !strings.EqualFold(strings.TrimSpace(match[2]), strings.TrimSpace(title)) {
+		return content, false
+	}
+
+	rest := first + 1
+	for rest < len(lines) && strings.TrimSpace(lines[rest]) == "" {
+		rest++
+	}
+	return strings.Join(lines[rest:], "\n"), true
+}
+
+// firstH1 возвращает текст первого заголовка первого уровня вне блоков кода.
+func firstH1(content string) (string, bool) {
+	inCode := false
+	for _, line := range strings.Split(content, "\n") {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		if match := headingPattern.FindStringSubmatch(line); match != nil && len(match[1]) == 1 {
+			if title := strings.TrimSpace(match[2]); title != "" {
+				return title, true
+			}
+		}
+	}
+	return "", false
+}
+
+// collapseBlankLines сокращает серии из нескольких пустых строк вне блоков кода до одной.
+func collapseBlankLines(content string) string {
+	lines := strings.Split(content, "\n")
+	result := make([]string, 0, len(lines))
+	inCode, prevBlank := false, false
+	for _, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+		}
+		blank := !inCode && strings.TrimSpace(line) == ""
+		if blank && prevBlank {
+			continue
+		}
+		prevBlank = blank
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n")
+}
+
+// extractInlineField находит inline-поле Dataview key:: значение (отдельной строкой
+// или в квадратных скобках [key:: значение]) вне блоков кода, удаляет его из текста
+// и возвращает значение первого найденного поля.
+func extractInlineField(content, key string) (string, string) {
+	linePattern := regexp.MustCompile(`^\s*` + regexp.QuoteMeta(key) + `::\s*(.*?)\s*$`)
+	bracketPattern := regexp.MustCompile(` ?\[` + regexp.QuoteMeta(key) + `::\s*([^\]]*?)\s*\]`)
+
+	var value string
+	lines := strings.Split(content, "\n")
+	result := make([]string, 0, len(lines))
+	inCode := false
+	for _, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+		}
+		if inCode {
+			result = append(result, line)
+			continue
+		}
+		if match := linePattern.FindStringSubmatch(line); match != nil {
+			if value == "" {
+				value = match[1]
+			}
+			continue
+		}
+		if match := bracketPattern.FindStringSubmatch(line); match != nil {
+			if value == "" {
+				value = match[1]
+			}
+			line = strings.TrimRight(bracketPattern.ReplaceAllString(line, ""), " ")
+		}
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n"), value
+}
+
+// summaryText возвращает первый абзац текста заметки без разметки Markdown и Obsidian
+// для --summary-key. Заголовки, блоки кода, таблицы, цитаты и выноски, а также абзацы
+// из одних картинок пропускаются. Если words больше нуля, текст сокращается до
+// words слов с многоточием.
+func summaryText(content string, words int) string {
+	var paragraph []string
+	inCode := false
+	for _, line := range append(strings.Split(content, "\n"), "") {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode || headingPattern.MatchString(line) || quoteLinePattern.MatchString(line) ||
+			strings.HasPrefix(strings.TrimSpace(line), "|") {
+			line = ""
+		}
+		if text := strings.TrimSpace(lineMarkerPattern.ReplaceAllString(line, "")); text != "" {
+			paragraph = append(paragraph, text)
+			continue
+		}
+		if summary := plainText(strings.Join(paragraph, " ")); summary != "" {
+			return truncateWords(summary, words)
+		}
+		paragraph = nil
+	}
+	return ""
+}
+
+// plainText убирает из фрагмента текста вложения, картинки, разметку ссылок,
+// выделения, сноски, теги и идентификаторы блоков.
+func plainText(text string) string {
+	text = attachmentPattern.ReplaceAllString(text, "")
+	text = markdownLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		match := markdownLinkPattern.FindStringSubmatch(link)
+		if match[1] != "" {
+			return ""
+		}
+		return match[2]
+	})
+	text = wikilinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		target := wikilinkPattern.FindStringSubmatch(link)[1]
+		if _, alias, ok := strings.Cut(target, "|"); ok {
+			return alias
+		}
+		target, _, _ = strings.Cut(target, "#")
+		return target
+	})
+	text = strings.ReplaceAll(text, "`", "")
+	text = summaryMarkupPattern.ReplaceAllString(text, "")
+	text = blockIDPattern.ReplaceAllString(text, "")
+	text = inlineTagPattern.ReplaceAllString(text, "$1")
+	return spaceBeforePunctPattern.ReplaceAllString(strings.Join(strings.Fields(text), " "), "$1")
+}
+
+// truncateWords сокращает текст до words слов, добавляя многоточие. При words <= 0
+// текст не меняется.
+func truncateWords(text string, words int) string {
+	fields := strings.Fields(text)
+	if words <= 0 || len(fields) <= words {
+		return text
+	}
+	return strings.TrimRight(strings.Join(fields[:words], " "), ",.;:—-") + "…"
+}
@@ -0,0 +1,223 @@
+package main
+
+import "testing"
+
+func TestEscapeShortcodes(t *testing.T) {
+	tests := []struct {
+		content, want string
+	}{
+		{`Use {{< figure src="a.png" >}} here`, `Use {{</* figure src="a.png" */>}} here`},
+		{"Markdown {{% notice %}}", "Markdown {{%/* notice */%}}"},
+		{"Already {{</* x */>}}", "Already {{</* x */>}}"},
+		{"Inline `{{< x >}}` code", "Inline `{{< x >}}` code"},
+		{"```\n{{< x >}}\n```\n{{< y >}}", "```\n{{< x >}}\n```\n{{</* y */>}}"},
+	}
+	for _, tt := range tests {
+		if got := escapeShortcodes(tt.content); got != tt.want {
+			t.Errorf("escapeShortcodes(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestShiftHeadings(t *testing.T) {
+	tests := []struct {
+		content string
+		shift   int
+		want    string
+	}{
+		{"# Title\n\n## Part\nText", 1, "## Title\n\n### Part\nText"},
+		{"##### Deep\n###### Deepest", 2, "###### Deep\n###### Deepest"},
+		{"```\n# comment\n```\n# Title", 1, "```\n# comment\n```\n## Title"},
+		{"#tag is not a heading", 1, "#tag is not a heading"},
+	}
+	for _, tt := range tests {
+		if got := shiftHeadings(tt.content, tt.shift); got != tt.want {
+			t.Errorf("shiftHeadings(%q, %d) = %q, want %q", tt.content, tt.shift, got, tt.want)
+		}
+	}
+}
+
+func TestStripTitleHeading(t *testing.T) {
+	tests := []struct {
+		content, title, want string
+		stripped             bool
+	}{
+		{"# My Note\n\nText", "My Note", "Text", true},
+		{"\n# my note \nText", "My Note", "Text", true},
+		{"# Other\n\nText", "My Note", "# Other\n\nText", false},
+		{"## My Note\n\nText", "My Note", "## My Note\n\nText", false},
+		{"Text\n# My Note", "My Note", "Text\n# My Note", false},
+	}
+	for _, tt := range tests {
+		got, stripped := stripTitleHeading(tt.content, tt.title)
+		if got != tt.want || stripped != tt.stripped {
+			t.Errorf("stripTitleHeading(%q, %q) = (%q, %t), want (%q, %t)", tt.content, tt.title, got, stripped, tt.want, tt.stripped)
+		}
+	}
+}
+
+func TestCollapseBlankLines(t *testing.T) {
+	tests := []struct {
+		content, want string
+	}{
+		{"One\n\n\n\nTwo", "One\n\nTwo"},
+		{"One\n  \n\t\nTwo", "One\n  \nTwo"},
+		{"```\ncode\n\n\n\nmore\n```\n\n\nText", "```\ncode\n\n\n\nmore\n```\n\nText"},
+		{"No blanks", "No blanks"},
+	}
+	for _, tt := range tests {
+		if got := collapseBlankLines(tt.content); got != tt.want {
+			t.Errorf("collapseBlankLines(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestExtractInlineField(t *testing.T) {
+	tests := []struct {
+		content, wantContent, wantValue string
+	}{
+		{"published:: 2023-04-01\nText", "Text", "2023-04-01"},
+		{"Written on [published:: 2023-04-01] at home", "Written on at home", "2023-04-01"},
+		{"published:: first\npublished:: second\nText", "Text", "first"},
+		{"```\npublished:: 2023-04-01\n```", "```\npublished:: 2023-04-01\n```", ""},
+		{"unpublished:: 2023-04-01", "unpublished:: 2023-04-01", ""},
+	}
+	for _, tt := range tests {
+		content, value := extractInlineField(tt.content, "published")
+		if content != tt.wantContent || value != tt.wantValue {
+			t.Errorf("extractInlineField(%q) = (%q, %q), want (%q, %q)", tt.content, content, value, tt.wantContent, tt.wantValue)
+		}
+	}
+}
+
+func TestFirstH1(t *testing.T) {
+	tests := []struct {
+		content, want string
+		ok            bool
+	}{
+		{"Intro\n\n# Title\n\n# Second", "Title", true},
+		{"## Part\n# Title ", "Title", true},
+		{"```\n# comment\n```\n# Title", "Title", true},
+		{"## Only subheadings", "", false},
+		{"#tag", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := firstH1(tt.content); got != tt.want || ok != tt.ok {
+			t.Errorf("firstH1(%q) = (%q, %t), want (%q, %t)", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAutolinkURLs(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"See https://example.com.", "See <https://example.com>."},
+		{"[site](https://example.com) and http://a.org/x", "[site](https://example.com) and <http://a.org/x>"},
+		{"<https://example.com> stays", "<https://example.com> stays"},
+		{"`https://example.com` in code", "`https://example.com` in code"},
+		{"{{< ref \"https://example.com\" >}}", "{{< ref \"https://example.com\" >}}"},
+	}
+	for _, tt := range tests {
+		if got := autolinkURLs(tt.input); got != tt.want {
+			t.Errorf("autolinkURLs(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestStripBlockIDs(t *testing.T) {
+	tests := []struct {
+		input   string
+		anchors bool
+		want    string
+	}{
+		{"A paragraph ^para1\nNext", false, "A paragraph\nNext"},
+		{"- item\n- item\n\n^list-1\nAfter", false, "- item\n- item\n\nAfter"},
+		{"A paragraph ^Para1", true, `A paragraph <span id="block-para1"></span>`},
+		{"^list-1", true, `<span id="block-list-1"></span>`},
+		{"```\ncode ^keep\n```", false, "```\ncode ^keep\n```"},
+		{"2^10 is not a block", false, "2^10 is not a block"},
+	}
+	for _, tt := range tests {
+		if got := stripBlockIDs(tt.input, tt.anchors); got != tt.want {
+			t.Errorf("stripBlockIDs(%q, %t) = %q, want %q", tt.input, tt.anchors, got, tt.want)
+		}
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"inline", "Visible %%hidden%% text", "Visible  text"},
+		{"whole line", "Before\n%%note to self%%\nAfter", "Before\nAfter"},
+		{"multi-line", "Before\n%%\nhidden\nlines\n%%\nAfter", "Before\nAfter"},
+		{"unclosed", "Before\n%% draft\nrest", "Before"},
+		{"inline code", "Use `%%x%%` here", "Use `%%x%%` here"},
+		{"code block", "```\n%%kept%%\n```", "```\n%%kept%%\n```"},
+	}
+	for _, tt := range tests {
+		if got := stripComments(tt.input); got != tt.want {
+			t.Errorf("%s: stripComments(%q) = %q, want %q", tt.name, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestConvertHighlights(t *testing.T) {
+	tests := []struct {
+		input, style, want string
+	}{
+		{"A ==key point== here", "mark", "A <mark>key point</mark> here"},
+		{"==x==", "shortcode:hl", "{{< hl >}}x{{< /hl >}}"},
+		{"a == b == c", "mark", "a == b == c"},
+		{"`==code==` and ==text==", "mark", "`==code==` and <mark>text</mark>"},
+	}
+	for _, tt := range tests {
+		if got := convertHighlights(tt.input, tt.style); got != tt.want {
+			t.Errorf("convertHighlights(%q, %q) = %q, want %q", tt.input, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestSummaryText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		words   int
+		want    string
+	}{
+		{"first paragraph", "# Title\n\nFirst line\nsecond line.\n\nNext paragraph.", 0, "First line second line."},
+		{"markup", "Read **bold** and [[Other Note|the note]], [site](https://example.com) and ==mark== #go.", 0, "Read bold and the note, site and mark."},
+		{"skips blocks", "```\ncode\n```\n> quote\n\n| a | b |\n\n![[pic.png]]\n\nText ^block", 0, "Text"},
+		{"list", "- one\n- [ ] two", 0, "one two"},
+		{"truncate", "One two three four five.", 3, "One two three…"},
+		{"empty", "# Only heading", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := summaryText(tt.content, tt.words); got != tt.want {
+			t.Errorf("%s: summaryText(%q, %d) = %q, want %q", tt.name, tt.content, tt.words, got, tt.want)
+		}
+	}
+}
+
+func TestInsertMoreMarker(t *testing.T) {
+	tests := []struct {
+		name, content, position, want string
+		inserted                      bool
+	}{
+		{"paragraph", "First.\nStill first.\n\nSecond.", "paragraph", "First.\nStill first.\n\n<!--more-->\n\nSecond.", true},
+		{"paragraph after heading", "# Title\n\nFirst.", "paragraph", "# Title\n\nFirst.\n\n<!--more-->", true},
+		{"heading", "## Intro\n\nText.\n\n## Next\n\nMore.", "heading:Intro", "## Intro\n\nText.\n\n<!--more-->\n\n## Next\n\nMore.", true},
+		{"heading keeps subheadings", "## Intro\n\nText.\n\n### Detail\n\nDetail.\n\n## Next", "heading:intro", "## Intro\n\nText.\n\n### Detail\n\nDetail.\n\n<!--more-->\n\n## Next", true},
+		{"last section", "## Intro\n\nText.", "heading:Intro", "## Intro\n\nText.\n\n<!--more-->", true},
+		{"missing heading", "## Intro\n\nText.", "heading:Other", "## Intro\n\nText.", false},
+		{"marker present", "First.\n\n<!--more-->\n\nSecond.", "paragraph", "First.\n\n<!--more-->\n\nSecond.", false},
+		{"code only", "```\ncode\n```", "paragraph", "```\ncode\n```", false},
+	}
+	for _, tt := range tests {
+		got, inserted := insertMoreMarker(tt.content, tt.position)
+		if got != tt.want || inserted != tt.inserted {
+			t.Errorf("%s: insertMoreMarker(%q, %q) = (%q, %t), want (%q, %t)", tt.name, tt.content, tt.position, got, inserted, tt.want, tt.inserted)
+		}
+	}
+}
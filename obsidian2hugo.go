@@ -2,14 +2,21 @@ package main
 
 import (
 	"crypto/md5"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -17,14 +24,106 @@ import (
 
 // Аргументы командной строки
 var (
-	notesDir        = flag.String("notes-dir", "", "Абсолютный путь к каталогу с вашими заметками Obsidian (.md файлы).")
-	attachmentsDir  = flag.String("attachments-dir", "", "Абсолютный путь к каталогу, где Obsidian хранит все вложения.")
-	hugoPostsDir    = flag.String("hugo-posts-dir", "", "Абсолютный путь к целевому каталогу для контента Hugo.")
-	filterTag       = flag.String("filter-tag", "blog", "Тег, по которому отбираются заметки.")
-	removeFilterTag = flag.Bool("remove-filter-tag", false, "Если указано, тег фильтрации будет удален из финального списка тегов.")
-	logLevel        = flag.String("log-level", "INFO", "Уровень логирования (DEBUG, INFO, WARNING, ERROR).")
+	notesDir            = flag.String("notes-dir", "", "Абсолютный путь к каталогу с вашими заметками Obsidian (.md файлы), к отдельной заметке или шаблон пути (например, /vault/Blog/*.md).")
+	hugoPostsDir        = flag.String("hugo-posts-dir", "", "Абсолютный путь к целевому каталогу для контента Hugo.")
+	removeFilterTag     = flag.Bool("remove-filter-tag", false, "Если указано, тег фильтрации будет удален из финального списка тегов.")
+	logLevel            = flag.String("log-level", "INFO", "Уровень логирования (DEBUG, INFO, WARNING, ERROR).")
+	noDefaultExcl       = flag.Bool("no-default-excludes", false, "Если указано, служебные каталоги Obsidian (.obsidian, .trash) не исключаются автоматически.")
+	tagsFromPath        = flag.Bool("tags-from-path", false, "Если указано, имена каталогов на пути к заметке (относительно --notes-dir) добавляются в список тегов.")
+	attachmentNaming    = flag.String("attachment-naming", "hash", "Схема именования вложений в Page Bundle: hash (MD5-хэш), note-indexed (имя поста в виде slug и порядковый номер), original (исходное имя файла) или slug (исходное имя в виде slug).")
+	escapeShortcode     = flag.Bool("escape-shortcodes", false, "Если указано, шорткоды Hugo ({{< >}}, {{% %}}) в тексте заметки экранируются и выводятся как текст.")
+	fileList            = flag.String("file-list", "", "Путь к файлу со списком заметок для обработки (по одной на строку, абсолютные пути или относительно --notes-dir). Обход каталога при этом не выполняется.")
+	filterExpr          = flag.String("filter", "", "Логическое выражение над тегами для отбора заметок, например 'blog AND NOT draft' или 'blog && !private'. Заменяет --filter-tag.")
+	filterProperty      = flag.String("filter-property", "", "Отбирать заметки по свойствам front matter: условия свойство=значение через запятую (например, publish=true). Без явных --filter-tag и --filter заменяет отбор по тегам.")
+	nestedCategories    = flag.Bool("nested-tag-categories", false, "Переносить вложенные теги отбора (blog/golang при --filter-tag blog) из тегов в свойство 'categories' (golang).")
+	noFilter            = flag.Bool("no-filter", false, "Если указано, обрабатываются все заметки, независимо от тега фильтрации.")
+	widthUnit           = flag.String("width-unit", "px", "Как выводить размер из встраиваний вида ![[img.png|300]] и ![[img.png|50%]]: px (атрибут width), percent (CSS-стиль width) или class (CSS-класс).")
+	pageType            = flag.String("type", "", "Значение свойства 'type', которое получают заметки без него.")
+	setTypeFrom         = flag.String("set-type-from", "", "Источник свойства 'type' для заметок без него: folder (каталог верхнего уровня) или tag (по --type-map).")
+	typeMap             = flag.String("type-map", "", "Соответствие тегов и типов для --set-type-from=tag в формате тег=тип через запятую.")
+	summaryKey          = flag.String("summary-key", "", "Свойство (например, description или summary), которое заполняется первым абзацем заметки, если его нет. По умолчанию не заполняется.")
+	summaryWords        = flag.Int("summary-words", 0, "Сколько слов первого абзаца оставить в --summary-key. 0 — весь абзац.")
+	insertMoreAfter     = flag.String("insert-more-after", "", "Куда вставить маркер <!--more-->, если его нет в заметке: paragraph (после первого абзаца) или heading:Заголовок (в конце раздела).")
+	attachmentPrefix    = flag.String("attachment-url-prefix", "", "Префикс для ссылок на вложения (например, https://cdn.example.com/media/). По умолчанию ссылки ведут на файлы внутри Page Bundle.")
+	followLinks         = flag.Bool("follow-links", false, "Если указано, заметки без тега фильтрации, на которые ссылаются опубликованные заметки, тоже публикуются.")
+	protectKeys         = flag.String("protect-keys", "", "Ключи front matter через запятую, значения которых в уже сгенерированном index.md не перезаписываются.")
+	headingShift        = flag.Int("heading-shift", 0, "На сколько уровней понизить заголовки в тексте заметки (H1 → H2 при 1). Уровень не превышает H6.")
+	stripTitleH1        = flag.Bool("strip-title-heading", false, "Если указано, заголовок первого уровня в начале заметки удаляется, если он совпадает с title.")
+	outputTmplPath      = flag.String("output-template", "", "Путь к шаблону Go (text/template) для итогового файла. В шаблоне доступны .FrontMatter, .YAML и .Content.")
+	calloutShortcode    = flag.String("callout-shortcode", "", "Имя парного шорткода Hugo, в который преобразуются выноски Obsidian (> [!note]). По умолчанию выноски не преобразуются.")
+	calloutMap          = flag.String("callout-map", "", "Соответствие типов выносок Obsidian и типов шорткода в формате note=info,warning=warn через запятую.")
+	calloutHTML         = flag.Bool("callout-html", false, "Если указано, выноски Obsidian преобразуются в блоки HTML в стиле Bootstrap (<div class=\"alert alert-тип\">, сворачиваемые — <details>).")
+	calloutDefault      = flag.String("callout-default", "note", "Тип шорткода для выносок неизвестного Obsidian типа, которого нет в --callout-map. Пустое значение оставляет такие выноски обычной цитатой.")
+	epochKeys           = flag.String("epoch-keys", "", "Ключи front matter через запятую, содержащие время в секундах или миллисекундах Unix. Значения переводятся в RFC3339; запись created=date переносит значение в другой ключ.")
+	maxMemory           = flag.Int64("max-memory", 0, "Ограничение на суммарный размер заметок в памяти, МБ. 0 — без ограничения.")
+	layout              = flag.String("layout", "bundle", "Раскладка постов: bundle (каталог с index.md и вложениями) или flat (файл <имя>.md, вложения рядом в каталоге постов).")
+	postsURL            = flag.String("posts-url", "", "Адрес раздела с постами на сайте для ссылок в раскладке flat. По умолчанию: /<имя каталога --hugo-posts-dir>/.")
+	uglyURLs            = flag.Bool("ugly-urls", false, "Если указано, ссылки на посты в раскладке flat имеют вид <имя>.html (как при uglyURLs в Hugo).")
+	collapseBlanks      = flag.Bool("collapse-blank-lines", false, "Если указано, несколько пустых строк подряд вне блоков кода сокращаются до одной.")
+	strict              = flag.Bool("strict", false, "Если указано, ошибки в отдельных заметках (front matter, вложения, конфликты имен, ссылки) дают ненулевой код завершения.")
+	draftMode           = flag.String("drafts", "keep", "Что делать с черновиками (draft: true, status: draft или тег draft): keep (оставить свойства как есть), mark (выставить draft: true), publish (выставить draft: false) или skip (не публиковать).")
+	draftAsTag          = flag.String("draft-as-tag", "", "Если указано, черновики (draft: true, status: draft или тег draft) публикуются с этим тегом и draft: false.")
+	createdKeys         = flag.String("created-keys", "created,date created,created_at,creation date", "Свойства с датой создания заметки через запятую: первое заданное становится свойством 'date', если его нет. Пустое значение отключает.")
+	modifiedKeys        = flag.String("modified-keys", "modified,updated,date modified,last modified", "Свойства с датой изменения заметки через запятую: первое заданное становится свойством 'lastmod', если его нет. Пустое значение отключает.")
+	dateFromFilename    = flag.Bool("date-from-filename", false, "Брать свойство 'date' из даты в начале имени файла (2024-03-15 Заметка.md) и убирать эту дату из заголовка и имени каталога поста.")
+	dateSource          = flag.String("date-source", "property,previous,now", "Откуда брать свойство 'date', через запятую в порядке приоритета: property (свойства заметки), previous (дата из уже сгенерированного поста), mtime (время изменения файла), birth (время создания файла, если система его хранит), now (время запуска).")
+	dateFromInline      = flag.String("date-from-inline", "", "Имя inline-поля Dataview (например, published для 'published:: 2023-04-01'), из которого берется свойство 'date'. Поле удаляется из текста.")
+	splitByHeadingFlag  = flag.String("split-by-heading", "", "Уровень заголовков (h1..h6), по которым заметка делится на отдельные страницы внутри каталога поста. Только для раскладки bundle.")
+	tagPagesDir         = flag.String("generate-tag-pages", "", "Каталог таксономии (например, content/tags), в котором для каждого тега опубликованных заметок создается страница _index.md. Существующие страницы не меняются.")
+	stripEmptyKeys      = flag.Bool("strip-empty-frontmatter-keys", false, "Удалять из front matter ключи с пустыми значениями (null, пустая строка, пустой список), кроме title, date, tags, type и draft.")
+	attachmentMode      = flag.String("attachment-mode", "copy", "Что делать с вложениями: copy (копировать в каталог поста) или manifest (только записать пары источник-назначение в --attachment-manifest).")
+	manifestPath        = flag.String("attachment-manifest", "attachments.manifest", "Файл манифеста вложений для --attachment-mode=manifest.")
+	publishOverrideKey  = flag.String("publish-override-key", "", "Свойство, которое переопределяет фильтр: true публикует заметку независимо от тегов, false — никогда не публикует. По умолчанию проверка отключена.")
+	attachmentSharding  = flag.Bool("attachment-sharding", false, "Раскладывать вложения с именами-хэшами по подкаталогам по первым двум символам хэша (ab/abcd….png).")
+	preserveMtime       = flag.Bool("preserve-note-mtime", false, "Устанавливать итоговым файлам время изменения исходной заметки.")
+	stripTagPrefix      = flag.String("strip-tag-prefix", "", "Префиксы тегов через запятую (например, status/,area/): такие теги удаляются из итогового списка тегов, но учитываются при фильтрации.")
+	coverKey            = flag.String("cover-key", "", "Свойство для обложки поста (например, cover.image; точка означает вложенный ключ), которое заполняется адресом вложения из --cover-property или первой встроенной картинки. По умолчанию не заполняется.")
+	coverProperty       = flag.String("cover-property", "cover", "Свойство заметки со ссылкой на вложение-обложку (pic.png или [[pic.png]]) для --cover-key.")
+	emitResources       = flag.Bool("emit-resource-metadata", false, "Добавлять в свойство 'resources' записи (src и title) для скопированных вложений. Только для раскладки bundle.")
+	inlineTags          = flag.String("inline-tags", "", "Что делать с тегами #тег в тексте заметки: link (заменять ссылками на страницы тегов). По умолчанию теги остаются как есть.")
+	scanInlineTags      = flag.String("scan-inline-tags", "", "Учитывать теги #тег из текста заметки: filter (только при отборе заметок) или merge (также добавлять их в свойство 'tags'). По умолчанию учитывается только свойство 'tags'.")
+	tagsURL             = flag.String("tags-url", "/tags/", "Адрес раздела тегов на сайте для --inline-tags=link.")
+	unresolvedStyle     = flag.String("unresolved-link-style", "plain", "Как выводить вики-ссылки на ненайденные или неопубликованные заметки: plain (текст ссылки), keep (ссылка [[...]] без изменений) или marker (текст в <span class=\"broken-link\">).")
+	unresolvedClass     = flag.String("unresolved-link-class", "broken-link", "CSS-класс элемента <span> для --unresolved-link-style=marker.")
+	attachmentCachePath = flag.String("attachment-cache", "", "Файл, в котором запоминаются вложения каждого Page Bundle. Если указан, вложения, на которые заметка больше не ссылается, удаляются из ее каталога.")
+	titleFromH1         = flag.Bool("title-from-h1", false, "Для заметок без свойства 'title' брать его из первого заголовка первого уровня, а не из имени файла.")
+	resourcesKey        = flag.String("resources-key", "", "Свойство со списком шаблонов файлов (например, data/*.csv), которые копируются в каталог поста под исходными именами, даже если на них нет ссылок в тексте. По умолчанию отключено.")
+	renameKeys          = flag.String("rename-keys", "", "Переименование свойств в ключи, которые ожидает тема Hugo, в формате свойство=ключ через запятую (например, created=date,topic=categories). Уже заданный ключ не перезаписывается.")
+	copyKeys            = flag.String("copy-keys", "", "То же, что --rename-keys, но исходное свойство сохраняется (например, cover=images).")
+	aliasesMode         = flag.String("aliases", "keep", "Что делать со свойством 'aliases' (псевдонимы Obsidian, которые Hugo считает адресами перенаправлений): keep (оставить), drop (удалить), redirect (превратить в адреса вида /posts/псевдоним/) или rename:ключ (перенести в другое свойство).")
+	warnReserved        = flag.Bool("warn-reserved-params", false, "Предупреждать о подозрительных значениях свойств, имеющих особое значение для Hugo (url, slug, layout, type, weight, date, aliases и др.).")
+	autolinkURLsFlag    = flag.Bool("autolink-urls", false, "Оборачивать адреса http(s) в тексте, не оформленные ссылками, в угловые скобки, чтобы они были кликабельны при любых настройках Hugo.")
+	dumpConfig          = flag.Bool("dump-config", false, "Вывести итоговые значения всех параметров в формате YAML и завершить работу.")
+	linkStyle           = flag.String("link-style", "relref", "Как выводить ссылки на опубликованные заметки: relref (шорткод Hugo, в раскладке flat — адрес в разделе постов) или relative (относительный путь ../заметка/).")
+	frontMatterFormat   = flag.String("front-matter-format", "yaml", "Формат front matter итоговых файлов: yaml (---), toml (+++) или json.")
+	concurrency         = flag.Int("concurrency", runtime.NumCPU(), "Сколько заметок обрабатывать одновременно.")
+	nameFromProperties  = flag.Bool("bundle-name-from-properties", false, "Называть каталоги постов по свойству 'slug' или последней части свойства 'url', если они заданы, чтобы переименование заметки не меняло адрес поста.")
+	slugFromTitle       = flag.Bool("slug-from-title", false, "С --slugify называть каталоги постов по свойству 'title' заметки, а не по имени файла.")
+	slugifyBundles      = flag.Bool("slugify", false, "Называть каталоги постов по имени заметки в нижнем регистре, латиницей и с дефисами (\"Моя заметка\" → moya-zametka) или по свойству 'slug'. Свойство 'title' не меняется.")
+	configPath          = flag.String("config", "", "Файл конфигурации (YAML или JSON) со значениями параметров; параметры командной строки имеют приоритет.")
+	stripBlockIDsFlag   = flag.Bool("strip-block-ids", false, "Если указано, идентификаторы блоков Obsidian (^id) удаляются из текста.")
+	blockAnchors        = flag.Bool("block-anchors", false, "Если указано, на месте идентификаторов блоков (^id) ставятся HTML-якоря, и ссылки [[Заметка#^id]] ведут к блоку.")
+	watchMode           = flag.Bool("watch", false, "Если указано, после конвертации программа продолжает работать и заново конвертирует измененные заметки.")
+	cleanStale          = flag.Bool("clean", false, "Если указано, после конвертации удаляются посты из --state-file, для которых больше нет публикуемой заметки (заметка удалена или потеряла тег фильтрации). Требует --state-file.")
+	stateFile           = flag.String("state-file", "", "Файл состояния (например, .obsidian2hugo-state.json). Если указан, заметки, которые не менялись с прошлого запуска, не перезаписываются.")
+	dryRun              = flag.Bool("dry-run", false, "Если указано, ничего не записывается: выводится план — какие посты будут созданы или обновлены и какие вложения скопированы.")
+	highlightStyle      = flag.String("highlight", "", "Во что преобразовывать выделения ==текст==: mark (тег <mark>) или shortcode:имя (парный шорткод). По умолчанию не преобразуются.")
+	keepComments        = flag.Bool("keep-comments", false, "Если указано, комментарии Obsidian (%%...%%) не удаляются из текста.")
+	keepKeys            = flag.String("keep-keys", "", "Ключи front matter через запятую, которые попадают в пост; остальные свойства заметки удаляются. Можно использовать шаблоны (например, cover*). Свойства title, date, tags, type и draft сохраняются всегда.")
+	dropKeys            = flag.String("drop-keys", "", "Ключи front matter через запятую, которые удаляются из поста (например, cssclasses,kanban-plugin). Можно использовать шаблоны (например, dg-*).")
+	keepEphemeral       = flag.Bool("keep-ephemeral", false, "Если указано, служебные ключи Obsidian (position, cursor и т.п.) не удаляются из front matter.")
 )
 
+// ephemeralKeys — служебные ключи, которые Obsidian и его плагины записывают во front matter
+// (положение курсора, прокрутка, режим отображения). В опубликованном контенте они не нужны.
+var ephemeralKeys = []string{
+	"position",
+	"cursor",
+	"scroll",
+	"obsidianUIMode",
+	"obsidianEditingMode",
+}
+
 // Пользовательский тип для обработки списка строковых значений из флагов
 type stringSlice []string
 
@@ -37,8 +136,134 @@ func (s *stringSlice) Set(value string) error {
 	return nil
 }
 
+// Get возвращает значения списком, чтобы --dump-config выводил их как список YAML.
+func (s *stringSlice) Get() interface{} {
+	return []string(*s)
+}
+
+func (s *stringSlice) reset() {
+	*s = nil
+}
+
 var excludeDirs stringSlice
 
+// attachmentsDirs — каталоги вложений (--attachments-dir можно указать несколько раз).
+var attachmentsDirs stringSlice
+
+// defaultProperties — свойства по умолчанию для всех постов (--front-matter-defaults).
+var defaultProperties frontMatterDefaults
+
+// tagList — список тегов через запятую, который можно задать несколько раз.
+// Первое заданное значение заменяет значение по умолчанию, следующие — дополняют его.
+type tagList struct {
+	tags []string
+	set  bool
+}
+
+func (l *tagList) String() string {
+	return strings.Join(l.tags, ",")
+}
+
+func (l *tagList) Set(value string) error {
+	if !l.set {
+		l.tags, l.set = nil, true
+	}
+	l.tags = append(l.tags, splitList(value)...)
+	return nil
+}
+
+func (l *tagList) reset() {
+	l.tags, l.set = nil, false
+}
+
+// filterTags — теги, по которым отбираются заметки (--filter-tag).
+var filterTags = tagList{tags: []string{"blog"}}
+
+// matchFilterTag возвращает первый тег заметки, подходящий под один из тегов --filter-tag.
+func matchFilterTag(tagsList []string) (string, bool) {
+	for _, tag := range filterTags.tags {
+		if noteTag, ok := findNestedTag(tagsList, tag); ok {
+			return noteTag, true
+		}
+	}
+	return "", false
+}
+
+// findNestedTag ищет среди тегов tagsList тег tag или вложенный в него, как в поиске
+// Obsidian: тегу blog подходят blog и blog/golang.
+func findNestedTag(tagsList []string, tag string) (string, bool) {
+	for _, t := range tagsList {
+		if t == tag || strings.HasPrefix(t, tag+"/") {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// nestedTagsToCategories переносит вложенные теги отбора (blog/golang) из тегов
+// заметки в свойство 'categories' (golang).
+func nestedTagsToCategories(properties map[string]interface{}) {
+	categories := extractStringList(properties["categories"])
+	var tags []string
+	moved := false
+	for _, tag := range extractTags(properties) {
+		category := ""
+		for _, parent := range selectionTags() {
+			if strings.HasPrefix(tag, parent+"/") {
+				category = strings.TrimPrefix(tag, parent+"/")
+				break
+			}
+		}
+		if category == "" {
+			tags = append(tags, tag)
+			continue
+		}
+		moved = true
+		if !hasTag(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	if !moved {
+		return
+	}
+	if len(tags) > 0 {
+		properties["tags"] = tags
+	} else {
+		delete(properties, "tags")
+	}
+	properties["categories"] = categories
+	logf(DEBUG, "Вложенные теги перенесены в категории: %v", categories)
+}
+
+// splitList разбирает список значений через запятую, отбрасывая пустые элементы.
+func splitList(list string) []string {
+	var result []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseKeyValueList разбирает список вида "a=b,c=d" в отображение.
+// Пары без знака '=' пропускаются.
+func parseKeyValueList(list string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+// defaultExcludeDirs — каталоги хранилища, которые исключаются из сканирования по умолчанию:
+// настройки и плагины Obsidian, а также корзина с удаленными заметками.
+var defaultExcludeDirs = []string{".obsidian", ".trash"}
+
 // Уровни логирования
 type LogLevel int
 
@@ -99,304 +324,1760 @@ var (
 	frontMatterPattern = regexp.MustCompile(`(?s)^---\s*\n(.*?)\n---\s*`)
 	// Паттерн для поиска вложений Obsidian.
 	attachmentPattern = regexp.MustCompile(`!\[\[(.*?)\]\]`)
+	// Паттерн для размера изображения во встраивании: 300, 300x200 или 50%.
+	imageSizePattern = regexp.MustCompile(`^(\d+)(?:x(\d+)|(%))?$`)
 	// Паттерн для поиска вики-ссылок (не должен захватывать вложения).
 	wikilinkPattern = regexp.MustCompile(`\[\[(.*?)\]\]`)
 )
 
 func main() {
+	cmd, args := selectCommand(os.Args[1:])
+
 	// Описание для --exclude-dirs
 	flag.Var(&excludeDirs, "exclude-dirs", "Список имен каталогов для исключения из сканирования (через пробел).")
+	flag.Var(&filterTags, "filter-tag", "Тег, по которому отбираются заметки. Можно указать несколько тегов через запятую или повторить параметр: отбираются заметки с любым из них.")
+	flag.Var(&defaultProperties, "front-matter-defaults", "Свойства, которые получает каждый пост, если их нет в заметке, в виде отображения YAML (например, '{author: Иван, showToc: true}'). Параметр можно повторить.")
+	flag.Var(&attachmentsDirs, "attachments-dir", "Абсолютный путь к каталогу, где Obsidian хранит вложения. Можно указать несколько раз: каталоги проверяются по порядку.")
+	flag.IntVar(concurrency, "workers", *concurrency, "То же, что --concurrency.")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Использование: %s [аргументы]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Использование: %s [команда] [аргументы]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Конвертирует заметки Obsidian в формат Hugo Page Bundle.\n\n")
-		fmt.Fprintf(os.Stderr, "Аргументы:\n")
+		fmt.Fprintf(os.Stderr, "Команды:\n")
+		printCommands(os.Stderr)
+		fmt.Fprintf(os.Stderr, "\nАргументы:\n")
 		flag.PrintDefaults()
 	}
-	flag.Parse()
+	flag.CommandLine.Parse(args)
+	if explicit := len(args) < len(os.Args)-1; explicit && flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Лишние аргументы после команды %s: %s\n", cmd.name, strings.Join(flag.Args(), " "))
+		flag.Usage()
+		os.Exit(exitUsage)
+	} else if flag.NArg() > 0 {
+		// Подкоманда может идти и после параметров: o2h --notes-dir ... validate --strict
+		positional, rest := selectCommand(flag.Args())
+		if positional == commands[0] && len(rest) == flag.NArg() {
+			fmt.Fprintf(os.Stderr, "Неизвестная команда: %s\n", flag.Arg(0))
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		// flag.Parse останавливается на подкоманде, параметры после нее разбираются отдельно
+		flag.CommandLine.Parse(rest)
+		if flag.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "Лишние аргументы после команды %s: %s\n", positional.name, strings.Join(flag.Args(), " "))
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		cmd = positional
+	}
+	if cmd.standalone {
+		os.Exit(cmd.run())
+	}
+
+	// Приоритет значений: командная строка, переменные окружения, файл конфигурации.
+	setOnCommandLine := commandLineFlags()
+	if path, ok := os.LookupEnv(envName("config")); ok && *configPath == "" {
+		*configPath = path
+	}
+	if *configPath != "" {
+		if err := loadConfig(*configPath, setOnCommandLine); err != nil {
+			logf(ERROR, "Ошибка: %v", err)
+			os.Exit(exitFatal)
+		}
+	}
+	if err := loadEnv(setOnCommandLine); err != nil {
+		logf(ERROR, "Ошибка: %v", err)
+		os.Exit(exitFatal)
+	}
 
 	setLogLevel(*logLevel)
 
-	if *notesDir == "" || *attachmentsDir == "" || *hugoPostsDir == "" {
-		flag.Usage()
-		logf(ERROR, "Ошибка: Аргументы --notes-dir, --attachments-dir и --hugo-posts-dir являются обязательными.")
-		os.Exit(1)
+	if *dumpConfig {
+		if err := printConfig(os.Stdout); err != nil {
+			logf(ERROR, "Ошибка: %v", err)
+			os.Exit(exitFatal)
+		}
+		os.Exit(exitOK)
 	}
 
-	if err := processNotes(); err != nil {
-		logf(ERROR, "Не удалось обработать заметки: %v", err)
-		os.Exit(1)
+	if *notesDir == "" && cmd.readOnly {
+		flag.Usage()
+		logf(ERROR, "Ошибка: Аргумент --notes-dir является обязательным.")
+		os.Exit(exitFatal)
+	}
+	if (*notesDir == "" || *hugoPostsDir == "") && !cmd.readOnly {
+		flag.Usage()
+		logf(ERROR, "Ошибка: Аргументы --notes-dir и --hugo-posts-dir являются обязательными.")
+		os.Exit(exitFatal)
 	}
-}
 
-// processNotes сканирует и обрабатывает все заметки.
-func processNotes() error {
-	logf(INFO, "Рекурсивно сканирую заметки в: %s", *notesDir)
-	if len(excludeDirs) > 0 {
-		logf(INFO, "Исключаю каталоги: %v", excludeDirs)
+	loadVaultSettings()
+	if len(attachmentsDirs) == 0 && vaultRoot == "" {
+		flag.Usage()
+		logf(ERROR, "Ошибка: Аргумент --attachments-dir обязателен, если заметки не лежат в хранилище Obsidian (каталоге с .obsidian).")
+		os.Exit(exitFatal)
 	}
 
-	absExcludePaths := make(map[string]struct{})
-	for _, dir := range excludeDirs {
-		absPath, err := filepath.Abs(filepath.Join(*notesDir, dir))
-		if err == nil {
-			absExcludePaths[absPath] = struct{}{}
+	if *filterExpr != "" {
+		expr, err := parseTagExpr(*filterExpr)
+		if err != nil {
+			logf(ERROR, "Ошибка: Некорректное выражение --filter '%s': %v", *filterExpr, err)
+			os.Exit(exitFatal)
 		}
+		noteFilter = expr
 	}
 
-	err := filepath.Walk(*notesDir, func(path string, info os.FileInfo, err error) error {
+	if *filterProperty != "" {
+		conditions, err := parsePropertyFilter(*filterProperty)
 		if err != nil {
-			return err
+			logf(ERROR, "Ошибка: Некорректное значение --filter-property: %v", err)
+			os.Exit(exitFatal)
 		}
+		propertyFilter = conditions
+	}
 
-		// Пропускаем исключенные каталоги
-		if info.IsDir() {
-			if _, excluded := absExcludePaths[path]; excluded {
-				logf(DEBUG, "Пропускаю исключенный каталог: %s", path)
-				return filepath.SkipDir
-			}
-			return nil
+	for _, mapping := range []struct {
+		name, list string
+		keys       *map[string]string
+	}{{"rename-keys", *renameKeys, &renameKeyMap}, {"copy-keys", *copyKeys, &copyKeyMap}} {
+		keys, err := parseKeyMapping(mapping.list)
+		if err != nil {
+			logf(ERROR, "Ошибка: Некорректное значение --%s: %v", mapping.name, err)
+			os.Exit(exitFatal)
 		}
+		*mapping.keys = keys
+	}
 
-		// Обрабатываем только .md файлы
-		if !strings.HasSuffix(info.Name(), ".md") {
-			return nil
+	if *summaryWords < 0 {
+		logf(ERROR, "Ошибка: --summary-words не может быть отрицательным.")
+		os.Exit(exitFatal)
+	}
+
+	for _, pattern := range append(splitList(*keepKeys), splitList(*dropKeys)...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			logf(ERROR, "Ошибка: Некорректный шаблон ключа '%s' в --keep-keys или --drop-keys.", pattern)
+			os.Exit(exitFatal)
 		}
+	}
 
-		logf(INFO, "--- Проверяю заметку: %s ---", strings.TrimPrefix(path, *notesDir+"/"))
-		return processNoteFile(path)
-	})
+	if (*cleanStale || cmd.name == "clean") && *stateFile == "" {
+		logf(ERROR, "Ошибка: %v.", errCleanNeedsState)
+		os.Exit(exitFatal)
+	}
 
-	if err != nil {
-		return err
+	if *watchMode && *dryRun {
+		logf(ERROR, "Ошибка: --watch несовместим с --dry-run.")
+		os.Exit(exitFatal)
 	}
 
-	logf(INFO, "--- Обработка завершена. ---")
-	return nil
-}
+	switch *attachmentNaming {
+	case "hash", "note-indexed", "original", "slug":
+	default:
+		logf(ERROR, "Ошибка: Неизвестная схема именования вложений '%s'.", *attachmentNaming)
+		os.Exit(exitFatal)
+	}
 
-// processNoteFile обрабатывает один файл заметки.
-func processNoteFile(path string) error {
-	contentBytes, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("не удалось прочитать заметку %s: %w", path, err)
+	switch *setTypeFrom {
+	case "", "folder", "tag":
+	default:
+		logf(ERROR, "Ошибка: Неизвестный источник свойства 'type' '%s'.", *setTypeFrom)
+		os.Exit(exitFatal)
 	}
-	fullContent := string(contentBytes)
+	typeMapping = parseKeyValueList(*typeMap)
 
-	properties, content, err := parseNoteContent(fullContent)
-	if err != nil {
-		logf(WARNING, "Не удалось разобрать front matter для %s: %v. Пропускаю.", path, err)
-		return nil // Не прерываем весь процесс из-за одной плохой заметки
+	switch *layout {
+	case "bundle", "flat":
+	default:
+		logf(ERROR, "Ошибка: Неизвестная раскладка постов '%s'.", *layout)
+		os.Exit(exitFatal)
 	}
 
-	// --- ПРОВЕРКА ТЕГА ---
-	tags, ok := properties["tags"]
-	if !ok {
-		logf(DEBUG, "Пропускаю заметку '%s', так как у нее нет тегов.", filepath.Base(path))
-		return nil
+	switch *widthUnit {
+	case "px", "percent", "class":
+	default:
+		logf(ERROR, "Ошибка: Неизвестная единица ширины изображений '%s'.", *widthUnit)
+		os.Exit(exitFatal)
 	}
 
-	var tagsList []string
-	switch v := tags.(type) {
-	case []interface{}:
-		for _, t := range v {
-			if tagStr, ok := t.(string); ok {
-				tagsList = append(tagsList, tagStr)
-			}
-		}
-	case string:
-		for _, tagStr := range strings.Split(v, ",") {
-			tagsList = append(tagsList, strings.TrimSpace(tagStr))
-		}
+	noteMemory = newMemoryLimiter(*maxMemory * 1024 * 1024)
+
+	if *attachmentSharding && *attachmentNaming != "hash" {
+		logf(WARNING, "--attachment-sharding применяется только к схеме именования hash и будет проигнорирован.")
 	}
 
-	found := false
-	for _, t := range tagsList {
-		if t == *filterTag {
-			found = true
-			break
-		}
+	if _, ok := frontMatterSerializers[*frontMatterFormat]; !ok {
+		logf(ERROR, "Ошибка: Неизвестный формат front matter '%s'.", *frontMatterFormat)
+		os.Exit(exitFatal)
+	}
+	if *frontMatterFormat == "toml" && *protectKeys != "" {
+		logf(WARNING, "--protect-keys читает front matter сгенерированных файлов только в форматах YAML и JSON.")
 	}
 
-	if !found {
-		logf(DEBUG, "Пропускаю заметку '%s', так как у нее нет тега '%s'.", filepath.Base(path), *filterTag)
-		return nil
+	switch *linkStyle {
+	case "relref", "relative":
+	default:
+		logf(ERROR, "Ошибка: Неизвестный стиль ссылок '%s'.", *linkStyle)
+		os.Exit(exitFatal)
 	}
 
-	logf(INFO, "Обрабатываю заметку: %s (найден тег '%s')", filepath.Base(path), *filterTag)
+	switch *unresolvedStyle {
+	case "plain", "keep", "marker":
+	default:
+		logf(ERROR, "Ошибка: Неизвестный стиль ненайденных ссылок '%s'.", *unresolvedStyle)
+		os.Exit(exitFatal)
+	}
 
-	// --- ОБНОВЛЕНИЕ ТЕГОВ ---
-	if *removeFilterTag {
-		var updatedTags []string
-		for _, t := range tagsList {
-			if t != *filterTag {
-				updatedTags = append(updatedTags, t)
-			}
-		}
-		if len(updatedTags) > 0 {
-			properties["tags"] = updatedTags
-		} else {
-			delete(properties, "tags")
+	switch *inlineTags {
+	case "", "link":
+	default:
+		logf(ERROR, "Ошибка: Неизвестный режим тегов в тексте '%s'.", *inlineTags)
+		os.Exit(exitFatal)
+	}
+
+	for _, source := range splitList(*dateSource) {
+		if _, ok := dateSources[source]; !ok && source != "property" && source != "previous" {
+			logf(ERROR, "Ошибка: Неизвестный источник даты '%s' в --date-source.", source)
+			os.Exit(exitFatal)
 		}
-		logf(DEBUG, "Удаляю тег '%s' из списка тегов.", *filterTag)
 	}
 
-	// --- ЛОГИКА УПРАВЛЕНИЯ FRONT MATTER ---
-	if _, ok := properties["title"]; !ok {
-		title := strings.TrimSuffix(filepath.Base(path), ".md")
-		properties["title"] = title
-		logf(DEBUG, "Свойство 'title' не найдено. Установлено: '%s'", title)
+	if name, ok := strings.CutPrefix(*aliasesMode, "rename:"); !(ok && name != "") && *aliasesMode != "keep" && *aliasesMode != "drop" && *aliasesMode != "redirect" {
+		logf(ERROR, "Ошибка: Неизвестный режим --aliases '%s'.", *aliasesMode)
+		os.Exit(exitFatal)
 	}
 
-	if _, ok := properties["date"]; !ok {
-		date := time.Now().Format(time.RFC3339)
-		properties["date"] = date
-		logf(DEBUG, "Свойство 'date' не найдено. Установлено: '%s'", date)
+	switch *draftMode {
+	case "keep", "mark", "publish", "skip":
+	default:
+		logf(ERROR, "Ошибка: Неизвестный режим черновиков '%s'.", *draftMode)
+		os.Exit(exitFatal)
 	}
 
-	// --- СОЗДАНИЕ PAGE BUNDLE ---
-	bundleDirName := strings.TrimSuffix(filepath.Base(path), ".md")
-	targetBundleDir := filepath.Join(*hugoPostsDir, bundleDirName)
-	if err := os.MkdirAll(targetBundleDir, 0755); err != nil {
-		return fmt.Errorf("не удалось создать каталог поста %s: %w", targetBundleDir, err)
+	switch *scanInlineTags {
+	case "", "filter", "merge":
+	default:
+		logf(ERROR, "Ошибка: Неизвестный режим --scan-inline-tags '%s'.", *scanInlineTags)
+		os.Exit(exitFatal)
 	}
-	logf(INFO, "Создан/обновлен каталог поста: %s", targetBundleDir)
 
-	// --- ОБРАБОТКА ВЛОЖЕНИЙ ---
-	content, err = processAttachments(content, targetBundleDir)
-	if err != nil {
-		return err
+	if name, ok := strings.CutPrefix(*highlightStyle, "shortcode:"); *highlightStyle != "" && *highlightStyle != "mark" && (!ok || name == "") {
+		logf(ERROR, "Ошибка: Неизвестный способ вывода выделений '%s' (ожидается mark или shortcode:имя).", *highlightStyle)
+		os.Exit(exitFatal)
 	}
 
-	// --- ОБРАБОТКА ВИКИ-ССЫЛОК ---
-	if wikilinkPattern.MatchString(content) {
-		logf(INFO, "Обновляю вики-ссылки в тексте (удаляю квадратные скобки)...")
-		content = wikilinkPattern.ReplaceAllString(content, "$1")
+	switch *attachmentMode {
+	case "copy", "manifest":
+	default:
+		logf(ERROR, "Ошибка: Неизвестный режим вложений '%s'.", *attachmentMode)
+		os.Exit(exitFatal)
 	}
 
-	// --- ЗАПИСЬ РЕЗУЛЬТАТА ---
-	finalContent, err := writeFinalNote(properties, content)
-	if err != nil {
-		return err
+	if *splitByHeadingFlag != "" {
+		if _, ok := splitHeadingLevel(*splitByHeadingFlag); !ok {
+			logf(ERROR, "Ошибка: Некорректный уровень заголовков '%s' для --split-by-heading (ожидается h1..h6).", *splitByHeadingFlag)
+			os.Exit(exitFatal)
+		}
+		if *layout != "bundle" {
+			logf(WARNING, "--split-by-heading поддерживается только в раскладке bundle и будет проигнорирован.")
+		}
 	}
 
-	targetNotePath := filepath.Join(targetBundleDir, "index.md")
-	if err := os.WriteFile(targetNotePath, []byte(finalContent), 0644); err != nil {
-		return fmt.Errorf("не удалось записать итоговую заметку %s: %w", targetNotePath, err)
+	if *outputTmplPath != "" {
+		if err := loadOutputTemplate(*outputTmplPath); err != nil {
+			logf(ERROR, "Ошибка: %v", err)
+			os.Exit(exitFatal)
+		}
 	}
 
-	logf(INFO, "Заметка сохранена как: %s", targetNotePath)
-	return nil
+	os.Exit(cmd.run())
 }
 
-// parseNoteContent извлекает YAML front matter и основное содержимое.
-func parseNoteContent(fullContent string) (map[string]interface{}, string, error) {
-	matches := frontMatterPattern.FindStringSubmatch(fullContent)
-	if len(matches) < 2 {
-		// Front matter не найден, возвращаем пустые свойства и полный контент
-		return make(map[string]interface{}), fullContent, nil
+// processNotes сканирует и обрабатывает все заметки.
+func processNotes() error {
+	if err := ensurePostsDir(); err != nil {
+		return err
 	}
 
-	yamlContent := matches[1]
-	noteBody := strings.TrimSpace(fullContent[len(matches[0]):])
+	notePaths, err := notePathsToProcess()
+	if err != nil {
+		return err
+	}
 
-	var properties map[string]interface{}
-	if err := yaml.Unmarshal([]byte(yamlContent), &properties); err != nil {
-		return nil, "", fmt.Errorf("ошибка парсинга YAML: %w", err)
+	if *stateFile != "" {
+		if err := loadState(*stateFile); err != nil {
+			return err
+		}
+		if !skipsUnchangedNotes() {
+			logf(INFO, "С --attachment-mode=manifest или --layout=flat все заметки конвертируются заново, файл состояния используется только для --clean.")
+		}
 	}
-	if properties == nil {
-		properties = make(map[string]interface{})
+
+	if *attachmentCachePath != "" {
+		if err := loadAttachmentCache(*attachmentCachePath); err != nil {
+			return err
+		}
 	}
 
-	return properties, noteBody, nil
+	// Индексируем публикуемые заметки, чтобы разрешать ссылки и на те, что еще не обработаны.
+	buildNoteIndex(notePaths)
+	return convertNotes(notePaths)
 }
 
-// processAttachments обрабатывает вложения в тексте заметки.
-func processAttachments(content, targetBundleDir string) (string, error) {
-	matches := attachmentPattern.FindAllStringSubmatch(content, -1)
-	if len(matches) == 0 {
-		return content, nil
+// convertNotes обрабатывает заметки notePaths по уже построенному индексу и
+// записывает то, что собирается по всем заметкам: состояние, кэш и манифест
+// вложений, страницы тегов.
+func convertNotes(notePaths []string) error {
+	// Второй проход: обрабатываем заметки параллельно.
+	if err := processNotesConcurrently(notePaths, *concurrency); err != nil {
+		return err
 	}
 
-	logf(INFO, "Обновляю ссылки на вложения в тексте...")
-	newContent := content
-	for _, match := range matches {
-		originalLinkText := match[0]
-		originalFilename := match[1]
+	if *cleanStale {
+		if err := removeStaleBundles(); err != nil {
+			return err
+		}
+	}
 
-		sourceAttachmentPath := filepath.Join(*attachmentsDir, originalFilename)
-		if _, err := os.Stat(sourceAttachmentPath); os.IsNotExist(err) {
-			logf(WARNING, "Вложение '%s' не найдено в %s", originalFilename, *attachmentsDir)
-			continue
+	if *stateFile != "" {
+		if err := saveState(*stateFile); err != nil {
+			return err
 		}
+	}
 
-		md5Hash, err := calculateMD5(sourceAttachmentPath)
-		if err != nil {
-			logf(WARNING, "Не удалось вычислить MD5 для %s: %v", sourceAttachmentPath, err)
-			continue
+	if *attachmentCachePath != "" {
+		if err := saveAttachmentCache(*attachmentCachePath); err != nil {
+			return err
 		}
+	}
 
-		extension := filepath.Ext(sourceAttachmentPath)
-		newFilename := fmt.Sprintf("%s%s", md5Hash, extension)
-		targetAttachmentPath := filepath.Join(targetBundleDir, newFilename)
+	if *attachmentMode == "manifest" {
+		if err := writeAttachmentManifest(*manifestPath); err != nil {
+			return err
+		}
+	}
 
-		if err := copyFile(sourceAttachmentPath, targetAttachmentPath); err != nil {
-			logf(WARNING, "Не удалось скопировать вложение '%s' -> '%s': %v", originalFilename, newFilename, err)
-			continue
+	if *tagPagesDir != "" {
+		if err := writeTagPages(*tagPagesDir); err != nil {
+			return err
 		}
-		logf(DEBUG, "Копирую вложение: '%s' -> '%s'", originalFilename, newFilename)
+	}
 
-		newLinkText := fmt.Sprintf("![](%s)", newFilename)
-		newContent = strings.Replace(newContent, originalLinkText, newLinkText, -1)
+	if *dryRun {
+		printDryRunPlan(os.Stdout)
 	}
-	return newContent, nil
+
+	logf(INFO, "--- Обработка завершена. ---")
+	return nil
 }
 
-// calculateMD5 вычисляет MD5-хэш файла.
-func calculateMD5(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
+// notePathsToProcess возвращает пути к заметкам из --file-list или --notes-dir.
+func notePathsToProcess() ([]string, error) {
+	if *fileList != "" {
+		return readFileList(*fileList)
 	}
-	defer file.Close()
+	return collectNotes()
+}
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
+// processNotesConcurrently обрабатывает заметки в workers горутинах. Ошибка одной
+// заметки не останавливает обработку остальных; все ошибки возвращаются вместе
+// в порядке путей к заметкам.
+func processNotesConcurrently(notePaths []string, workers int) error {
+	if workers < 1 {
+		workers = 1
 	}
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
-}
 
-// copyFile копирует файл из src в dst.
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
+	paths := make(chan string)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures = make(map[string]error)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				logf(INFO, "--- Проверяю заметку: %s ---", strings.TrimPrefix(path, notesRoot()+"/"))
+				if err := processNoteFile(path); err != nil {
+					mu.Lock()
+					failures[path] = err
+					mu.Unlock()
+				}
+			}
+		}()
 	}
-	defer sourceFile.Close()
+	for _, path := range notePaths {
+		paths <- path
+	}
+	close(paths)
+	wg.Wait()
 
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
+	if len(failures) == 0 {
+		return nil
 	}
-	defer destFile.Close()
+	failed := make([]string, 0, len(failures))
+	for path := range failures {
+		failed = append(failed, path)
+	}
+	sort.Strings(failed)
+	errs := make([]error, 0, len(failed))
+	for _, path := range failed {
+		errs = append(errs, fmt.Errorf("%s: %w", path, failures[path]))
+	}
+	return errors.Join(errs...)
+}
 
-	_, err = io.Copy(destFile, sourceFile)
-	return err
+// ensurePostsDir проверяет целевой каталог --hugo-posts-dir и создает его при необходимости,
+// чтобы ошибка проявилась сразу, а не при записи первой заметки.
+func ensurePostsDir() error {
+	info, err := os.Stat(*hugoPostsDir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("путь --hugo-posts-dir %s существует, но не является каталогом", *hugoPostsDir)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("не удалось проверить каталог постов %s: %w", *hugoPostsDir, err)
+	}
+
+	if err := mkdirAll(*hugoPostsDir); err != nil {
+		return fmt.Errorf("не удалось создать каталог постов %s: %w", *hugoPostsDir, err)
+	}
+	logf(INFO, "Создан каталог постов: %s", *hugoPostsDir)
+	return nil
 }
 
-// writeFinalNote собирает итоговый файл с front matter и контентом.
-func writeFinalNote(properties map[string]interface{}, content string) (string, error) {
-	// Marshal делает сортировку ключей по умолчанию, что нам не нужно.
-	// Чтобы сохранить порядок, можно было бы использовать yaml.Node, но для простоты оставим так.
-	yamlHeader, err := yaml.Marshal(properties)
-	if err != nil {
-		return "", fmt.Errorf("не удалось преобразовать front matter в YAML: %w", err)
+// collectNotes собирает пути к заметкам согласно --notes-dir: это может быть
+// каталог, отдельный файл заметки или шаблон пути (например, /vault/Blog/*.md).
+func collectNotes() ([]string, error) {
+	if hasGlobMeta(*notesDir) {
+		matches, err := filepath.Glob(*notesDir)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный шаблон --notes-dir %s: %w", *notesDir, err)
+		}
+		var notePaths []string
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				paths, err := scanNotesDir(match)
+				if err != nil {
+					return nil, err
+				}
+				notePaths = append(notePaths, paths...)
+			} else if strings.HasSuffix(match, ".md") {
+				notePaths = append(notePaths, match)
+			}
+		}
+		logf(INFO, "Найдено заметок по шаблону %s: %d", *notesDir, len(notePaths))
+		return notePaths, nil
+	}
+
+	info, err := os.Stat(*notesDir)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть --notes-dir %s: %w", *notesDir, err)
+	}
+	if !info.IsDir() {
+		return []string{*notesDir}, nil
+	}
+	return scanNotesDir(*notesDir)
+}
+
+// hasGlobMeta проверяет, содержит ли путь метасимволы шаблона.
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// notesRoot возвращает каталог, от которого отсчитываются относительные пути заметок:
+// сам --notes-dir, каталог файла заметки или каталог перед первым метасимволом шаблона.
+func notesRoot() string {
+	root := *notesDir
+	if hasGlobMeta(root) {
+		for hasGlobMeta(root) {
+			root = filepath.Dir(root)
+		}
+		return root
+	}
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		return filepath.Dir(root)
+	}
+	return root
+}
+
+// scanNotesDir рекурсивно собирает пути ко всем заметкам в каталоге root,
+// пропуская исключенные каталоги.
+func scanNotesDir(root string) ([]string, error) {
+	logf(INFO, "Рекурсивно сканирую заметки в: %s", root)
+
+	dirsToExclude := append([]string{}, excludeDirs...)
+	if !*noDefaultExcl {
+		dirsToExclude = append(dirsToExclude, defaultExcludeDirs...)
+	}
+	if len(dirsToExclude) > 0 {
+		logf(INFO, "Исключаю каталоги: %v", dirsToExclude)
+	}
+
+	absExcludePaths := make(map[string]struct{})
+	for _, dir := range dirsToExclude {
+		absPath, err := filepath.Abs(filepath.Join(notesRoot(), dir))
+		if err == nil {
+			absExcludePaths[absPath] = struct{}{}
+		}
+	}
+
+	var notePaths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Пропускаем исключенные каталоги
+		if info.IsDir() {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if _, excluded := absExcludePaths[absPath]; excluded {
+				logf(DEBUG, "Пропускаю исключенный каталог: %s", path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Обрабатываем только .md файлы
+		if !strings.HasSuffix(info.Name(), ".md") {
+			return nil
+		}
+
+		notePaths = append(notePaths, path)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return notePaths, nil
+}
+
+// readFileList читает список заметок из файла. Пустые строки пропускаются,
+// относительные пути отсчитываются от --notes-dir.
+func readFileList(listPath string) ([]string, error) {
+	contentBytes, err := os.ReadFile(listPath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать список заметок %s: %w", listPath, err)
+	}
+
+	var notePaths []string
+	for _, line := range strings.Split(string(contentBytes), "\n") {
+		notePath := strings.TrimSpace(line)
+		if notePath == "" {
+			continue
+		}
+		if !filepath.IsAbs(notePath) {
+			notePath = filepath.Join(notesRoot(), notePath)
+		}
+		notePaths = append(notePaths, notePath)
+	}
+	logf(INFO, "Прочитано заметок из списка %s: %d", listPath, len(notePaths))
+	return notePaths, nil
+}
+
+// processNoteFile обрабатывает один файл заметки. Путь к заметке в возвращаемые
+// ошибки не входит: его добавляет processNotesConcurrently.
+func processNoteFile(path string) error {
+	contentBytes, release, err := readNote(path)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return fmt.Errorf("не удалось прочитать заметку: %w", err)
+	}
+	defer release()
+	fullContent := string(contentBytes)
+
+	properties, content, err := parseNoteContent(fullContent)
+	if err != nil {
+		reportError(&ParseError{Path: path, Err: err})
+		return nil // Не прерываем весь процесс из-за одной плохой заметки
+	}
+	content = removeComments(content)
+	// Имя каталога берется из исходных свойств, как при индексации ссылок
+	naming := bundleNamingOf(properties)
+
+	// --- ПРОВЕРКА ТЕГА ---
+	tagsList := noteTags(properties, content)
+	publish, overridden := publishOverride(properties)
+	if overridden {
+		delete(properties, *publishOverrideKey)
+	}
+	if overridden && !publish {
+		logf(DEBUG, "Пропускаю заметку '%s', так как у нее задано '%s: false'.", filepath.Base(path), *publishOverrideKey)
+		return nil
+	} else if *draftMode == "skip" && isDraft(properties, tagsList) {
+		logf(DEBUG, "Пропускаю заметку '%s', так как это черновик.", filepath.Base(path))
+		return nil
+	} else if overridden {
+		logf(INFO, "Обрабатываю заметку: %s (задано '%s: true')", filepath.Base(path), *publishOverrideKey)
+	} else if _, followed := followedNotes[path]; followed {
+		logf(INFO, "Обрабатываю заметку: %s (на нее ссылаются опубликованные заметки)", filepath.Base(path))
+	} else if *noFilter {
+		logf(INFO, "Обрабатываю заметку: %s", filepath.Base(path))
+	} else {
+		reason, ok := selectNote(properties, tagsList)
+		if !ok {
+			logf(DEBUG, "Пропускаю заметку '%s': %s.", filepath.Base(path), reason)
+			return nil
+		}
+		logf(INFO, "Обрабатываю заметку: %s (%s)", filepath.Base(path), reason)
+	}
+
+	if _, collided := collidedNotes[path]; collided {
+		logf(DEBUG, "Пропускаю заметку '%s', так как ее каталог поста уже занят другой заметкой.", filepath.Base(path))
+		return nil
+	}
+
+	if usesYAMLAliases(fullContent) {
+		logf(WARNING, "Front matter заметки '%s' содержит якоря YAML (&/*). Hugo их не поддерживает, значения будут развернуты.", filepath.Base(path))
+	}
+
+	// --- ОБНОВЛЕНИЕ ТЕГОВ ---
+	if *scanInlineTags == "merge" && len(tagsList) > len(extractTags(properties)) {
+		properties["tags"] = tagsList
+		logf(DEBUG, "Теги из текста добавлены в список тегов: %v", tagsList)
+	}
+	if *removeFilterTag {
+		var updatedTags []string
+		for _, t := range extractTags(properties) {
+			if !hasTag(selectionTags(), t) {
+				updatedTags = append(updatedTags, t)
+			}
+		}
+		if len(updatedTags) > 0 {
+			properties["tags"] = updatedTags
+		} else {
+			delete(properties, "tags")
+		}
+		logf(DEBUG, "Удаляю теги %v из списка тегов.", selectionTags())
+	}
+	if *nestedCategories {
+		nestedTagsToCategories(properties)
+	}
+
+	if *draftAsTag != "" && isDraft(properties, tagsList) {
+		updatedTags := extractTags(properties)
+		if !hasTag(updatedTags, *draftAsTag) {
+			updatedTags = append(updatedTags, *draftAsTag)
+		}
+		properties["tags"] = updatedTags
+		properties["draft"] = false
+		logf(DEBUG, "Черновик публикуется с тегом '%s'.", *draftAsTag)
+	} else if isDraft(properties, tagsList) {
+		switch *draftMode {
+		case "mark":
+			properties["draft"] = true
+			logf(DEBUG, "Заметка помечена как черновик Hugo (draft: true).")
+		case "publish":
+			properties["draft"] = false
+			logf(DEBUG, "Черновик публикуется как обычный пост (draft: false).")
+		}
+	}
+
+	if *tagsFromPath {
+		updatedTags := extractTags(properties)
+		for _, t := range folderTags(path) {
+			if !hasTag(updatedTags, t) {
+				updatedTags = append(updatedTags, t)
+			}
+		}
+		if len(updatedTags) > 0 {
+			properties["tags"] = updatedTags
+		}
+		logf(DEBUG, "Теги с учетом пути к заметке: %v", updatedTags)
+	}
+
+	if *stripTagPrefix != "" {
+		if _, ok := properties["tags"]; ok {
+			properties["tags"] = stripPrefixedTags(extractTags(properties), splitList(*stripTagPrefix))
+		}
+	}
+
+	if *tagPagesDir != "" {
+		recordTags(extractTags(properties))
+	}
+
+	// --- ЛОГИКА УПРАВЛЕНИЯ FRONT MATTER ---
+	if !*keepEphemeral {
+		removeEphemeralKeys(properties)
+	}
+
+	if *stripEmptyKeys {
+		removeEmptyKeys(properties)
+	}
+
+	if *epochKeys != "" {
+		convertEpochKeys(properties)
+	}
+
+	if len(renameKeyMap) > 0 || len(copyKeyMap) > 0 {
+		mapKeys(properties)
+	}
+
+	if *dateFromInline != "" {
+		var value string
+		content, value = extractInlineField(content, *dateFromInline)
+		if value != "" {
+			if _, ok := properties["date"]; ok {
+				logf(DEBUG, "Свойство 'date' уже задано, поле '%s:: %s' не используется.", *dateFromInline, value)
+			} else if date, ok := parseDate(value); ok {
+				properties["date"] = date.Format(time.RFC3339)
+				logf(DEBUG, "Свойство 'date' взято из поля '%s': %s", *dateFromInline, properties["date"])
+			} else {
+				logf(WARNING, "Не удалось разобрать дату '%s' из поля '%s' в заметке '%s'.", value, *dateFromInline, filepath.Base(path))
+			}
+		}
+	}
+
+	if _, ok := properties["date"]; !ok && *dateFromFilename {
+		if date, ok := filenameDate(path); ok {
+			properties["date"] = date
+			logf(DEBUG, "Свойство 'date' взято из имени файла: %s", date)
+		}
+	}
+	applyObsidianDates(properties, path)
+
+	if _, ok := properties["title"]; !ok {
+		title := postName(path)
+		if heading, found := firstH1(content); *titleFromH1 && found {
+			title = heading
+		}
+		properties["title"] = title
+		logf(DEBUG, "Свойство 'title' не найдено. Установлено: '%s'", title)
+	}
+
+	if _, ok := properties["type"]; !ok {
+		if pt := defaultPageType(path, tagsList); pt != "" {
+			properties["type"] = pt
+			logf(DEBUG, "Свойство 'type' не найдено. Установлено: '%s'", pt)
+		}
+	}
+
+	if *keepKeys != "" || *dropKeys != "" {
+		filterKeys(properties)
+	}
+
+	if _, ok := properties[*summaryKey]; *summaryKey != "" && !ok {
+		if summary := summaryText(content, *summaryWords); summary != "" {
+			properties[*summaryKey] = summary
+			logf(DEBUG, "Свойство '%s' не найдено. Установлено по первому абзацу.", *summaryKey)
+		}
+	}
+
+	if len(defaultProperties.values) > 0 {
+		defaultProperties.apply(properties)
+	}
+
+	if *aliasesMode != "keep" {
+		mapAliases(properties)
+	}
+
+	if *warnReserved {
+		for _, issue := range reservedParamIssues(properties) {
+			logf(WARNING, "Заметка '%s': свойство %s.", filepath.Base(path), issue)
+		}
+	}
+
+	// --- СОЗДАНИЕ PAGE BUNDLE ---
+	bundleDirName := bundleName(path, naming)
+	targetBundleDir := filepath.Join(*hugoPostsDir, bundleDirName)
+	targetNotePath := filepath.Join(targetBundleDir, "index.md")
+	if *layout == "flat" {
+		// Заметка и вложения пишутся прямо в каталог постов
+		targetBundleDir = *hugoPostsDir
+		targetNotePath = filepath.Join(*hugoPostsDir, bundleDirName+".md")
+	}
+
+	var fingerprint string
+	stateTarget := targetNotePath
+	if _, ok := splitHeadingLevel(*splitByHeadingFlag); ok && *layout == "bundle" {
+		stateTarget = filepath.Join(targetBundleDir, "_index.md")
+	}
+	applyDateSource(properties, path, stateTarget)
+	if *stateFile != "" {
+		fingerprint = noteFingerprint(fullContent, path)
+		if skipsUnchangedNotes() && unchangedSinceLastRun(path, fingerprint, stateTarget) {
+			logf(INFO, "Заметка '%s' не изменилась с прошлого запуска, пропускаю.", filepath.Base(path))
+			return nil
+		}
+	}
+
+	if *layout != "flat" {
+		if err := mkdirAll(targetBundleDir); err != nil {
+			return fmt.Errorf("не удалось создать каталог поста %s: %w", targetBundleDir, err)
+		}
+		logf(INFO, "Создан/обновлен каталог поста: %s", targetBundleDir)
+	}
+
+	// --- ВСТРАИВАНИЕ ЗАМЕТОК ---
+	content = expandTransclusions(content, path)
+
+	// --- ЭКРАНИРОВАНИЕ ШОРТКОДОВ ---
+	// Выполняется до остальных преобразований, чтобы не затронуть сгенерированные шорткоды.
+	if *escapeShortcode {
+		content = escapeShortcodes(content)
+	}
+
+	// --- ВЫНОСКИ ---
+	if *calloutShortcode != "" || *calloutHTML {
+		content = convertCallouts(content)
+	}
+
+	if *stripBlockIDsFlag || *blockAnchors {
+		content = stripBlockIDs(content, *blockAnchors)
+	}
+
+	// --- ВЫДЕЛЕНИЯ ---
+	if *highlightStyle != "" {
+		content = convertHighlights(content, *highlightStyle)
+	}
+
+	// --- ОБРАБОТКА ВЛОЖЕНИЙ ---
+	coverImage, _ := firstEmbeddedImage(content)
+	content, attachments, err := processAttachments(content, targetBundleDir, bundleDirName, path)
+	if err != nil {
+		return err
+	}
+	if *resourcesKey != "" && properties[*resourcesKey] != nil {
+		patterns := extractStringList(properties[*resourcesKey])
+		delete(properties, *resourcesKey)
+		if *layout == "bundle" {
+			attachments.includeResources(patterns, filepath.Dir(path))
+		} else {
+			logf(WARNING, "Свойство '%s' заметки '%s' поддерживается только в раскладке bundle и будет проигнорировано.", *resourcesKey, filepath.Base(path))
+		}
+	}
+	if *coverKey != "" {
+		applyCover(properties, coverImage, attachments)
+	}
+	if *emitResources && *layout == "bundle" && len(attachments.resources) > 0 {
+		mergeResources(properties, attachments.resources)
+	}
+	if *attachmentCachePath != "" && *layout == "bundle" && *attachmentMode == "copy" {
+		pruneStaleAttachments(targetBundleDir, attachments.files())
+	}
+
+	// --- ТЕГИ В ТЕКСТЕ ---
+	if *inlineTags == "link" {
+		content = linkInlineTags(content, *tagsURL)
+	}
+
+	// --- ОБРАБОТКА ВИКИ-ССЫЛОК ---
+	if wikilinkPattern.MatchString(content) {
+		logf(INFO, "Обновляю вики-ссылки в тексте...")
+		content = rewriteWikilinks(content, path)
+	}
+
+	if *autolinkURLsFlag {
+		content = autolinkURLs(content)
+	}
+
+	// --- ЗАГОЛОВКИ ---
+	if *stripTitleH1 {
+		var stripped bool
+		content, stripped = stripTitleHeading(content, fmt.Sprint(properties["title"]))
+		if stripped {
+			logf(DEBUG, "Удален заголовок, совпадающий с title.")
+		}
+	}
+	if *headingShift > 0 {
+		content = shiftHeadings(content, *headingShift)
+	}
+
+	// --- МАРКЕР КРАТКОГО СОДЕРЖАНИЯ ---
+	if *insertMoreAfter != "" {
+		var inserted bool
+		content, inserted = insertMoreMarker(content, *insertMoreAfter)
+		if inserted {
+			logf(DEBUG, "Вставлен маркер %s (%s).", moreMarker, *insertMoreAfter)
+		}
+	}
+
+	if *collapseBlanks {
+		content = collapseBlankLines(content)
+	}
+
+	// --- ЗАПИСЬ РЕЗУЛЬТАТА ---
+	original := frontMatterNode(fullContent)
+	if *protectKeys != "" {
+		original = applyProtectedKeys(properties, original, targetNotePath)
+	}
+
+	if level, ok := splitHeadingLevel(*splitByHeadingFlag); ok && *layout == "bundle" {
+		if err := writeSplitNote(properties, original, content, targetBundleDir, path, level); err != nil {
+			return err
+		}
+		if *stateFile != "" {
+			recordNoteState(path, fingerprint, stateTarget)
+		}
+		return nil
+	}
+
+	finalContent, err := writeFinalNote(properties, original, content)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(targetNotePath, []byte(finalContent)); err != nil {
+		return fmt.Errorf("не удалось записать итоговую заметку %s: %w", targetNotePath, err)
+	}
+	if *preserveMtime {
+		copyModTime(path, targetNotePath)
+	}
+
+	if *stateFile != "" {
+		recordNoteState(path, fingerprint, stateTarget)
+	}
+
+	logf(INFO, "Заметка сохранена как: %s", targetNotePath)
+	return nil
+}
+
+// isJSONFrontMatter проверяет, похож ли front matter на JSON-объект или массив.
+func isJSONFrontMatter(content string) bool {
+	content = strings.TrimSpace(content)
+	return (strings.HasPrefix(content, "{") && strings.HasSuffix(content, "}")) ||
+		(strings.HasPrefix(content, "[") && strings.HasSuffix(content, "]"))
+}
+
+// extractTags возвращает список тегов заметки из свойства 'tags'.
+// Поддерживаются YAML-список и строка с тегами через запятую.
+func extractTags(properties map[string]interface{}) []string {
+	return extractStringList(properties["tags"])
+}
+
+// extractStringList преобразует значение свойства в список строк.
+// Поддерживаются YAML-список и строка со значениями через запятую.
+func extractStringList(value interface{}) []string {
+	var list []string
+	switch v := value.(type) {
+	case []string:
+		list = append(list, v...)
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+	case string:
+		for _, str := range strings.Split(v, ",") {
+			list = append(list, strings.TrimSpace(str))
+		}
+	}
+	return list
+}
+
+// stripPrefixedTags удаляет из списка теги, начинающиеся с одного из префиксов.
+func stripPrefixedTags(tags, prefixes []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		stripped := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(strings.ToLower(tag), strings.ToLower(prefix)) {
+				stripped = true
+				break
+			}
+		}
+		if stripped {
+			logf(DEBUG, "Удаляю служебный тег '%s'.", tag)
+			continue
+		}
+		result = append(result, tag)
+	}
+	return result
+}
+
+// folderTags возвращает имена каталогов на пути от --notes-dir до заметки.
+// Например, для заметки Tech/Go/Note.md это теги Tech и Go.
+func folderTags(path string) []string {
+	relPath, err := filepath.Rel(notesRoot(), filepath.Dir(path))
+	if err != nil || relPath == "." {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(relPath), "/")
+}
+
+// typeMapping — разобранный --type-map: тег -> тип страницы.
+var typeMapping map[string]string
+
+// defaultPageType возвращает значение свойства 'type' для заметки без него
+// согласно --type или --set-type-from. Пустая строка означает, что тип не задается.
+func defaultPageType(path string, tagsList []string) string {
+	if *pageType != "" {
+		return *pageType
+	}
+
+	switch *setTypeFrom {
+	case "folder":
+		if folders := folderTags(path); len(folders) > 0 {
+			return folders[0]
+		}
+	case "tag":
+		for _, t := range tagsList {
+			if pt, ok := typeMapping[t]; ok {
+				return pt
+			}
+		}
+	}
+	return ""
+}
+
+// publishOverride возвращает значение свойства --publish-override-key, если оно задано:
+// true публикует заметку независимо от тегов, false — пропускает ее.
+func publishOverride(properties map[string]interface{}) (publish, ok bool) {
+	if *publishOverrideKey == "" {
+		return false, false
+	}
+	switch v := properties[*publishOverrideKey].(type) {
+	case bool:
+		return v, true
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes":
+			return true, true
+		case "false", "no":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// isDraft проверяет, является ли заметка черновиком: draft: true, status: draft
+// или тег draft.
+func isDraft(properties map[string]interface{}, tagsList []string) bool {
+	if draft, ok := properties["draft"].(bool); ok && draft {
+		return true
+	}
+	if status, ok := properties["status"].(string); ok && strings.EqualFold(strings.TrimSpace(status), "draft") {
+		return true
+	}
+	return hasTag(tagsList, "draft")
+}
+
+// hasTag проверяет, содержится ли тег в списке.
+func hasTag(tagsList []string, tag string) bool {
+	for _, t := range tagsList {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// noteName возвращает имя заметки без расширения, как его видит Obsidian.
+func noteName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".md")
+}
+
+// bundleNaming — свойства заметки, от которых зависит имя каталога поста.
+type bundleNaming struct {
+	slug, url, title string
+}
+
+// bundleNamingOf возвращает свойства заметки, от которых зависит имя каталога поста.
+func bundleNamingOf(properties map[string]interface{}) bundleNaming {
+	var naming bundleNaming
+	naming.slug, _ = properties["slug"].(string)
+	naming.url, _ = properties["url"].(string)
+	naming.title, _ = properties["title"].(string)
+	return naming
+}
+
+// bundleName возвращает имя каталога Page Bundle для заметки. С --slugify это
+// свойство 'slug' заметки, если оно задано, или имя файла (с --slug-from-title —
+// свойство 'title') после slugify. С --bundle-name-from-properties каталог называется
+// по свойству 'slug' или последней части свойства 'url', если они заданы.
+func bundleName(path string, naming bundleNaming) string {
+	if *nameFromProperties {
+		if name := propertyBundleName(naming); name != "" {
+			return name
+		}
+	}
+	if !*slugifyBundles {
+		return postName(path)
+	}
+	if slug := strings.TrimSpace(naming.slug); slug != "" {
+		return strings.ReplaceAll(slug, "/", "-")
+	}
+	if *slugFromTitle {
+		if name := slugify(naming.title); name != "" {
+			return name
+		}
+	}
+	if name := slugify(postName(path)); name != "" {
+		return name
+	}
+	return postName(path)
+}
+
+// propertyBundleName возвращает имя каталога из свойства 'slug' или последней части
+// свойства 'url' ("/posts/my-post/" → "my-post") либо пустую строку.
+func propertyBundleName(naming bundleNaming) string {
+	if slug := strings.TrimSpace(naming.slug); slug != "" {
+		return strings.ReplaceAll(slug, "/", "-")
+	}
+	segments := strings.FieldsFunc(naming.url, func(r rune) bool { return r == '/' })
+	if len(segments) == 0 || segments[len(segments)-1] == "." || segments[len(segments)-1] == ".." {
+		return ""
+	}
+	return segments[len(segments)-1]
+}
+
+// parseNoteContent извлекает YAML front matter и основное содержимое.
+func parseNoteContent(fullContent string) (map[string]interface{}, string, error) {
+	matches := frontMatterPattern.FindStringSubmatch(fullContent)
+	if len(matches) < 2 {
+		// Front matter не найден, возвращаем пустые свойства и полный контент
+		return make(map[string]interface{}), fullContent, nil
+	}
+
+	yamlContent := matches[1]
+	noteBody := strings.TrimSpace(fullContent[len(matches[0]):])
+
+	var properties map[string]interface{}
+	if err := yaml.Unmarshal([]byte(yamlContent), &properties); err != nil {
+		// Некоторые инструменты пишут front matter одной строкой JSON
+		if !isJSONFrontMatter(yamlContent) {
+			return nil, "", fmt.Errorf("ошибка парсинга YAML: %w", err)
+		}
+		properties = nil
+		if jsonErr := json.Unmarshal([]byte(yamlContent), &properties); jsonErr != nil {
+			return nil, "", fmt.Errorf("ошибка парсинга YAML: %w; ошибка парсинга JSON: %v", err, jsonErr)
+		}
+	}
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+
+	return properties, noteBody, nil
+}
+
+// convertEpochKeys переводит значения ключей --epoch-keys из времени Unix в RFC3339.
+// Для записи вида created=date значение переносится в ключ date, если его еще нет.
+func convertEpochKeys(properties map[string]interface{}) {
+	for _, item := range splitList(*epochKeys) {
+		key, target, mapped := strings.Cut(item, "=")
+		key, target = strings.TrimSpace(key), strings.TrimSpace(target)
+		value, ok := properties[key]
+		if !ok {
+			continue
+		}
+		date, ok := epochToTime(value)
+		if !ok {
+			logf(WARNING, "Свойство '%s' со значением '%v' не похоже на время Unix. Оставляю как есть.", key, value)
+			continue
+		}
+
+		formatted := date.Format(time.RFC3339)
+		if _, exists := properties[target]; mapped && !exists {
+			delete(properties, key)
+			properties[target] = formatted
+			logf(DEBUG, "Свойство '%s' преобразовано в '%s': %s", key, target, formatted)
+			continue
+		}
+		properties[key] = formatted
+		logf(DEBUG, "Свойство '%s' преобразовано: %s", key, formatted)
+	}
+}
+
+// epochToTime переводит число секунд или миллисекунд Unix во время.
+// Значения больше 10^11 считаются миллисекундами.
+func epochToTime(value interface{}) (time.Time, bool) {
+	var epoch float64
+	switch v := value.(type) {
+	case int:
+		epoch = float64(v)
+	case int64:
+		epoch = float64(v)
+	case uint64:
+		epoch = float64(v)
+	case float64:
+		epoch = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		epoch = parsed
+	default:
+		return time.Time{}, false
+	}
+
+	if epoch > 1e11 {
+		return time.UnixMilli(int64(epoch)), true
+	}
+	return time.Unix(int64(epoch), 0), true
+}
+
+// dateLayouts — форматы дат, которые распознаются в полях заметок.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDate разбирает дату в одном из форматов dateLayouts.
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// removeEphemeralKeys удаляет из свойств служебные ключи Obsidian.
+func removeEphemeralKeys(properties map[string]interface{}) {
+	for _, key := range ephemeralKeys {
+		if _, ok := properties[key]; ok {
+			delete(properties, key)
+			logf(DEBUG, "Удаляю служебное свойство '%s'.", key)
+		}
+	}
+}
+
+// managedKeys — свойства, которые заполняет или меняет сам инструмент;
+// --strip-empty-frontmatter-keys и --keep-keys их не удаляют.
+var managedKeys = map[string]struct{}{"title": {}, "date": {}, "tags": {}, "type": {}, "draft": {}}
+
+// removeEmptyKeys удаляет из свойств ключи без значения: null, пустую строку или пустой список.
+// Значения false и 0 считаются заданными и сохраняются.
+func removeEmptyKeys(properties map[string]interface{}) {
+	for key, value := range properties {
+		if _, ok := managedKeys[key]; ok {
+			continue
+		}
+		empty := false
+		switch v := value.(type) {
+		case nil:
+			empty = true
+		case string:
+			empty = strings.TrimSpace(v) == ""
+		case []interface{}:
+			empty = len(v) == 0
+		}
+		if empty {
+			delete(properties, key)
+			logf(DEBUG, "Удаляю пустое свойство '%s'.", key)
+		}
+	}
+}
+
+// filterKeys удаляет из свойств ключи, не подходящие под --keep-keys, и ключи,
+// подходящие под --drop-keys. Свойства из managedKeys --keep-keys не удаляет.
+func filterKeys(properties map[string]interface{}) {
+	keep, drop := splitList(*keepKeys), splitList(*dropKeys)
+	for key := range properties {
+		_, managed := managedKeys[key]
+		if len(keep) > 0 && !managed && !matchesKeyPattern(key, keep) {
+			delete(properties, key)
+			logf(DEBUG, "Удаляю свойство '%s', которого нет в --keep-keys.", key)
+		} else if matchesKeyPattern(key, drop) {
+			delete(properties, key)
+			logf(DEBUG, "Удаляю свойство '%s' по --drop-keys.", key)
+		}
+	}
+}
+
+// matchesKeyPattern проверяет, подходит ли ключ под одно из имен или шаблонов patterns.
+func matchesKeyPattern(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// processAttachments обрабатывает вложения в тексте заметки: встраивания ![[файл]]
+// и вики-ссылки [[файл]] на существующие файлы вложений (не заметки), которые
+// превращаются в ссылки для скачивания.
+// Вложения копируются в targetDir, а bundle используется в их именах при схеме note-indexed.
+// Вложения ищутся относительно заметки path, ее имя используется в сообщениях об ошибках.
+// Кроме текста возвращаются сведения о скопированных вложениях.
+func processAttachments(content, targetDir, bundle, path string) (string, *attachmentCopier, error) {
+	copier := &attachmentCopier{targetDir: targetDir, bundle: bundle, notePath: path, noteDir: filepath.Dir(path), copied: make(map[string]string)}
+	matches := attachmentPattern.FindAllStringSubmatch(content, -1)
+	links := attachmentLinks(content, copier.noteDir)
+	if len(matches) == 0 && len(links) == 0 {
+		return content, copier, nil
+	}
+
+	logf(INFO, "Обновляю ссылки на вложения в тексте...")
+	targets := make(map[string]embedTarget) // Адрес и размер для каждой скопированной ссылки
+	for _, match := range matches {
+		originalLinkText := match[0]
+		if _, ok := targets[originalLinkText]; ok {
+			continue
+		}
+		originalFilename, sizeHint := parseEmbed(match[1])
+		if newFilename, ok := copier.copy(originalFilename); ok {
+			targets[originalLinkText] = embedTarget{src: attachmentURL(newFilename), hint: sizeHint}
+			title := parseImageHint(sizeHint).caption
+			if title == "" {
+				title = strings.TrimSuffix(filepath.Base(originalFilename), filepath.Ext(originalFilename))
+			}
+			copier.addResource(newFilename, title)
+		}
+	}
+	content = replaceEmbeds(content, targets)
+
+	replaced := make(map[string]struct{})
+	for _, link := range links {
+		if _, ok := replaced[link.raw]; ok {
+			continue
+		}
+		replaced[link.raw] = struct{}{}
+		newFilename, ok := copier.copy(link.filename)
+		if !ok {
+			continue
+		}
+		content = replaceAttachmentLink(content, link.raw, fmt.Sprintf("[%s](%s)", link.text, attachmentURL(newFilename)))
+		copier.addResource(newFilename, link.text)
+	}
+	return content, copier, nil
+}
+
+// attachmentCopier копирует вложения заметки в каталог поста. Каждый файл
+// копируется один раз, сколько бы ссылок на него ни было.
+type attachmentCopier struct {
+	targetDir, bundle string
+	notePath          string            // Путь к заметке для сообщений об ошибках
+	noteDir           string            // Каталог заметки, относительно которого ищутся вложения
+	index             int               // Счетчик вложений в пределах Page Bundle для схемы note-indexed
+	copied            map[string]string // Исходное имя -> новое имя
+	resources         []interface{}     // Описания вложений для свойства 'resources'
+}
+
+// includeResources копирует в каталог поста файлы по шаблонам patterns (свойство
+// --resources-key) под их исходными именами. Шаблоны ищутся относительно каталога
+// заметки noteDir, а если там ничего не найдено — в каталогах вложений.
+func (c *attachmentCopier) includeResources(patterns []string, noteDir string) {
+	for _, pattern := range patterns {
+		pattern = filepath.FromSlash(pattern)
+		matches, err := filepath.Glob(filepath.Join(noteDir, pattern))
+		for _, dir := range attachmentDirs(noteDir) {
+			if err != nil || len(matches) > 0 {
+				break
+			}
+			matches, err = filepath.Glob(filepath.Join(dir, pattern))
+		}
+		if err != nil {
+			reportError(&AttachmentError{Path: c.notePath, Attachment: pattern, Err: fmt.Errorf("некорректный шаблон: %w", err)})
+			continue
+		}
+		if len(matches) == 0 {
+			reportError(&AttachmentError{Path: c.notePath, Attachment: pattern, Err: fmt.Errorf("файлы не найдены")})
+			continue
+		}
+		for _, source := range matches {
+			if info, err := os.Stat(source); err != nil || info.IsDir() {
+				continue
+			}
+			name := filepath.Base(source)
+			if err := placeAttachment(source, filepath.Join(c.targetDir, name)); err != nil {
+				reportError(&AttachmentError{Path: c.notePath, Attachment: source, Err: fmt.Errorf("не удалось скопировать в '%s': %w", name, err)})
+				continue
+			}
+			logf(DEBUG, "Копирую дополнительный файл: '%s' -> '%s'", source, name)
+			c.copied[source] = name
+		}
+	}
+}
+
+// files возвращает новые имена скопированных вложений.
+func (c *attachmentCopier) files() []string {
+	files := make([]string, 0, len(c.copied))
+	for _, newFilename := range c.copied {
+		files = append(files, newFilename)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// addResource добавляет описание вложения newFilename для свойства 'resources',
+// если его еще нет.
+func (c *attachmentCopier) addResource(newFilename, title string) {
+	for _, resource := range c.resources {
+		if resource.(map[string]interface{})["src"] == newFilename {
+			return
+		}
+	}
+	c.resources = append(c.resources, map[string]interface{}{"src": newFilename, "title": title})
+}
+
+// mergeResources добавляет описания вложений в свойство 'resources'. Записи, уже
+// заданные в заметке для того же src, сохраняются без изменений.
+func mergeResources(properties map[string]interface{}, resources []interface{}) {
+	existing, _ := properties["resources"].([]interface{})
+	known := make(map[interface{}]struct{})
+	for _, resource := range existing {
+		if entry, ok := resource.(map[string]interface{}); ok {
+			known[entry["src"]] = struct{}{}
+		}
+	}
+	merged := existing
+	for _, resource := range resources {
+		if _, ok := known[resource.(map[string]interface{})["src"]]; !ok {
+			merged = append(merged, resource)
+		}
+	}
+	properties["resources"] = merged
+	logf(DEBUG, "Свойство 'resources' содержит %d записей.", len(merged))
+}
+
+// copy копирует вложение originalFilename и возвращает его новое имя.
+// Ошибки сообщаются через reportError, а ok равно false.
+func (c *attachmentCopier) copy(originalFilename string) (string, bool) {
+	if newFilename, ok := c.copied[originalFilename]; ok {
+		return newFilename, true
+	}
+
+	sourceAttachmentPath, ok := findAttachment(originalFilename, c.noteDir)
+	if !ok {
+		reportError(&AttachmentError{Path: c.notePath, Attachment: originalFilename, Err: fmt.Errorf("не найдено в %s", attachmentSearchDescription(c.noteDir))})
+		return "", false
+	}
+
+	extension := filepath.Ext(sourceAttachmentPath)
+	var newFilename string
+	switch *attachmentNaming {
+	case "note-indexed":
+		c.index++
+		// Имя поста может содержать пробелы и кириллицу, неудобные в адресах файлов
+		newFilename = fmt.Sprintf("%s-%d%s", slugify(c.bundle), c.index, extension)
+	case "original", "slug":
+		newFilename = claimAttachmentName(c.targetDir, attachmentFileName(sourceAttachmentPath), sourceAttachmentPath)
+	default:
+		md5Hash, err := calculateMD5(sourceAttachmentPath)
+		if err != nil {
+			reportError(&AttachmentError{Path: c.notePath, Attachment: originalFilename, Err: fmt.Errorf("не удалось вычислить MD5: %w", err)})
+			return "", false
+		}
+		newFilename = fmt.Sprintf("%s%s", md5Hash, extension)
+		if *attachmentSharding {
+			// Как в git: подкаталог по первым двум символам хэша
+			newFilename = md5Hash[:2] + "/" + newFilename
+		}
+	}
+	targetAttachmentPath := filepath.Join(c.targetDir, filepath.FromSlash(newFilename))
+
+	if err := placeAttachment(sourceAttachmentPath, targetAttachmentPath); err != nil {
+		reportError(&AttachmentError{Path: c.notePath, Attachment: originalFilename, Err: fmt.Errorf("не удалось скопировать в '%s': %w", newFilename, err)})
+		return "", false
+	}
+	logf(DEBUG, "Копирую вложение: '%s' -> '%s'", originalFilename, newFilename)
+	c.copied[originalFilename] = newFilename
+	return newFilename, true
+}
+
+// attachmentLink — вики-ссылка на файл вложения.
+type attachmentLink struct {
+	raw            string // исходный текст ссылки [[...]]
+	filename, text string
+}
+
+// attachmentLinks находит вики-ссылки (не встраивания), которые ведут на файлы
+// вложений заметки из каталога noteDir, а не на заметки, в порядке их появления в тексте.
+func attachmentLinks(content, noteDir string) []attachmentLink {
+	var links []attachmentLink
+	for _, loc := range wikilinkPattern.FindAllStringSubmatchIndex(content, -1) {
+		if loc[0] > 0 && content[loc[0]-1] == '!' {
+			continue
+		}
+		target, heading, alias := parseWikilink(content[loc[2]:loc[3]])
+		if target == "" || heading != "" || !isAttachmentFile(target, noteDir) {
+			continue
+		}
+		text := alias
+		if text == "" {
+			text = filepath.Base(filepath.FromSlash(target))
+		}
+		links = append(links, attachmentLink{raw: content[loc[0]:loc[1]], filename: filepath.FromSlash(target), text: text})
+	}
+	return links
+}
+
+// isAttachmentFile проверяет, что цель вики-ссылки — существующий файл вложения:
+// у него есть расширение, отличное от .md, и он лежит в одном из каталогов вложений.
+func isAttachmentFile(target, noteDir string) bool {
+	extension := strings.ToLower(filepath.Ext(target))
+	if extension == "" || extension == ".md" {
+		return false
+	}
+	_, ok := findAttachment(filepath.FromSlash(target), noteDir)
+	return ok
+}
+
+// replaceAttachmentLink заменяет все вхождения вики-ссылки linkText, кроме встраиваний.
+// В строках таблиц черта в тексте ссылки экранируется.
+func replaceAttachmentLink(content, linkText, replacement string) string {
+	var sb strings.Builder
+	last := 0
+	for {
+		i := strings.Index(content[last:], linkText)
+		if i < 0 {
+			break
+		}
+		start := last + i
+		sb.WriteString(content[last:start])
+		switch {
+		case start > 0 && content[start-1] == '!':
+			sb.WriteString(linkText)
+		case inTableRow(content, start):
+			sb.WriteString(strings.ReplaceAll(replacement, "|", "\\|"))
+		default:
+			sb.WriteString(replacement)
+		}
+		last = start + len(linkText)
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// embedTarget — адрес скопированного вложения и подсказка о его размере.
+type embedTarget struct {
+	src, hint string
+}
+
+// replaceEmbeds заменяет встраивания, для которых скопированы вложения, ссылками на них.
+// В строках таблиц выводится HTML-тег <img>, чтобы шорткоды и размеры не ломали таблицу.
+func replaceEmbeds(content string, targets map[string]embedTarget) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range attachmentPattern.FindAllStringIndex(content, -1) {
+		target, ok := targets[content[loc[0]:loc[1]]]
+		if !ok {
+			continue
+		}
+		sb.WriteString(content[last:loc[0]])
+		if inTableRow(content, loc[0]) {
+			sb.WriteString(renderTableImage(target.src, target.hint))
+		} else {
+			sb.WriteString(renderImage(target.src, target.hint))
+		}
+		last = loc[1]
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// attachmentURL возвращает адрес вложения для ссылки в тексте. В раскладке flat
+// вложения лежат в каталоге постов, поэтому по умолчанию ссылка ведет туда.
+func attachmentURL(filename string) string {
+	// Исходные имена файлов (--attachment-naming=original) могут содержать пробелы и скобки
+	filename = urlUnsafeChars.Replace(filename)
+	if *attachmentPrefix != "" {
+		return *attachmentPrefix + filename
+	}
+	if *layout == "flat" {
+		return sectionURL() + filename
+	}
+	return filename
+}
+
+// urlUnsafeChars — символы имен файлов, которые нельзя оставить в адресе ссылки Markdown.
+var urlUnsafeChars = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E", "#", "%23", "?", "%3F")
+
+// sectionURL возвращает адрес раздела с постами на сайте (--posts-url или /<имя каталога постов>/).
+func sectionURL() string {
+	if *postsURL != "" {
+		return strings.TrimSuffix(*postsURL, "/") + "/"
+	}
+	return "/" + filepath.Base(*hugoPostsDir) + "/"
+}
+
+// parseEmbed разделяет содержимое встраивания вида image.png|300 на имя файла и подсказку о размере.
+// Обратные слэши в пути (встраивания, созданные в Windows) заменяются на прямые.
+// В таблицах Obsidian экранирует разделитель: image.png\|300.
+func parseEmbed(inner string) (filename, hint string) {
+	inner = unescapePipes(inner)
+	filename = inner
+	if i := strings.Index(inner, "|"); i >= 0 {
+		filename, hint = inner[:i], strings.TrimSpace(inner[i+1:])
+	}
+	filename = strings.ReplaceAll(strings.TrimSpace(filename), "\\", "/")
+	return filepath.FromSlash(filename), hint
+}
+
+// imageHint — размер и подпись из встраивания ![[photo.png|Подпись|300x200]].
+type imageHint struct {
+	width, height string
+	percent       bool
+	caption       string
+}
+
+// parseImageHint разбирает подсказку встраивания: часть вида 300, 300x200 или 50%
+// задает размер, остальное — подпись.
+func parseImageHint(hint string) imageHint {
+	var parsed imageHint
+	var caption []string
+	for _, part := range strings.Split(hint, "|") {
+		part = strings.TrimSpace(part)
+		if size := imageSizePattern.FindStringSubmatch(part); size != nil && parsed.width == "" {
+			parsed.width, parsed.height, parsed.percent = size[1], size[2], size[3] != ""
+		} else if part != "" {
+			caption = append(caption, part)
+		}
+	}
+	parsed.caption = strings.Join(caption, "|")
+	return parsed
+}
+
+// renderImage возвращает Markdown или шорткод Hugo для вложения по адресу src с учетом
+// размера и подписи. Без подсказки выводится обычная ссылка ![](имя), с подписью —
+// шорткод figure с caption.
+func renderImage(src, hint string) string {
+	image := parseImageHint(hint)
+	caption := ""
+	if image.caption != "" {
+		caption = fmt.Sprintf(` caption="%s"`, html.EscapeString(image.caption))
+	}
+	if image.width == "" {
+		if caption == "" {
+			return fmt.Sprintf("![](%s)", src)
+		}
+		return fmt.Sprintf(`{{< figure src="%s" alt="%s"%s >}}`, src, html.EscapeString(image.caption), caption)
+	}
+
+	width, height, percent := image.width, image.height, image.percent
+	switch *widthUnit {
+	case "percent":
+		style := "width: " + width + "px;"
+		if percent {
+			style = "width: " + width + "%;"
+		} else if height != "" {
+			style += " height: " + height + "px;"
+		}
+		img := fmt.Sprintf(`<img src="%s" alt="%s" style="%s">`, src, html.EscapeString(image.caption), style)
+		if image.caption != "" {
+			return "<figure>" + img + "<figcaption>" + html.EscapeString(image.caption) + "</figcaption></figure>"
+		}
+		return img
+	case "class":
+		class := "width-" + width + "px"
+		if percent {
+			class = "width-" + width
+		}
+		return fmt.Sprintf(`{{< figure src="%s" class="%s"%s >}}`, src, class, caption)
+	default:
+		if percent {
+			width += "%"
+		}
+		if height != "" {
+			return fmt.Sprintf(`{{< figure src="%s" width="%s" height="%s"%s >}}`, src, width, height, caption)
+		}
+		return fmt.Sprintf(`{{< figure src="%s" width="%s"%s >}}`, src, width, caption)
+	}
+}
+
+// renderTableImage возвращает тег <img> для вложения в ячейке таблицы. Размер задается
+// атрибутами width и height, процентная ширина — стилем, подпись становится alt.
+func renderTableImage(src, hint string) string {
+	image := parseImageHint(hint)
+	alt := html.EscapeString(image.caption)
+	switch {
+	case image.width == "":
+		return fmt.Sprintf(`<img src="%s" alt="%s">`, src, alt)
+	case image.percent:
+		return fmt.Sprintf(`<img src="%s" alt="%s" style="width: %s%%;">`, src, alt, image.width)
+	case image.height != "":
+		return fmt.Sprintf(`<img src="%s" alt="%s" width="%s" height="%s">`, src, alt, image.width, image.height)
+	default:
+		return fmt.Sprintf(`<img src="%s" alt="%s" width="%s">`, src, alt, image.width)
+	}
+}
+
+// calculateMD5 вычисляет MD5-хэш файла.
+func calculateMD5(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// copyFile копирует файл из src в dst.
+func copyFile(src, dst string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, sourceFile)
+	return err
+}
+
+// copyModTime устанавливает файлу target время изменения исходной заметки source,
+// чтобы Hugo, берущий .Lastmod из файловой системы, не считал пост обновленным.
+func copyModTime(source, target string) {
+	if *dryRun {
+		return
+	}
+	info, err := os.Stat(source)
+	if err == nil {
+		err = os.Chtimes(target, info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		logf(WARNING, "Не удалось перенести время изменения заметки на %s: %v", target, err)
+	}
+}
+
+// writeFinalNote собирает итоговый файл с front matter и контентом.
+// Если передан исходный узел front matter, сохраняются порядок ключей и комментарии.
+func writeFinalNote(properties map[string]interface{}, original *yaml.Node, content string) (string, error) {
+	node, err := buildFrontMatterNode(properties, original)
+	if err != nil {
+		return "", fmt.Errorf("не удалось преобразовать front matter в YAML: %w", err)
+	}
+
+	if outputTemplate != nil {
+		yamlHeader, err := marshalYAMLNode(node)
+		if err != nil {
+			return "", fmt.Errorf("не удалось преобразовать front matter в YAML: %w", err)
+		}
+		return renderOutputTemplate(properties, string(yamlHeader), content)
+	}
+
+	header, err := formatFrontMatter(node, properties)
+	if err != nil {
+		return "", err
+	}
+	if header == "" {
+		return content, nil
 	}
 
 	var sb strings.Builder
-	sb.WriteString("---\n")
-	sb.Write(yamlHeader)
-	sb.WriteString("---\n\n")
+	sb.WriteString(header)
+	sb.WriteString("\n")
 	sb.WriteString(content)
 
 	return sb.String(), nil
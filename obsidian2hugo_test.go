@@ -0,0 +1,739 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// attachmentVault создает хранилище с файлами вложений files (пути через /)
+// и каталог поста post, настраивает --attachments-dir и именование вложений
+// note-indexed и возвращает путь к заметке и каталог поста.
+func attachmentVault(t *testing.T, files ...string) (notePath, bundleDir string) {
+	t.Helper()
+	vault := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(vault, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundleDir = filepath.Join(t.TempDir(), "post")
+	if err := os.MkdirAll(bundleDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	savedDirs, savedNaming := attachmentsDirs, *attachmentNaming
+	attachmentsDirs, *attachmentNaming = stringSlice{vault}, "note-indexed"
+	t.Cleanup(func() {
+		attachmentsDirs, *attachmentNaming = savedDirs, savedNaming
+	})
+	return filepath.Join(vault, "Note.md"), bundleDir
+}
+
+func TestFolderTags(t *testing.T) {
+	saved := *notesDir
+	t.Cleanup(func() { *notesDir = saved })
+	*notesDir = "/vault"
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/vault/Note.md", nil},
+		{"/vault/Tech/Note.md", []string{"Tech"}},
+		{"/vault/Tech/Go/Note.md", []string{"Tech", "Go"}},
+	}
+	for _, tt := range tests {
+		if got := folderTags(filepath.FromSlash(tt.path)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("folderTags(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUsesYAMLAliases(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          bool
+	}{
+		{"plain", "---\ntitle: Note\ntags: [blog]\n---\nText", false},
+		{"anchor and alias", "---\nbase: &base\n  draft: false\npost: *base\n---\nText", true},
+		{"merge key", "---\nbase: &base {draft: false}\npost:\n  <<: *base\n---\nText", true},
+		{"no front matter", "Text with *emphasis* & more", false},
+	}
+	for _, tt := range tests {
+		if got := usesYAMLAliases(tt.content); got != tt.want {
+			t.Errorf("%s: usesYAMLAliases = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessAttachmentsNoteIndexed(t *testing.T) {
+	vault := t.TempDir()
+	for _, name := range []string{"a.png", "b.jpg"} {
+		if err := os.WriteFile(filepath.Join(vault, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundleDir := filepath.Join(t.TempDir(), "post")
+	if err := os.MkdirAll(bundleDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	savedDirs, savedNaming := attachmentsDirs, *attachmentNaming
+	attachmentsDirs, *attachmentNaming = stringSlice{vault}, "note-indexed"
+	t.Cleanup(func() { attachmentsDirs, *attachmentNaming = savedDirs, savedNaming })
+
+	content, _, err := processAttachments("![[a.png]] ![[b.jpg]] ![[a.png]]", bundleDir, "post", filepath.Join(vault, "Note.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "![](post-1.png) ![](post-2.jpg) ![](post-1.png)"; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	for _, name := range []string{"post-1.png", "post-2.jpg"} {
+		if _, err := os.Stat(filepath.Join(bundleDir, name)); err != nil {
+			t.Errorf("attachment %s was not copied: %v", name, err)
+		}
+	}
+
+	// Имя поста переводится в slug, как и имена каталогов с --slugify
+	for bundle, want := range map[string]string{"Мой Пост": "moy-post-1.png", "你好": slugify("你好") + "-1.png"} {
+		content, _, err := processAttachments("![[a.png]]", bundleDir, bundle, filepath.Join(vault, "Note.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != "![]("+want+")" {
+			t.Errorf("bundle %q: content = %q, want ![](%s)", bundle, content, want)
+		}
+	}
+}
+
+func TestProcessAttachmentsOriginalNames(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "My Photo (1).png", "Фото Отпуска.JPG")
+	tests := []struct {
+		naming, embed, want, file string
+	}{
+		{"original", "![[My Photo (1).png]]", "![](My%20Photo%20%281%29.png)", "My Photo (1).png"},
+		{"slug", "![[Фото Отпуска.JPG]]", "![](foto-otpuska.jpg)", "foto-otpuska.jpg"},
+	}
+	for _, tt := range tests {
+		*attachmentNaming = tt.naming
+		content, _, err := processAttachments(tt.embed, bundleDir, "post", notePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != tt.want {
+			t.Errorf("--attachment-naming=%s: content = %q, want %q", tt.naming, content, tt.want)
+		}
+		if _, err := os.Stat(filepath.Join(bundleDir, tt.file)); err != nil {
+			t.Errorf("--attachment-naming=%s: attachment %s was not copied: %v", tt.naming, tt.file, err)
+		}
+	}
+}
+
+func TestReadFileList(t *testing.T) {
+	saved := *notesDir
+	t.Cleanup(func() { *notesDir = saved })
+	*notesDir = filepath.FromSlash("/vault")
+
+	dir := t.TempDir()
+	listPath := filepath.Join(dir, "notes.txt")
+	absolute := filepath.Join(dir, "Other.md")
+	if err := os.WriteFile(listPath, []byte("Posts/Note.md\n\n  "+absolute+"  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readFileList(listPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.FromSlash("/vault/Posts/Note.md"), absolute}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readFileList = %v, want %v", got, want)
+	}
+
+	_, err = readFileList(filepath.Join(dir, "missing.txt"))
+	if err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("readFileList of a missing file: err = %v, want it to name the file", err)
+	}
+}
+
+func TestEnsurePostsDir(t *testing.T) {
+	saved := *hugoPostsDir
+	t.Cleanup(func() { *hugoPostsDir = saved })
+	dir := t.TempDir()
+
+	*hugoPostsDir = filepath.Join(dir, "content", "posts")
+	if err := ensurePostsDir(); err != nil {
+		t.Fatalf("ensurePostsDir of a missing directory: %v", err)
+	}
+	if info, err := os.Stat(*hugoPostsDir); err != nil || !info.IsDir() {
+		t.Errorf("posts directory was not created: %v", err)
+	}
+	if err := ensurePostsDir(); err != nil {
+		t.Errorf("ensurePostsDir of an existing directory: %v", err)
+	}
+
+	*hugoPostsDir = filepath.Join(dir, "file")
+	if err := os.WriteFile(*hugoPostsDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensurePostsDir(); err == nil {
+		t.Error("ensurePostsDir of a file returned no error")
+	}
+}
+
+func TestParseEmbedBackslashes(t *testing.T) {
+	filename, hint := parseEmbed(`subfolder\image.png|300`)
+	if want := filepath.FromSlash("subfolder/image.png"); filename != want || hint != "300" {
+		t.Errorf("parseEmbed = (%q, %q), want (%q, %q)", filename, hint, want, "300")
+	}
+}
+
+func TestProcessAttachmentsBackslashEmbed(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "subfolder/image.png")
+
+	content, _, err := processAttachments(`Text ![[subfolder\image.png]]`, bundleDir, "post", notePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Text ![](post-1.png)"; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	if _, err := os.Stat(filepath.Join(bundleDir, "post-1.png")); err != nil {
+		t.Errorf("attachment was not copied: %v", err)
+	}
+}
+
+func TestProcessAttachmentsURLPrefix(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "image.png")
+	saved := *attachmentPrefix
+	*attachmentPrefix = "https://cdn.example.com/media/"
+	t.Cleanup(func() { *attachmentPrefix = saved })
+
+	content, _, err := processAttachments("![[image.png|300]]", bundleDir, "post", notePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{{< figure src="https://cdn.example.com/media/post-1.png" width="300" >}}`; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	if _, err := os.Stat(filepath.Join(bundleDir, "post-1.png")); err != nil {
+		t.Errorf("attachment was not copied: %v", err)
+	}
+}
+
+func TestParseNoteContentJSON(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          map[string]interface{}
+		wantErr       bool
+	}{
+		{"yaml", "---\ntitle: Note\n---\nText", map[string]interface{}{"title": "Note"}, false},
+		{"json", "---\n{\"title\": \"Note\", \"url\": \"\\/notes\\/note\\/\"}\n---\nText", map[string]interface{}{"title": "Note", "url": "/notes/note/"}, false},
+		{"broken yaml", "---\ntitle: [Note\n---\nText", nil, true},
+		{"broken json", "---\n{\n\t\"title\": \"Note\"\n\t\"draft\": false\n}\n---\nText", nil, true},
+	}
+	for _, tt := range tests {
+		properties, body, err := parseNoteContent(tt.content)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseNoteContent error = %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !reflect.DeepEqual(properties, tt.want) || body != "Text" {
+			t.Errorf("%s: parseNoteContent = (%v, %q), want (%v, %q)", tt.name, properties, body, tt.want, "Text")
+		}
+	}
+}
+
+func TestConvertEpochKeys(t *testing.T) {
+	saved := *epochKeys
+	*epochKeys = "created=date, updated, broken"
+	t.Cleanup(func() { *epochKeys = saved })
+
+	seconds := time.Unix(1700000000, 0).Format(time.RFC3339)
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{"seconds moved to date", map[string]interface{}{"created": 1700000000}, map[string]interface{}{"date": seconds}},
+		{"milliseconds in place", map[string]interface{}{"updated": "1700000000000"}, map[string]interface{}{"updated": seconds}},
+		{"existing date kept", map[string]interface{}{"created": 1700000000, "date": "2024-01-01"}, map[string]interface{}{"created": seconds, "date": "2024-01-01"}},
+		{"not a timestamp", map[string]interface{}{"broken": "yesterday"}, map[string]interface{}{"broken": "yesterday"}},
+	}
+	for _, tt := range tests {
+		convertEpochKeys(tt.properties)
+		if !reflect.DeepEqual(tt.properties, tt.want) {
+			t.Errorf("%s: properties = %v, want %v", tt.name, tt.properties, tt.want)
+		}
+	}
+}
+
+func TestAttachmentURL(t *testing.T) {
+	savedLayout, savedPosts, savedPrefix := *layout, *hugoPostsDir, *attachmentPrefix
+	t.Cleanup(func() { *layout, *hugoPostsDir, *attachmentPrefix = savedLayout, savedPosts, savedPrefix })
+	*hugoPostsDir = filepath.FromSlash("/site/content/posts")
+
+	tests := []struct {
+		layout, prefix, want string
+	}{
+		{"bundle", "", "post-1.png"},
+		{"flat", "", "/posts/post-1.png"},
+		{"flat", "https://cdn.example.com/", "https://cdn.example.com/post-1.png"},
+	}
+	for _, tt := range tests {
+		*layout, *attachmentPrefix = tt.layout, tt.prefix
+		if got := attachmentURL("post-1.png"); got != tt.want {
+			t.Errorf("attachmentURL with --layout=%s --attachment-url-prefix=%q = %q, want %q", tt.layout, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestCollectNotes(t *testing.T) {
+	saved := *notesDir
+	t.Cleanup(func() { *notesDir = saved })
+
+	vault := t.TempDir()
+	for _, name := range []string{"Blog/A.md", "Blog/B.md", "Blog/image.png", "Blog/Sub/C.md", "Other/D.md"} {
+		path := filepath.Join(vault, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("Text"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blog := filepath.Join(vault, "Blog")
+
+	tests := []struct {
+		name, notesDir, root string
+		want                 []string
+	}{
+		{"directory", blog, blog, []string{"A.md", "B.md", "Sub/C.md"}},
+		{"single note", filepath.Join(blog, "A.md"), blog, []string{"A.md"}},
+		{"glob", filepath.Join(blog, "*.md"), blog, []string{"A.md", "B.md"}},
+		{"glob of directories", filepath.Join(vault, "*", "Sub"), vault, []string{"Blog/Sub/C.md"}},
+	}
+	for _, tt := range tests {
+		*notesDir = tt.notesDir
+		if got := notesRoot(); got != tt.root {
+			t.Errorf("%s: notesRoot = %q, want %q", tt.name, got, tt.root)
+		}
+		paths, err := collectNotes()
+		if err != nil {
+			t.Errorf("%s: collectNotes: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, path := range paths {
+			rel, _ := filepath.Rel(tt.root, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: collectNotes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	*notesDir = filepath.Join(vault, "missing")
+	if _, err := collectNotes(); err == nil {
+		t.Error("collectNotes of a missing path returned no error")
+	}
+}
+
+func TestIsDraft(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		tags       []string
+		want       bool
+	}{
+		{"draft property", map[string]interface{}{"draft": true}, nil, true},
+		{"published", map[string]interface{}{"draft": false}, []string{"blog"}, false},
+		{"status", map[string]interface{}{"status": " Draft "}, nil, true},
+		{"other status", map[string]interface{}{"status": "done"}, nil, false},
+		{"draft tag", map[string]interface{}{}, []string{"blog", "draft"}, true},
+		{"draft as text", map[string]interface{}{"draft": "true"}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := isDraft(tt.properties, tt.tags); got != tt.want {
+			t.Errorf("%s: isDraft = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"2023-04-01", time.Date(2023, 4, 1, 0, 0, 0, 0, time.Local), true},
+		{" 2023-04-01 10:30 ", time.Date(2023, 4, 1, 10, 30, 0, 0, time.Local), true},
+		{"2023-04-01T10:30:15", time.Date(2023, 4, 1, 10, 30, 15, 0, time.Local), true},
+		{"2023-04-01T10:30:00Z", time.Date(2023, 4, 1, 10, 30, 0, 0, time.UTC), true},
+		{"April 1st", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDate(tt.value)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = (%v, %t), want (%v, %t)", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRenderTableImage(t *testing.T) {
+	tests := []struct {
+		hint, want string
+	}{
+		{"", `<img src="image.png" alt="">`},
+		{"300", `<img src="image.png" alt="" width="300">`},
+		{"300x200", `<img src="image.png" alt="" width="300" height="200">`},
+		{"50%", `<img src="image.png" alt="" style="width: 50%;">`},
+		{"Sunset <3|300", `<img src="image.png" alt="Sunset &lt;3" width="300">`},
+	}
+	for _, tt := range tests {
+		if got := renderTableImage("image.png", tt.hint); got != tt.want {
+			t.Errorf("renderTableImage(%q) = %q, want %q", tt.hint, got, tt.want)
+		}
+	}
+}
+
+func TestRenderImageCaption(t *testing.T) {
+	saved := *widthUnit
+	t.Cleanup(func() { *widthUnit = saved })
+
+	tests := []struct {
+		unit, hint, want string
+	}{
+		{"px", "Sunset", `{{< figure src="image.png" alt="Sunset" caption="Sunset" >}}`},
+		{"px", "Sunset|300", `{{< figure src="image.png" width="300" caption="Sunset" >}}`},
+		{"px", "300|Sunset", `{{< figure src="image.png" width="300" caption="Sunset" >}}`},
+		{"px", `Say "hi"`, `{{< figure src="image.png" alt="Say &#34;hi&#34;" caption="Say &#34;hi&#34;" >}}`},
+		{"class", "Sunset|50%", `{{< figure src="image.png" class="width-50" caption="Sunset" >}}`},
+		{"percent", "Sunset|300", `<figure><img src="image.png" alt="Sunset" style="width: 300px;"><figcaption>Sunset</figcaption></figure>`},
+	}
+	for _, tt := range tests {
+		*widthUnit = tt.unit
+		if got := renderImage("image.png", tt.hint); got != tt.want {
+			t.Errorf("renderImage(%q) with --width-unit=%q = %q, want %q", tt.hint, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestProcessAttachmentsTableCell(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "image.png", "other.png")
+
+	input := "| Picture |\n| --- |\n| ![[image.png\\|300]] |\n\n![[other.png|300]]"
+	content, _, err := processAttachments(input, bundleDir, "post", notePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`| <img src="post-1.png" alt="" width="300"> |`,
+		"\n\n" + renderImage("post-2.png", "300"),
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content = %q, want it to contain %q", content, want)
+		}
+	}
+	if strings.Contains(content, "![[") {
+		t.Errorf("content = %q, embeds left unconverted", content)
+	}
+}
+
+func TestRemoveEmptyKeys(t *testing.T) {
+	properties := map[string]interface{}{
+		"title":   "",
+		"tags":    []interface{}{},
+		"summary": nil,
+		"author":  "  ",
+		"aliases": []interface{}{},
+		"weight":  0,
+		"pinned":  false,
+		"series":  "go",
+	}
+	removeEmptyKeys(properties)
+	want := map[string]interface{}{"title": "", "tags": []interface{}{}, "weight": 0, "pinned": false, "series": "go"}
+	if !reflect.DeepEqual(properties, want) {
+		t.Errorf("properties = %v, want %v", properties, want)
+	}
+}
+
+func TestProcessAttachmentsDownloadLinks(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "report.pdf", "image.png")
+
+	input := "Get [[report.pdf]] or [[report.pdf|the report]], see ![[image.png]] and [[Other note]]"
+	content, _, err := processAttachments(input, bundleDir, "post", notePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Get [report.pdf](post-2.pdf) or [the report](post-2.pdf), see ![](post-1.png) and [[Other note]]"; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	if _, err := os.Stat(filepath.Join(bundleDir, "post-2.pdf")); err != nil {
+		t.Errorf("linked attachment was not copied: %v", err)
+	}
+}
+
+func TestPublishOverride(t *testing.T) {
+	saved := *publishOverrideKey
+	t.Cleanup(func() { *publishOverrideKey = saved })
+
+	tests := []struct {
+		key               string
+		value             interface{}
+		publish, override bool
+	}{
+		{"", true, false, false},
+		{"hugoPublish", true, true, true},
+		{"hugoPublish", false, false, true},
+		{"hugoPublish", " Yes ", true, true},
+		{"hugoPublish", "no", false, true},
+		{"hugoPublish", "maybe", false, false},
+		{"hugoPublish", nil, false, false},
+	}
+	for _, tt := range tests {
+		*publishOverrideKey = tt.key
+		properties := map[string]interface{}{"hugoPublish": tt.value}
+		if publish, ok := publishOverride(properties); publish != tt.publish || ok != tt.override {
+			t.Errorf("publishOverride with --publish-override-key=%q and %v = (%t, %t), want (%t, %t)", tt.key, tt.value, publish, ok, tt.publish, tt.override)
+		}
+	}
+}
+
+func TestProcessAttachmentsSharding(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "image.png")
+	savedNaming, savedSharding := *attachmentNaming, *attachmentSharding
+	*attachmentNaming, *attachmentSharding = "hash", true
+	t.Cleanup(func() { *attachmentNaming, *attachmentSharding = savedNaming, savedSharding })
+
+	hash, err := calculateMD5(filepath.Join(filepath.Dir(notePath), "image.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _, err := processAttachments("![[image.png]]", bundleDir, "post", notePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharded := hash[:2] + "/" + hash + ".png"
+	if want := "![](" + sharded + ")"; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	if _, err := os.Stat(filepath.Join(bundleDir, filepath.FromSlash(sharded))); err != nil {
+		t.Errorf("attachment was not copied into the shard: %v", err)
+	}
+
+	planned, err := plannedAttachments(bundleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := planned[sharded]; !ok || len(planned) != 1 {
+		t.Errorf("plannedAttachments = %v, want only %s", planned, sharded)
+	}
+}
+
+func TestCopyModTime(t *testing.T) {
+	dir := t.TempDir()
+	source, target := filepath.Join(dir, "Note.md"), filepath.Join(dir, "index.md")
+	for _, path := range []string{source, target} {
+		if err := os.WriteFile(path, []byte("Text"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := time.Date(2023, 5, 6, 7, 8, 9, 0, time.Local)
+	if err := os.Chtimes(source, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	copyModTime(source, target)
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("target mtime = %v, want %v", info.ModTime(), mtime)
+	}
+}
+
+func TestProcessAttachmentsResources(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "image.png", "photo.jpg", "report.pdf")
+
+	input := "![[image.png|Nice shot]] ![[photo.jpg|300]] [[report.pdf|The report]] ![[image.png]]"
+	_, copier, err := processAttachments(input, bundleDir, "post", notePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := copier.resources
+	want := []interface{}{
+		map[string]interface{}{"src": "post-1.png", "title": "Nice shot"},
+		map[string]interface{}{"src": "post-2.jpg", "title": "photo"},
+		map[string]interface{}{"src": "post-3.pdf", "title": "The report"},
+	}
+	if !reflect.DeepEqual(resources, want) {
+		t.Errorf("resources = %v, want %v", resources, want)
+	}
+}
+
+func TestMergeResources(t *testing.T) {
+	custom := map[string]interface{}{"src": "post-1.png", "title": "Custom", "params": map[string]interface{}{"credit": "me"}}
+	properties := map[string]interface{}{"resources": []interface{}{custom}}
+	mergeResources(properties, []interface{}{
+		map[string]interface{}{"src": "post-1.png", "title": "Generated"},
+		map[string]interface{}{"src": "post-2.png", "title": "Other"},
+	})
+	want := []interface{}{custom, map[string]interface{}{"src": "post-2.png", "title": "Other"}}
+	if !reflect.DeepEqual(properties["resources"], want) {
+		t.Errorf("resources = %v, want %v", properties["resources"], want)
+	}
+}
+
+func TestIncludeResources(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "shared/table.csv")
+	noteDir := filepath.Dir(notePath)
+	for _, name := range []string{"data/a.csv", "data/b.csv", "data/readme.txt"} {
+		path := filepath.Join(noteDir, "local", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copier := &attachmentCopier{targetDir: bundleDir, bundle: "post", notePath: notePath, copied: make(map[string]string)}
+	copier.includeResources([]string{"local/data/*.csv", "shared/*.csv", "missing/*.csv"}, noteDir)
+	if got, want := copier.files(), []string{"a.csv", "b.csv", "table.csv"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files = %v, want %v", got, want)
+	}
+	for _, name := range []string{"a.csv", "b.csv", "table.csv"} {
+		if _, err := os.Stat(filepath.Join(bundleDir, name)); err != nil {
+			t.Errorf("%s was not copied: %v", name, err)
+		}
+	}
+}
+
+func TestProcessNotesConcurrently(t *testing.T) {
+	notePath, _ := attachmentVault(t, "shared.png")
+	vault := filepath.Dir(notePath)
+	const notes = 40
+	for i := 0; i < notes; i++ {
+		content := fmt.Sprintf("---\ntitle: Note %d\n---\n\nSee [[Note %d]].\n\n![[shared.png]]\n", i, (i+1)%notes)
+		if err := os.WriteFile(filepath.Join(vault, fmt.Sprintf("Note %d.md", i)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	postsDir := t.TempDir()
+	savedNotes, savedPosts, savedNoFilter := *notesDir, *hugoPostsDir, *noFilter
+	savedIndex, savedAliases, savedFollowed := noteIndex, aliasIndex, followedNotes
+	*notesDir, *hugoPostsDir, *noFilter = vault, postsDir, true
+	noteIndex, aliasIndex, followedNotes = make(map[string]*publishedNote), make(map[string]string), make(map[string]struct{})
+	t.Cleanup(func() {
+		*notesDir, *hugoPostsDir, *noFilter = savedNotes, savedPosts, savedNoFilter
+		noteIndex, aliasIndex, followedNotes = savedIndex, savedAliases, savedFollowed
+	})
+
+	notePaths, err := collectNotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildNoteIndex(notePaths)
+
+	missing := []string{filepath.Join(vault, "Missing B.md"), filepath.Join(vault, "Missing A.md")}
+	err = processNotesConcurrently(append(missing, notePaths...), 8)
+	if err == nil {
+		t.Fatal("processNotesConcurrently returned nil, want errors for missing notes")
+	}
+	if a, b := strings.Index(err.Error(), "Missing A.md"), strings.Index(err.Error(), "Missing B.md"); a < 0 || b < 0 || a > b {
+		t.Errorf("error = %q, want both missing notes in path order", err)
+	}
+	if n := strings.Count(err.Error(), "Missing A.md"); n != 1 {
+		t.Errorf("error = %q, want the path of Missing A.md once, got %d times", err, n)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("error = %q, want it to wrap os.ErrNotExist", err)
+	}
+
+	for i := 0; i < notes; i++ {
+		bundle := filepath.Join(postsDir, fmt.Sprintf("Note %d", i))
+		data, err := os.ReadFile(filepath.Join(bundle, "index.md"))
+		if err != nil {
+			t.Errorf("note %d: %v", i, err)
+			continue
+		}
+		content := string(data)
+		if want := fmt.Sprintf(`relref "Note %d"`, (i+1)%notes); !strings.Contains(content, want) {
+			t.Errorf("note %d = %q, want it to contain %q", i, content, want)
+		}
+		if _, err := os.Stat(filepath.Join(bundle, fmt.Sprintf("note-%d-1.png", i))); err != nil {
+			t.Errorf("note %d: attachment was not copied: %v", i, err)
+		}
+	}
+}
+
+func TestFilterTagList(t *testing.T) {
+	saved := filterTags
+	t.Cleanup(func() { filterTags = saved })
+	filterTags = tagList{tags: []string{"blog"}}
+
+	for _, value := range []string{"til, notes", "blog"} {
+		if err := filterTags.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"til", "notes", "blog"}; !reflect.DeepEqual(filterTags.tags, want) {
+		t.Errorf("--filter-tag = %v, want %v (the default replaced, later values appended)", filterTags.tags, want)
+	}
+
+	tests := []struct {
+		noteTags []string
+		want     string
+		ok       bool
+	}{
+		{[]string{"go", "notes"}, "notes", true},
+		{[]string{"blog", "til"}, "til", true},
+		{[]string{"go"}, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := matchFilterTag(tt.noteTags); got != tt.want || ok != tt.ok {
+			t.Errorf("matchFilterTag(%v) = %q, %t, want %q, %t", tt.noteTags, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDefaultPageType(t *testing.T) {
+	savedType, savedFrom, savedMapping, savedNotes := *pageType, *setTypeFrom, typeMapping, *notesDir
+	t.Cleanup(func() {
+		*pageType, *setTypeFrom, typeMapping, *notesDir = savedType, savedFrom, savedMapping, savedNotes
+	})
+	*notesDir = "/vault"
+	typeMapping = parseKeyValueList("til=til, recipe=recipe")
+
+	tests := []struct {
+		name, pageType, from, path string
+		tags                       []string
+		want                       string
+	}{
+		{"fixed type", "post", "tag", "/vault/Note.md", []string{"til"}, "post"},
+		{"folder", "", "folder", "/vault/Recipes/Soup/Note.md", nil, "Recipes"},
+		{"root folder", "", "folder", "/vault/Note.md", nil, ""},
+		{"mapped tag", "", "tag", "/vault/Note.md", []string{"blog", "recipe"}, "recipe"},
+		{"unmapped tag", "", "tag", "/vault/Note.md", []string{"blog"}, ""},
+		{"not set", "", "", "/vault/Note.md", []string{"til"}, ""},
+	}
+	for _, tt := range tests {
+		*pageType, *setTypeFrom = tt.pageType, tt.from
+		if got := defaultPageType(tt.path, tt.tags); got != tt.want {
+			t.Errorf("%s: defaultPageType(%q, %v) = %q, want %q", tt.name, tt.path, tt.tags, got, tt.want)
+		}
+	}
+}
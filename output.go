@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputTemplate — пользовательский шаблон итогового файла (--output-template).
+// Если он не задан, файл собирается в стандартном виде.
+var outputTemplate *template.Template
+
+// templateData — данные, которые получает шаблон итогового файла.
+type templateData struct {
+	FrontMatter map[string]interface{} // Свойства заметки
+	YAML        string                 // Front matter в YAML с сохранением порядка ключей
+	Content     string                 // Обработанный текст заметки
+}
+
+// templateFuncs — функции, доступные в шаблоне итогового файла.
+var templateFuncs = template.FuncMap{
+	"toYAML": func(v interface{}) (string, error) {
+		out, err := yaml.Marshal(v)
+		return string(out), err
+	},
+	"toJSON": func(v interface{}) (string, error) {
+		out, err := json.MarshalIndent(v, "", "  ")
+		return string(out), err
+	},
+}
+
+// loadOutputTemplate читает и разбирает шаблон итогового файла.
+func loadOutputTemplate(path string) error {
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать шаблон %s: %w", path, err)
+	}
+	tmpl, err := template.New(path).Funcs(templateFuncs).Parse(string(contentBytes))
+	if err != nil {
+		return fmt.Errorf("не удалось разобрать шаблон %s: %w", path, err)
+	}
+	outputTemplate = tmpl
+	return nil
+}
+
+// renderOutputTemplate собирает итоговый файл по пользовательскому шаблону.
+func renderOutputTemplate(properties map[string]interface{}, yamlHeader, content string) (string, error) {
+	var sb strings.Builder
+	data := templateData{FrontMatter: properties, YAML: yamlHeader, Content: content}
+	if err := outputTemplate.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("не удалось применить шаблон: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// printConfig выводит в w итоговые значения всех параметров запуска в формате YAML.
+func printConfig(w io.Writer) error {
+	config := make(map[string]interface{})
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "dump-config" || f.Name == "config" {
+			return
+		}
+		if getter, ok := f.Value.(flag.Getter); ok {
+			config[f.Name] = getter.Get()
+		} else {
+			config[f.Name] = f.Value.String()
+		}
+	})
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("не удалось сформировать конфигурацию: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
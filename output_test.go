@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestOutputTemplate(t *testing.T) {
+	saved := outputTemplate
+	t.Cleanup(func() { outputTemplate = saved })
+
+	dir := t.TempDir()
+	tmplPath := filepath.Join(dir, "post.tmpl")
+	tmpl := "+++\n{{ .FrontMatter.title }}\n+++\n{{ toJSON .FrontMatter.tags }}\n{{ if .YAML }}yaml\n{{ end }}{{ .Content }}"
+	if err := os.WriteFile(tmplPath, []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadOutputTemplate(tmplPath); err != nil {
+		t.Fatal(err)
+	}
+
+	properties := map[string]interface{}{"title": "Note", "tags": []interface{}{"blog"}}
+	got, err := writeFinalNote(properties, nil, "Text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "+++\nNote\n+++\n[\n  \"blog\"\n]\nyaml\nText"; got != want {
+		t.Errorf("writeFinalNote = %q, want %q", got, want)
+	}
+}
+
+func TestLoadOutputTemplateErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.tmpl")
+	if err := os.WriteFile(broken, []byte("{{ .Content "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{broken, filepath.Join(dir, "missing.tmpl")} {
+		if err := loadOutputTemplate(path); err == nil {
+			t.Errorf("loadOutputTemplate(%q) returned no error", path)
+		}
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	saved := *hugoPostsDir
+	t.Cleanup(func() { *hugoPostsDir = saved })
+	if err := flag.Set("hugo-posts-dir", "/site/content/posts"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := printConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(buf.Bytes(), &config); err != nil {
+		t.Fatalf("printConfig output is not YAML: %v\n%s", err, buf.String())
+	}
+	if got := config["hugo-posts-dir"]; got != "/site/content/posts" {
+		t.Errorf("hugo-posts-dir = %v, want /site/content/posts", got)
+	}
+	if got := config["remove-filter-tag"]; got != false {
+		t.Errorf("remove-filter-tag = %v, want false", got)
+	}
+	if _, ok := config["dump-config"]; ok {
+		t.Error("printConfig included dump-config itself")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// cyrillicTranslit — транслитерация кириллицы латиницей для адресов.
+var cyrillicTranslit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u",
+}
+
+// slugify превращает имя заметки в имя каталога для адреса: нижний регистр,
+// кириллица транслитерируется, прочие символы вне ASCII удаляются, а пробелы
+// и знаки препинания заменяются одним дефисом. "Моя первая заметка!" → "moya-pervaya-zametka".
+// Если от имени ничего не остается (например, оно целиком на китайском или греческом),
+// возвращаются первые 8 символов MD5-хэша имени, чтобы разные заметки не получили
+// один каталог. Пустая строка возвращается только для пустого имени.
+func slugify(name string) string {
+	var sb strings.Builder
+	pendingDash := false
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if pendingDash && sb.Len() > 0 {
+			sb.WriteByte('-')
+		}
+		pendingDash = false
+		sb.WriteString(s)
+	}
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			write(string(r))
+		case cyrillicTranslit[r] != "":
+			write(cyrillicTranslit[r])
+		case r == 'ъ' || r == 'ь' || r == '\'' || r == '’':
+			// Знаки, которые не разделяют слова
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			// Прочие символы вне ASCII удаляются
+		default:
+			pendingDash = true
+		}
+	}
+	if sb.Len() == 0 && strings.TrimSpace(name) != "" {
+		sum := md5.Sum([]byte(name))
+		return hex.EncodeToString(sum[:])[:8]
+	}
+	return sb.String()
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Моя первая заметка", "moya-pervaya-zametka"},
+		{"Щука и Ёж", "shchuka-i-ezh"},
+		{"Объявление", "obyavlenie"},
+		{"Hello World", "hello-world"},
+		{"MiXeD CaSe Заметка", "mixed-case-zametka"},
+		{"Привет, мир!", "privet-mir"},
+		{"  --Итоги: 2024 (черновик)--  ", "itogi-2024-chernovik"},
+		{"don't stop", "dont-stop"},
+		{"a/b\\c", "a-b-c"},
+		{"Café Ελλάδα ok", "caf-ok"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.name); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBundleNameFromTitle(t *testing.T) {
+	savedSlugify, savedFromTitle := *slugifyBundles, *slugFromTitle
+	t.Cleanup(func() { *slugifyBundles, *slugFromTitle = savedSlugify, savedFromTitle })
+
+	tests := []struct {
+		slugify, fromTitle bool
+		naming             bundleNaming
+		want               string
+	}{
+		{false, true, bundleNaming{title: "Мой пост"}, "Заметка 1"},
+		{true, false, bundleNaming{title: "Мой пост"}, "zametka-1"},
+		{true, true, bundleNaming{title: "Мой пост"}, "moy-post"},
+		{true, true, bundleNaming{slug: "custom", title: "Мой пост"}, "custom"},
+		{true, true, bundleNaming{title: "!!!"}, slugify("!!!")},
+	}
+	for _, tt := range tests {
+		*slugifyBundles, *slugFromTitle = tt.slugify, tt.fromTitle
+		if got := bundleName("/vault/Заметка 1.md", tt.naming); got != tt.want {
+			t.Errorf("bundleName with --slugify=%t --slug-from-title=%t, %+v = %q, want %q", tt.slugify, tt.fromTitle, tt.naming, got, tt.want)
+		}
+	}
+}
+
+func TestBundleNameFromProperties(t *testing.T) {
+	savedSlugify, savedFromProperties := *slugifyBundles, *nameFromProperties
+	t.Cleanup(func() { *slugifyBundles, *nameFromProperties = savedSlugify, savedFromProperties })
+	*slugifyBundles, *nameFromProperties = false, true
+
+	tests := []struct {
+		naming bundleNaming
+		want   string
+	}{
+		{bundleNaming{slug: "my-post", url: "/posts/other/"}, "my-post"},
+		{bundleNaming{slug: "2024/my-post"}, "2024-my-post"},
+		{bundleNaming{url: "/posts/my-post/"}, "my-post"},
+		{bundleNaming{url: "/"}, "Note"},
+		{bundleNaming{url: "/posts/.."}, "Note"},
+		{bundleNaming{}, "Note"},
+	}
+	for _, tt := range tests {
+		if got := bundleName("/vault/Note.md", tt.naming); got != tt.want {
+			t.Errorf("bundleName with --bundle-name-from-properties, %+v = %q, want %q", tt.naming, got, tt.want)
+		}
+	}
+}
+
+func TestSlugifyFallsBackToHash(t *testing.T) {
+	for _, name := range []string{"你好世界", "Ελληνικά", "!!!"} {
+		got := slugify(name)
+		if len(got) != 8 {
+			t.Errorf("slugify(%q) = %q, want an 8-character hash", name, got)
+		}
+		if got != slugify(name) {
+			t.Errorf("slugify(%q) is not stable", name)
+		}
+	}
+	if slugify("你好") == slugify("世界") {
+		t.Errorf("different names that slug to nothing must not share a directory")
+	}
+}
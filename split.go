@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// noteSection — раздел заметки, ставший отдельной страницей при --split-by-heading.
+type noteSection struct {
+	title string
+	body  []string
+}
+
+// splitByHeading делит текст на вступление (до первого заголовка уровня level)
+// и разделы, начинающиеся с заголовков этого уровня. Блоки кода не учитываются.
+func splitByHeading(content string, level int) (string, []noteSection) {
+	var intro []string
+	var sections []noteSection
+	inCode := false
+	for _, line := range strings.Split(content, "\n") {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+		}
+		if !inCode {
+			if match := headingPattern.FindStringSubmatch(line); match != nil && len(match[1]) == level {
+				sections = append(sections, noteSection{title: strings.TrimSpace(match[2])})
+				continue
+			}
+		}
+		if len(sections) == 0 {
+			intro = append(intro, line)
+		} else {
+			last := &sections[len(sections)-1]
+			last.body = append(last.body, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(intro, "\n")), sections
+}
+
+// splitHeadingLevel разбирает значение --split-by-heading (h1..h6) в уровень заголовка.
+func splitHeadingLevel(value string) (int, bool) {
+	var level int
+	if _, err := fmt.Sscanf(strings.ToLower(value), "h%d", &level); err != nil || level < 1 || level > 6 {
+		return 0, false
+	}
+	return level, true
+}
+
+// writeSplitNote записывает заметку как раздел Hugo: вступление становится _index.md
+// в каталоге поста, а каждый раздел — страницей <якорь заголовка>/index.md с front matter
+// заметки, собственным title и weight по порядку (см. sectionDirNames) и без ее
+// адреса (см. sectionAddress). Вложения,
+// на которые ссылается раздел, копируются в его каталог. sourcePath — путь к исходной заметке.
+func writeSplitNote(properties map[string]interface{}, original *yaml.Node, content, bundleDir, sourcePath string, level int) error {
+	intro, sections := splitByHeading(content, level)
+
+	indexContent, err := writeFinalNote(properties, original, intro)
+	if err != nil {
+		return err
+	}
+	indexPath := filepath.Join(bundleDir, "_index.md")
+	if err := writeFile(indexPath, []byte(indexContent)); err != nil {
+		return fmt.Errorf("не удалось записать итоговую заметку %s: %w", indexPath, err)
+	}
+	if *preserveMtime {
+		copyModTime(sourcePath, indexPath)
+	}
+	logf(INFO, "Вступление заметки сохранено как: %s", indexPath)
+
+	// index.md превратил бы каталог в leaf bundle, и Hugo не увидел бы разделы
+	leafIndex := filepath.Join(bundleDir, "index.md")
+	if _, err := os.Stat(leafIndex); err == nil {
+		if err := removeFile(leafIndex); err != nil {
+			return fmt.Errorf("не удалось удалить %s: %w", leafIndex, err)
+		}
+		logf(INFO, "Удален устаревший файл %s", leafIndex)
+	}
+
+	attachments, err := plannedAttachments(bundleDir)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать каталог поста %s: %w", bundleDir, err)
+	}
+
+	names := sectionDirNames(sections)
+	for i, section := range sections {
+		sectionDir := filepath.Join(bundleDir, names[i])
+		if err := mkdirAll(sectionDir); err != nil {
+			return fmt.Errorf("не удалось создать каталог раздела %s: %w", sectionDir, err)
+		}
+
+		sectionProperties := make(map[string]interface{}, len(properties)+2)
+		for key, value := range properties {
+			sectionProperties[key] = value
+		}
+		sectionProperties["title"] = section.title
+		sectionProperties["weight"] = i + 1
+		sectionAddress(sectionProperties, names[i])
+
+		body := strings.TrimSpace(strings.Join(section.body, "\n"))
+		for name, source := range attachments {
+			if !strings.Contains(body, name) {
+				continue
+			}
+			if err := placeAttachment(source, filepath.Join(sectionDir, filepath.FromSlash(name))); err != nil {
+				reportError(&AttachmentError{Path: sourcePath, Attachment: name, Err: fmt.Errorf("раздел '%s': %w", section.title, err)})
+			}
+		}
+
+		sectionContent, err := writeFinalNote(sectionProperties, original, body)
+		if err != nil {
+			return err
+		}
+		sectionPath := filepath.Join(sectionDir, "index.md")
+		if err := writeFile(sectionPath, []byte(sectionContent)); err != nil {
+			return fmt.Errorf("не удалось записать раздел %s: %w", sectionPath, err)
+		}
+		if *preserveMtime {
+			copyModTime(sourcePath, sectionPath)
+		}
+		logf(INFO, "Раздел '%s' сохранен как: %s", section.title, sectionPath)
+	}
+	return nil
+}
+
+// sectionAddress заменяет в свойствах раздела адрес, унаследованный от заметки:
+// у Hugo не должно быть нескольких страниц с одним url или псевдонимом. Раздел
+// получает url заметки с именем своего каталога, а slug и aliases удаляются.
+func sectionAddress(properties map[string]interface{}, dirName string) {
+	if url, ok := properties["url"].(string); ok && url != "" {
+		properties["url"] = strings.TrimSuffix(url, "/") + "/" + dirName + "/"
+	} else {
+		delete(properties, "url")
+	}
+	delete(properties, "slug")
+	delete(properties, "aliases")
+}
+
+// sectionDirNames возвращает имена каталогов разделов: якоря заголовков, у повторяющихся
+// якорей — с суффиксами -1, -2 и т.д., как у якорей Hugo. Разделы, у заголовков которых
+// якорь пустой (например, из одних знаков препинания), получают имя section-<номер>,
+// иначе их index.md попал бы в сам каталог поста.
+func sectionDirNames(sections []noteSection) []string {
+	names := make([]string, len(sections))
+	used := make(map[string]struct{})
+	for i, section := range sections {
+		base := headingAnchor(section.title)
+		if base == "" {
+			base = fmt.Sprintf("section-%d", i+1)
+		}
+		name := base
+		for n := 1; ; n++ {
+			if _, taken := used[name]; !taken {
+				break
+			}
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[name] = struct{}{}
+		names[i] = name
+	}
+	return names
+}
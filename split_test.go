@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitByHeading(t *testing.T) {
+	content := "Intro.\n\n## First\n\nOne.\n\n### Sub\n\nSub text.\n\n```\n## Not a heading\n```\n\n## Second\n\nTwo."
+	intro, sections := splitByHeading(content, 2)
+	if intro != "Intro." {
+		t.Errorf("intro = %q, want %q", intro, "Intro.")
+	}
+	var titles []string
+	for _, section := range sections {
+		titles = append(titles, section.title)
+	}
+	if want := []string{"First", "Second"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("section titles = %v, want %v", titles, want)
+	}
+	if body := strings.Join(sections[0].body, "\n"); !strings.Contains(body, "### Sub") || !strings.Contains(body, "## Not a heading") {
+		t.Errorf("first section body = %q, want subheadings and code kept", body)
+	}
+}
+
+func TestSplitHeadingLevel(t *testing.T) {
+	tests := []struct {
+		value string
+		level int
+		ok    bool
+	}{
+		{"h2", 2, true},
+		{"H1", 1, true},
+		{"h7", 0, false},
+		{"2", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		if level, ok := splitHeadingLevel(tt.value); level != tt.level || ok != tt.ok {
+			t.Errorf("splitHeadingLevel(%q) = (%d, %t), want (%d, %t)", tt.value, level, ok, tt.level, tt.ok)
+		}
+	}
+}
+
+func TestSectionDirNames(t *testing.T) {
+	sections := []noteSection{{title: "Setup"}, {title: "Setup"}, {title: "!!!"}, {title: "Usage"}}
+	if got, want := sectionDirNames(sections), []string{"setup", "setup-1", "section-3", "usage"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sectionDirNames = %v, want %v", got, want)
+	}
+}
+
+func TestSectionAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{"no address", map[string]interface{}{"title": "Part"}, map[string]interface{}{"title": "Part"}},
+		{"url", map[string]interface{}{"url": "/guide/"}, map[string]interface{}{"url": "/guide/setup/"}},
+		{"url without slash", map[string]interface{}{"url": "/guide"}, map[string]interface{}{"url": "/guide/setup/"}},
+		{"slug and aliases", map[string]interface{}{"slug": "guide", "aliases": []string{"/old/"}}, map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		sectionAddress(tt.properties, "setup")
+		if !reflect.DeepEqual(tt.properties, tt.want) {
+			t.Errorf("%s: properties = %v, want %v", tt.name, tt.properties, tt.want)
+		}
+	}
+}
+
+func TestWriteSplitNote(t *testing.T) {
+	bundleDir := t.TempDir()
+	properties := map[string]interface{}{"title": "Guide", "url": "/guide/", "aliases": []interface{}{"/old-guide/"}}
+	if err := writeSplitNote(properties, nil, "Intro.\n\n## Setup\n\nSteps.", bundleDir, filepath.Join(t.TempDir(), "Guide.md"), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(bundleDir, "_index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "/old-guide/") || !strings.Contains(string(index), "Intro.") {
+		t.Errorf("_index.md = %q, want the note's aliases and intro", index)
+	}
+
+	section, err := os.ReadFile(filepath.Join(bundleDir, "setup", "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"title: Setup", "weight: 1", "url: /guide/setup/", "Steps."} {
+		if !strings.Contains(string(section), want) {
+			t.Errorf("setup/index.md = %q, want it to contain %q", section, want)
+		}
+	}
+	if strings.Contains(string(section), "old-guide") {
+		t.Errorf("setup/index.md = %q, want no aliases copied from the note", section)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// noteState — сведения о заметке, сконвертированной при прошлом запуске (--state-file).
+type noteState struct {
+	Hash   string `json:"hash"`   // отпечаток заметки, ее вложений и заметок, на которые она ссылается
+	Target string `json:"target"` // записанный файл поста
+}
+
+// syncState — содержимое файла состояния. Если параметры запуска изменились
+// (Settings не совпадает), все заметки конвертируются заново.
+var syncState = struct {
+	sync.Mutex
+	Settings string                `json:"settings"`
+	Notes    map[string]*noteState `json:"notes"`
+	previous string
+}{Notes: make(map[string]*noteState)}
+
+// ignoredSettings — параметры, которые не влияют на содержимое постов: журнал
+// и предупреждения, код завершения, режим запуска и служебные файлы. Остальные
+// параметры входят в отпечаток, чтобы новый параметр по ошибке не оставил старые посты.
+var ignoredSettings = map[string]bool{
+	"state-file": true, "dry-run": true, "log-level": true, "concurrency": true, "workers": true,
+	"config": true, "dump-config": true, "strict": true, "watch": true, "clean": true,
+	"attachment-cache": true, "warn-reserved-params": true,
+}
+
+// loadState читает файл состояния. Отсутствующий файл означает первый запуск.
+func loadState(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать файл состояния %s: %w", path, err)
+	}
+	syncState.Lock()
+	defer syncState.Unlock()
+	if err := json.Unmarshal(data, &syncState); err != nil {
+		return fmt.Errorf("не удалось разобрать файл состояния %s: %w", path, err)
+	}
+	if syncState.Notes == nil {
+		syncState.Notes = make(map[string]*noteState)
+	}
+	syncState.previous = syncState.Settings
+	syncState.Settings = settingsFingerprint()
+	if syncState.previous != syncState.Settings {
+		logf(INFO, "Параметры запуска изменились с прошлого раза, все заметки будут сконвертированы заново.")
+	}
+	logf(DEBUG, "Загружено состояние %d заметок из %s", len(syncState.Notes), path)
+	return nil
+}
+
+// saveState записывает файл состояния.
+func saveState(path string) error {
+	syncState.Lock()
+	defer syncState.Unlock()
+	syncState.Settings = settingsFingerprint()
+	data, err := json.MarshalIndent(&syncState, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("не удалось записать файл состояния %s: %w", path, err)
+	}
+	return nil
+}
+
+// settingsFingerprint возвращает отпечаток параметров, влияющих на содержимое постов,
+// вместе с шаблоном --output-template.
+func settingsFingerprint() string {
+	hash := sha256.New()
+	flag.VisitAll(func(f *flag.Flag) {
+		if !ignoredSettings[f.Name] {
+			fmt.Fprintf(hash, "%s=%s\n", f.Name, f.Value.String())
+		}
+	})
+	if *outputTmplPath != "" {
+		if data, err := os.ReadFile(*outputTmplPath); err == nil {
+			hash.Write(data)
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// noteFingerprint возвращает отпечаток исходного текста заметки, вложений и встроенных
+// заметок, на которые она ссылается (размер и время изменения), и опубликованных заметок,
+// на которые ведут ее вики-ссылки (каталог поста и якоря заголовков). path — путь к заметке.
+func noteFingerprint(fullContent, path string) string {
+	hash := sha256.New()
+	hash.Write([]byte(fullContent))
+
+	var attachments []string
+	for _, match := range attachmentPattern.FindAllStringSubmatch(fullContent, -1) {
+		filename, _ := parseEmbed(match[1])
+		attachments = append(attachments, filename)
+	}
+	for _, link := range attachmentLinks(fullContent, filepath.Dir(path)) {
+		attachments = append(attachments, link.filename)
+	}
+	sort.Strings(attachments)
+	for _, filename := range attachments {
+		source, _ := findAttachment(filename, filepath.Dir(path))
+		if info, err := os.Stat(source); err == nil {
+			fmt.Fprintf(hash, "\x00%s %d %d", filename, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(hash, "\x00%s missing", filename)
+		}
+	}
+
+	for _, embedded := range transcludedNotes(fullContent) {
+		if info, err := os.Stat(embedded); err == nil {
+			fmt.Fprintf(hash, "\x00![[%s]] %d %d", embedded, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+
+	for _, key := range linkedNotes(fullContent) {
+		note, ok := noteIndex[key]
+		if !ok {
+			note, ok = noteIndex[aliasIndex[key]]
+		}
+		if !ok {
+			fmt.Fprintf(hash, "\x00[[%s]] missing", key)
+			continue
+		}
+		anchors := make([]string, 0, len(note.anchors))
+		for anchor := range note.anchors {
+			anchors = append(anchors, anchor)
+		}
+		sort.Strings(anchors)
+		fmt.Fprintf(hash, "\x00[[%s]] %s %s", key, note.bundle, strings.Join(anchors, ","))
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// skipsUnchangedNotes сообщает, можно ли пропускать неизменившиеся заметки. В режиме
+// manifest манифест вложений переписывается целиком, а в раскладке flat имена вложений
+// общие для всех заметок, поэтому вложения каждой заметки нужно обработать заново.
+func skipsUnchangedNotes() bool {
+	return *attachmentMode != "manifest" && *layout != "flat"
+}
+
+// unchangedSinceLastRun проверяет, что заметка, ее вложения и параметры запуска
+// не менялись с прошлого запуска, а записанный тогда пост на месте.
+func unchangedSinceLastRun(path, fingerprint, target string) bool {
+	syncState.Lock()
+	defer syncState.Unlock()
+	if syncState.previous != syncState.Settings {
+		return false
+	}
+	state, ok := syncState.Notes[path]
+	if !ok || state.Hash != fingerprint || state.Target != target {
+		return false
+	}
+	_, err := os.Stat(target)
+	return err == nil
+}
+
+// recordNoteState запоминает отпечаток сконвертированной заметки. Заметки, при
+// обработке которых были ошибки, не запоминаются, чтобы ошибки выводились и при
+// следующем запуске.
+func recordNoteState(path, fingerprint, target string) {
+	if hasNoteErrors(path) {
+		return
+	}
+	syncState.Lock()
+	defer syncState.Unlock()
+	syncState.Notes[path] = &noteState{Hash: fingerprint, Target: target}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withEmptyState очищает состояние синхронизации на время теста.
+func withEmptyState(t *testing.T) {
+	t.Helper()
+	syncState.Lock()
+	savedSettings, savedNotes, savedPrevious := syncState.Settings, syncState.Notes, syncState.previous
+	syncState.Settings, syncState.Notes, syncState.previous = "", make(map[string]*noteState), ""
+	syncState.Unlock()
+	noteErrors.Lock()
+	savedErrors := noteErrors.list
+	noteErrors.list = nil
+	noteErrors.Unlock()
+	t.Cleanup(func() {
+		syncState.Lock()
+		syncState.Settings, syncState.Notes, syncState.previous = savedSettings, savedNotes, savedPrevious
+		syncState.Unlock()
+		noteErrors.Lock()
+		noteErrors.list = savedErrors
+		noteErrors.Unlock()
+	})
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	withEmptyState(t)
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	target := filepath.Join(dir, "Note", "index.md")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("post"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	recordNoteState("/vault/Note.md", "hash1", target)
+	if err := saveState(statePath); err != nil {
+		t.Fatal(err)
+	}
+	syncState.Notes = make(map[string]*noteState)
+	if err := loadState(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, path, hash, target string
+		want                     bool
+	}{
+		{"unchanged", "/vault/Note.md", "hash1", target, true},
+		{"changed note", "/vault/Note.md", "hash2", target, false},
+		{"new target", "/vault/Note.md", "hash1", filepath.Join(dir, "Other", "index.md"), false},
+		{"unknown note", "/vault/Other.md", "hash1", target, false},
+	}
+	for _, tt := range tests {
+		if got := unchangedSinceLastRun(tt.path, tt.hash, tt.target); got != tt.want {
+			t.Errorf("%s: unchangedSinceLastRun = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+
+	if err := os.Remove(target); err != nil {
+		t.Fatal(err)
+	}
+	if unchangedSinceLastRun("/vault/Note.md", "hash1", target) {
+		t.Error("unchangedSinceLastRun = true for a deleted post")
+	}
+}
+
+func TestLoadStateSettingsChanged(t *testing.T) {
+	withEmptyState(t)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	target := filepath.Join(t.TempDir(), "index.md")
+	if err := os.WriteFile(target, []byte("post"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statePath, []byte(`{"settings": "old", "notes": {"/vault/Note.md": {"hash": "h", "target": "`+filepath.ToSlash(target)+`"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadState(statePath); err != nil {
+		t.Fatal(err)
+	}
+	if unchangedSinceLastRun("/vault/Note.md", "h", filepath.ToSlash(target)) {
+		t.Error("unchangedSinceLastRun = true after the settings changed")
+	}
+}
+
+func TestLoadStateMissingAndBroken(t *testing.T) {
+	withEmptyState(t)
+	dir := t.TempDir()
+	if err := loadState(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("loadState of a missing file: %v", err)
+	}
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadState(broken); err == nil {
+		t.Error("loadState of a broken file returned no error")
+	}
+}
+
+func TestRecordNoteStateSkipsNotesWithErrors(t *testing.T) {
+	withEmptyState(t)
+	reportError(&LinkError{Path: "/vault/Broken.md", Target: "Missing", Reason: "заметка не найдена или не опубликована"})
+	recordNoteState("/vault/Broken.md", "h", "/site/Broken/index.md")
+	recordNoteState("/vault/Good.md", "h", "/site/Good/index.md")
+	if _, ok := syncState.Notes["/vault/Broken.md"]; ok {
+		t.Error("note with errors was recorded")
+	}
+	if _, ok := syncState.Notes["/vault/Good.md"]; !ok {
+		t.Error("note without errors was not recorded")
+	}
+}
+
+func TestNoteFingerprintTracksAttachments(t *testing.T) {
+	notePath, _ := attachmentVault(t, "image.png")
+	content := "Text ![[image.png]]"
+	before := noteFingerprint(content, notePath)
+	if again := noteFingerprint(content, notePath); again != before {
+		t.Error("noteFingerprint is not stable")
+	}
+	if other := noteFingerprint(content+" more", notePath); other == before {
+		t.Error("noteFingerprint did not change with the note text")
+	}
+
+	image := filepath.Join(filepath.Dir(notePath), "image.png")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(image, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if after := noteFingerprint(content, notePath); after == before {
+		t.Error("noteFingerprint did not change with the attachment")
+	}
+}
+
+func TestWorkersAliasDoesNotChangeSettings(t *testing.T) {
+	saved := *concurrency
+	t.Cleanup(func() { *concurrency = saved })
+	// Синоним регистрирует main
+	if flag.Lookup("workers") == nil {
+		flag.IntVar(concurrency, "workers", *concurrency, "")
+	}
+
+	before := settingsFingerprint()
+	if err := flag.Set("workers", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if *concurrency != 3 {
+		t.Errorf("--workers=3 set concurrency to %d", *concurrency)
+	}
+	if after := settingsFingerprint(); after != before {
+		t.Error("settingsFingerprint changed with --workers")
+	}
+}
+
+func TestSettingsFingerprintIgnoresRunOptions(t *testing.T) {
+	savedStrict, savedWatch, savedClean, savedCache, savedWarn, savedLayout := *strict, *watchMode, *cleanStale, *attachmentCachePath, *warnReserved, *layout
+	t.Cleanup(func() {
+		*strict, *watchMode, *cleanStale, *attachmentCachePath, *warnReserved, *layout = savedStrict, savedWatch, savedClean, savedCache, savedWarn, savedLayout
+	})
+
+	before := settingsFingerprint()
+	*strict = !*strict
+	if settingsFingerprint() != before {
+		t.Error("settingsFingerprint changed with --strict")
+	}
+	*watchMode, *cleanStale, *attachmentCachePath, *warnReserved = !*watchMode, !*cleanStale, "cache.json", !*warnReserved
+	if settingsFingerprint() != before {
+		t.Error("settingsFingerprint changed with --watch, --clean, --attachment-cache or --warn-reserved-params")
+	}
+	*layout = "other"
+	if settingsFingerprint() == before {
+		t.Error("settingsFingerprint did not change with --layout")
+	}
+}
+
+func TestSkipsUnchangedNotes(t *testing.T) {
+	savedMode, savedLayout := *attachmentMode, *layout
+	t.Cleanup(func() { *attachmentMode, *layout = savedMode, savedLayout })
+
+	tests := []struct {
+		mode, layout string
+		want         bool
+	}{
+		{"copy", "bundle", true},
+		{"manifest", "bundle", false},
+		{"copy", "flat", false},
+	}
+	for _, tt := range tests {
+		*attachmentMode, *layout = tt.mode, tt.layout
+		if got := skipsUnchangedNotes(); got != tt.want {
+			t.Errorf("skipsUnchangedNotes with --attachment-mode=%s --layout=%s = %t, want %t", tt.mode, tt.layout, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// inlineTagPattern находит теги Obsidian в тексте (#тег, #область/тег). Перед тегом должен
+// быть пробел или начало строки, поэтому якоря в адресах и заголовки сюда не попадают,
+// а тег из одних цифр (#123) тегом не считается.
+var inlineTagPattern = regexp.MustCompile(`(^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+
+// usedTags — теги опубликованных заметок, для которых --generate-tag-pages создает страницы.
+var usedTags = struct {
+	sync.Mutex
+	set map[string]struct{}
+}{set: make(map[string]struct{})}
+
+// resetUsedTags забывает собранные теги перед повторной конвертацией (--watch).
+func resetUsedTags() {
+	usedTags.Lock()
+	defer usedTags.Unlock()
+	usedTags.set = make(map[string]struct{})
+}
+
+// recordTags запоминает теги опубликованной заметки.
+func recordTags(tags []string) {
+	usedTags.Lock()
+	defer usedTags.Unlock()
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			usedTags.set[tag] = struct{}{}
+		}
+	}
+}
+
+// tagTermSlug возвращает имя каталога термина таксономии так же, как его строит Hugo:
+// нижний регистр, пробелы и разделители пути заменяются дефисами.
+func tagTermSlug(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '/' || r == '\\' {
+			return '-'
+		}
+		return r
+	}, strings.ToLower(tag))
+}
+
+// writeTagPages создает в dir страницу _index.md для каждого собранного тега.
+// Уже существующие страницы не перезаписываются.
+func writeTagPages(dir string) error {
+	usedTags.Lock()
+	tags := make([]string, 0, len(usedTags.set))
+	for tag := range usedTags.set {
+		tags = append(tags, tag)
+	}
+	usedTags.Unlock()
+	sort.Strings(tags)
+
+	created := 0
+	for _, tag := range tags {
+		termDir := filepath.Join(dir, tagTermSlug(tag))
+		pagePath := filepath.Join(termDir, "_index.md")
+		if _, err := os.Stat(pagePath); err == nil {
+			logf(DEBUG, "Страница тега '%s' уже существует: %s", tag, pagePath)
+			continue
+		}
+
+		properties := map[string]interface{}{"title": tag}
+		node, err := buildFrontMatterNode(properties, nil)
+		if err != nil {
+			return fmt.Errorf("не удалось сформировать страницу тега '%s': %w", tag, err)
+		}
+		frontMatter, err := formatFrontMatter(node, properties)
+		if err != nil {
+			return fmt.Errorf("не удалось сформировать страницу тега '%s': %w", tag, err)
+		}
+		if err := mkdirAll(termDir); err != nil {
+			return fmt.Errorf("не удалось создать каталог тега %s: %w", termDir, err)
+		}
+		if err := writeFile(pagePath, []byte(frontMatter)); err != nil {
+			return fmt.Errorf("не удалось записать страницу тега %s: %w", pagePath, err)
+		}
+		logf(INFO, "Создана страница тега '%s': %s", tag, pagePath)
+		created++
+	}
+	logf(DEBUG, "Создано страниц тегов: %d", created)
+	return nil
+}
+
+// linkInlineTags заменяет теги #тег в тексте заметки ссылками на страницы тегов Hugo
+// ([#тег](/tags/тег/)). Заголовки, блоки кода, встроенный код, ссылки, шорткоды
+// (подписи figure) и HTML не затрагиваются: Markdown-ссылка там вывелась бы как текст.
+func linkInlineTags(content, baseURL string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/") + "/"
+	link := func(text string) string {
+		return inlineTagPattern.ReplaceAllStringFunc(text, func(match string) string {
+			parts := inlineTagPattern.FindStringSubmatch(match)
+			return fmt.Sprintf("%s[#%s](%s%s/)", parts[1], parts[2], baseURL, tagTermSlug(parts[2]))
+		})
+	}
+	lines := strings.Split(content, "\n")
+	inCode := false
+	for i, line := range lines {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode || headingPattern.MatchString(line) || strings.HasPrefix(strings.TrimSpace(line), "<") {
+			// Строка HTML (<figure>, <details> выносок): Markdown в ней не обрабатывается
+			continue
+		}
+		lines[i] = transformOutsideInlineCode(line, func(text string) string {
+			var sb strings.Builder
+			last := 0
+			for _, loc := range linkedSpanPattern.FindAllStringIndex(text, -1) {
+				sb.WriteString(link(text[last:loc[0]]))
+				sb.WriteString(text[loc[0]:loc[1]])
+				last = loc[1]
+			}
+			sb.WriteString(link(text[last:]))
+			return sb.String()
+		})
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collectInlineTags возвращает теги #тег из текста заметки без повторов, в порядке
+// появления. Блоки кода и встроенный код не просматриваются.
+func collectInlineTags(content string) []string {
+	var tags []string
+	inCode := false
+	for _, line := range strings.Split(content, "\n") {
+		if codeFencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		transformOutsideInlineCode(line, func(text string) string {
+			for _, match := range inlineTagPattern.FindAllStringSubmatch(text, -1) {
+				if tag := strings.TrimSuffix(match[2], "/"); !hasTag(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+			return text
+		})
+	}
+	return tags
+}
+
+// noteTags возвращает теги заметки для отбора: свойство 'tags' и, с --scan-inline-tags,
+// теги из текста заметки content.
+func noteTags(properties map[string]interface{}, content string) []string {
+	tags := extractTags(properties)
+	if *scanInlineTags == "" {
+		return tags
+	}
+	for _, tag := range collectInlineTags(content) {
+		if !hasTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
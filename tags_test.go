@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTagTermSlug(t *testing.T) {
+	tests := []struct {
+		tag, want string
+	}{
+		{"go", "go"},
+		{"Static Sites", "static-sites"},
+		{"Tech/Go", "tech-go"},
+		{"Заметки", "заметки"},
+	}
+	for _, tt := range tests {
+		if got := tagTermSlug(tt.tag); got != tt.want {
+			t.Errorf("tagTermSlug(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTagPages(t *testing.T) {
+	resetUsedTags()
+	t.Cleanup(resetUsedTags)
+	dir := t.TempDir()
+
+	existing := filepath.Join(dir, "go", "_index.md")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("custom"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	recordTags([]string{"go", "Static Sites", " "})
+	if err := writeTagPages(dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "custom" {
+		t.Errorf("existing tag page = %q, want it unchanged", data)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "static-sites", "_index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "title: Static Sites") {
+		t.Errorf("tag page = %q, want the tag as title", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("tag pages = %d, want 2 (blank tags are skipped)", len(entries))
+	}
+}
+
+func TestStripPrefixedTags(t *testing.T) {
+	tests := []struct {
+		tags, prefixes, want []string
+	}{
+		{[]string{"go", "status/done", "Status/Draft"}, []string{"status/"}, []string{"go"}},
+		{[]string{"go", "hugo"}, []string{"x/"}, []string{"go", "hugo"}},
+		{[]string{"a/1", "b/2", "c"}, []string{"a/", "b/"}, []string{"c"}},
+		{nil, []string{"a/"}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := stripPrefixedTags(tt.tags, tt.prefixes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("stripPrefixedTags(%v, %v) = %v, want %v", tt.tags, tt.prefixes, got, tt.want)
+		}
+	}
+}
+
+func TestFindNestedTag(t *testing.T) {
+	tests := []struct {
+		tags []string
+		tag  string
+		want string
+		ok   bool
+	}{
+		{[]string{"go", "blog"}, "blog", "blog", true},
+		{[]string{"blog/golang"}, "blog", "blog/golang", true},
+		{[]string{"blogging"}, "blog", "", false},
+		{nil, "blog", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := findNestedTag(tt.tags, tt.tag); got != tt.want || ok != tt.ok {
+			t.Errorf("findNestedTag(%v, %q) = (%q, %t), want (%q, %t)", tt.tags, tt.tag, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNestedTagsToCategories(t *testing.T) {
+	saved, savedFilter := filterTags, noteFilter
+	t.Cleanup(func() { filterTags, noteFilter = saved, savedFilter })
+	filterTags, noteFilter = tagList{tags: []string{"blog"}}, nil
+
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{
+			"nested tags move",
+			map[string]interface{}{"tags": []interface{}{"blog/golang", "blog/hugo", "go"}},
+			map[string]interface{}{"tags": []string{"go"}, "categories": []string{"golang", "hugo"}},
+		},
+		{
+			"existing categories kept",
+			map[string]interface{}{"tags": []interface{}{"blog/golang"}, "categories": []interface{}{"golang", "notes"}},
+			map[string]interface{}{"categories": []string{"golang", "notes"}},
+		},
+		{
+			"no nested tags",
+			map[string]interface{}{"tags": []interface{}{"blog", "go"}},
+			map[string]interface{}{"tags": []interface{}{"blog", "go"}},
+		},
+	}
+	for _, tt := range tests {
+		nestedTagsToCategories(tt.properties)
+		if !reflect.DeepEqual(tt.properties, tt.want) {
+			t.Errorf("%s: properties = %v, want %v", tt.name, tt.properties, tt.want)
+		}
+	}
+}
+
+func TestCollectInlineTags(t *testing.T) {
+	content := "Text #go and #hugo/theme.\n# Heading\nIssue #123, url.com/#anchor, #go again\n`#code`\n```\n#fenced\n```"
+	if got, want := collectInlineTags(content), []string{"go", "hugo/theme"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("collectInlineTags = %v, want %v", got, want)
+	}
+}
+
+func TestNoteTags(t *testing.T) {
+	saved := *scanInlineTags
+	t.Cleanup(func() { *scanInlineTags = saved })
+	properties := map[string]interface{}{"tags": []interface{}{"blog"}}
+
+	*scanInlineTags = ""
+	if got, want := noteTags(properties, "Text #go"), []string{"blog"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("noteTags without --scan-inline-tags = %v, want %v", got, want)
+	}
+	*scanInlineTags = "filter"
+	if got, want := noteTags(properties, "Text #go #blog"), []string{"blog", "go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("noteTags with --scan-inline-tags = %v, want %v", got, want)
+	}
+}
+
+func TestLinkInlineTags(t *testing.T) {
+	tests := []struct {
+		content, want string
+	}{
+		{"About #go today", "About [#go](/tags/go/) today"},
+		{"#Tech/Go first", "[#Tech/Go](/tags/tech-go/) first"},
+		{"Issue #123 and url.com/#anchor", "Issue #123 and url.com/#anchor"},
+		{"## Heading #go", "## Heading #go"},
+		{"Code `#go` here", "Code `#go` here"},
+		{"```\n#go\n```", "```\n#go\n```"},
+		{"[about #go](https://example.com) #go", "[about #go](https://example.com) [#go](/tags/go/)"},
+		{`{{< figure src="pic.png" caption="Nice #go shot" >}} #go`, `{{< figure src="pic.png" caption="Nice #go shot" >}} [#go](/tags/go/)`},
+		{"<summary>About #go</summary>", "<summary>About #go</summary>"},
+	}
+	for _, tt := range tests {
+		if got := linkInlineTags(tt.content, "/tags"); got != tt.want {
+			t.Errorf("linkInlineTags(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestLinkInlineTagsKeepsImageCaptions(t *testing.T) {
+	notePath, bundleDir := attachmentVault(t, "pic.png")
+	content, _, err := processAttachments("![[pic.png|Nice #go shot]] about #go", bundleDir, "post", notePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := linkInlineTags(content, "/tags")
+	if want := `{{< figure src="post-1.png" alt="Nice #go shot" caption="Nice #go shot" >}} about [#go](/tags/go/)`; got != want {
+		t.Errorf("linkInlineTags after processAttachments = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// maxTransclusionDepth ограничивает вложенность встраиваний заметок друг в друга.
+const maxTransclusionDepth = 10
+
+// expandTransclusions заменяет встраивания других заметок (![[Заметка]],
+// ![[Заметка#Заголовок]], ![[Заметка#^id]]) их текстом: целиком, разделом
+// с заголовком или блоком. Встраивания во встроенном тексте тоже раскрываются.
+// Заметки, публикация которых запрещена --publish-override-key, не встраиваются.
+// Встраивания вложений остаются без изменений.
+func expandTransclusions(content, path string) string {
+	return expandEmbeddedNotes(content, path, []string{path})
+}
+
+// expandEmbeddedNotes раскрывает встраивания заметок в content; stack — цепочка
+// встраивающих заметок для обнаружения циклов, currentPath — путь к заметке со встраиваниями.
+func expandEmbeddedNotes(content, currentPath string, stack []string) string {
+	return transformOutsideCode(content, func(text string) string {
+		var sb strings.Builder
+		last := 0
+		for _, loc := range attachmentPattern.FindAllStringSubmatchIndex(text, -1) {
+			fragment, ok := embeddedNote(text[loc[2]:loc[3]], currentPath, stack)
+			if !ok {
+				continue
+			}
+			before := text[last:loc[0]]
+			if strings.Contains(fragment, "\n") {
+				// Многострочный текст встраивается отдельным блоком, даже если встраивание
+				// стоит посреди строки
+				lineStart := strings.LastIndex(text[:loc[0]], "\n") + 1
+				lineEnd := strings.Index(text[loc[1]:], "\n")
+				if lineEnd < 0 {
+					lineEnd = len(text) - loc[1]
+				}
+				if strings.TrimSpace(text[lineStart:loc[0]]) != "" {
+					before = strings.TrimRight(before, " \t")
+					fragment = "\n\n" + fragment
+				}
+				if strings.TrimSpace(text[loc[1]:loc[1]+lineEnd]) != "" {
+					fragment += "\n\n"
+				}
+			}
+			sb.WriteString(before)
+			sb.WriteString(fragment)
+			last = loc[1]
+		}
+		sb.WriteString(text[last:])
+		return sb.String()
+	})
+}
+
+// embeddedNote возвращает текст для встраивания ![[inner]] в заметку по пути currentPath
+// или false, если встраивается не заметка.
+func embeddedNote(inner, currentPath string, stack []string) (string, bool) {
+	target, heading, alias := parseWikilink(inner)
+	note, ok := vaultNotes[noteKey(target)]
+	if target == "" || !ok {
+		return "", false
+	}
+
+	text := alias
+	if text == "" {
+		text = noteName(note.path)
+	}
+	if note.hidden {
+		reportError(&LinkError{Path: currentPath, Target: inner, Reason: fmt.Sprintf("публикация заметки запрещена свойством '%s', она не встраивается", *publishOverrideKey)})
+		return text, true
+	}
+	for _, embedding := range stack {
+		if embedding == note.path {
+			reportError(&LinkError{Path: currentPath, Target: inner, Reason: "циклическое встраивание заметок"})
+			return text, true
+		}
+	}
+	if len(stack) > maxTransclusionDepth {
+		reportError(&LinkError{Path: currentPath, Target: inner, Reason: "слишком глубокая вложенность встраиваний"})
+		return text, true
+	}
+
+	fragment, err := transclusionFragment(note.path, heading)
+	if err != nil {
+		reportError(&LinkError{Path: currentPath, Target: inner, Reason: err.Error()})
+		return text, true
+	}
+	logf(DEBUG, "Встраиваю заметку '%s' в '%s'", inner, noteName(currentPath))
+	return expandEmbeddedNotes(fragment, note.path, append(stack[:len(stack):len(stack)], note.path)), true
+}
+
+// transclusionFragment возвращает текст заметки path без front matter: целиком,
+// раздел с заголовком heading или блок ^id.
+// Заметка читается в обход ограничителя памяти: встраивающая заметка уже держит
+// свой резерв, и повторное ожидание внутри него при --max-memory никогда не закончится.
+func transclusionFragment(path, heading string) (string, error) {
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	_, content, err := parseNoteContent(string(contentBytes))
+	if err != nil {
+		return "", err
+	}
+	content = removeComments(content)
+
+	fragment, found := strings.TrimSpace(content), true
+	if id, isBlock := strings.CutPrefix(heading, "^"); isBlock {
+		fragment, found = blockText(content, id)
+		if !found {
+			return "", fmt.Errorf("блок '^%s' не найден в заметке '%s'", id, noteName(path))
+		}
+	} else if heading != "" {
+		fragment, found = headingSection(content, heading)
+		if !found {
+			return "", fmt.Errorf("заголовок '%s' не найден в заметке '%s'", heading, noteName(path))
+		}
+	}
+	if *stripBlockIDsFlag || *blockAnchors {
+		fragment = stripBlockIDs(fragment, false)
+	}
+	return fragment, nil
+}
+
+// transcludedNotes возвращает пути к заметкам, встроенным в текст ![[...]].
+func transcludedNotes(content string) []string {
+	var paths []string
+	for _, match := range attachmentPattern.FindAllStringSubmatch(content, -1) {
+		target, _, _ := parseWikilink(match[1])
+		if note, ok := vaultNotes[noteKey(target)]; ok && target != "" {
+			paths = append(paths, note.path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withVaultNotes записывает заметки хранилища (имя → текст) во временный каталог
+// и подменяет vaultNotes на время теста. Возвращает каталог хранилища.
+func withVaultNotes(t *testing.T, notes map[string]string) string {
+	t.Helper()
+	vault := t.TempDir()
+	saved := vaultNotes
+	vaultNotes = make(map[string]*scannedNote)
+	t.Cleanup(func() { vaultNotes = saved })
+	for name, content := range notes {
+		path := filepath.Join(vault, name+".md")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		vaultNotes[noteKey(name)] = &scannedNote{path: path}
+	}
+	return vault
+}
+
+func TestExpandTransclusions(t *testing.T) {
+	vault := withVaultNotes(t, map[string]string{
+		"Source": "---\ntitle: Source\n---\n\nIntro.\n\n## Part\n\nPart text.\n\n### Detail\n\nDetail text.\n\n## Next\n\nNext text.\n\nBlock text. ^block1\n",
+		"Loop":   "Loop embeds ![[Loop]]",
+	})
+	tests := []struct {
+		name, content, want string
+	}{
+		{"whole note", "![[Source]]", "Intro.\n\n## Part\n\nPart text.\n\n### Detail\n\nDetail text.\n\n## Next\n\nNext text.\n\nBlock text. ^block1"},
+		{"section keeps subheadings", "![[Source#Part]]", "## Part\n\nPart text.\n\n### Detail\n\nDetail text."},
+		{"last section", "![[Source#Next]]", "## Next\n\nNext text.\n\nBlock text. ^block1"},
+		{"block", "![[Source#^block1]]", "Block text. ^block1"},
+		{"attachment is kept", "![[image.png]]", "![[image.png]]"},
+		{"mid-line embed", "See ![[Source#^block1]] here", "See Block text. ^block1 here"},
+		{"cycle", "![[Loop]]", "Loop embeds Loop"},
+	}
+	for _, tt := range tests {
+		if got := expandTransclusions(tt.content, filepath.Join(vault, "Host.md")); got != tt.want {
+			t.Errorf("%s: expandTransclusions(%q) = %q, want %q", tt.name, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestTranscludedNotes(t *testing.T) {
+	vault := withVaultNotes(t, map[string]string{"Source": "Text", "Other": "Text"})
+	got := transcludedNotes("![[Source#Part]] ![[image.png]] ![[Missing]] [[Other]]")
+	if want := []string{filepath.Join(vault, "Source.md")}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("transcludedNotes = %v, want %v", got, want)
+	}
+}
+
+func TestExpandTransclusionsStripsBlockIDs(t *testing.T) {
+	vault := withVaultNotes(t, map[string]string{"Source": "Block text. ^block1\n"})
+	saved := *stripBlockIDsFlag
+	*stripBlockIDsFlag = true
+	t.Cleanup(func() { *stripBlockIDsFlag = saved })
+
+	if got := expandTransclusions("![[Source#^block1]]", filepath.Join(vault, "Host.md")); got != "Block text." {
+		t.Errorf("expandTransclusions with --strip-block-ids = %q, want %q", got, "Block text.")
+	}
+}
+
+func TestExpandTransclusionsUnderMemoryLimit(t *testing.T) {
+	large := strings.Repeat("Embedded text.\n", 40000)
+	vault := withVaultNotes(t, map[string]string{"Embedded": large, "Host": large + "\n![[Embedded]]\n"})
+	saved := noteMemory
+	noteMemory = newMemoryLimiter(1)
+	t.Cleanup(func() { noteMemory = saved })
+
+	hostPath := filepath.Join(vault, "Host.md")
+	done := make(chan string, 1)
+	go func() {
+		contentBytes, release, err := readNote(hostPath)
+		if err != nil {
+			t.Error(err)
+			done <- ""
+			return
+		}
+		expanded := expandTransclusions(string(contentBytes), hostPath)
+		release()
+		done <- expanded
+	}()
+
+	select {
+	case got := <-done:
+		if n := strings.Count(got, "Embedded text."); n != 80000 {
+			t.Errorf("expanded text has %d lines of embedded text, want 80000", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expandTransclusions blocked on the memory limiter")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// vaultRoot — корень хранилища Obsidian (каталог с .obsidian), в котором лежит
+// --notes-dir, или пустая строка, если хранилище не найдено.
+var vaultRoot string
+
+// vaultAttachmentFolder — значение настройки Obsidian «Папка для новых вложений»
+// (attachmentFolderPath в .obsidian/app.json): "/" — корень хранилища, "./" — папка
+// заметки, "./имя" — подпапка в папке заметки, иначе — папка относительно корня.
+var vaultAttachmentFolder string
+
+// loadVaultSettings находит хранилище, в котором лежат заметки, и читает из его
+// настроек, где Obsidian хранит вложения.
+func loadVaultSettings() {
+	vaultRoot = findUp(notesRoot(), func(dir string) bool { return isDir(filepath.Join(dir, ".obsidian")) })
+	if vaultRoot == "" {
+		return
+	}
+	vaultAttachmentFolder = readAttachmentFolderSetting(vaultRoot)
+	logf(DEBUG, "Хранилище Obsidian: %s, папка вложений: '%s'", vaultRoot, vaultAttachmentFolder)
+}
+
+// readAttachmentFolderSetting возвращает attachmentFolderPath из .obsidian/app.json.
+// Если настройка не задана, Obsidian хранит вложения в корне хранилища ("/").
+func readAttachmentFolderSetting(root string) string {
+	data, err := os.ReadFile(filepath.Join(root, ".obsidian", "app.json"))
+	if err != nil {
+		return "/"
+	}
+	var settings struct {
+		AttachmentFolderPath *string `json:"attachmentFolderPath"`
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		logf(WARNING, "Не удалось разобрать настройки хранилища %s: %v", filepath.Join(root, ".obsidian", "app.json"), err)
+		return "/"
+	}
+	if settings.AttachmentFolderPath == nil || strings.TrimSpace(*settings.AttachmentFolderPath) == "" {
+		return "/"
+	}
+	return strings.TrimSpace(*settings.AttachmentFolderPath)
+}
+
+// attachmentDirs возвращает каталоги, в которых ищутся вложения заметки из каталога
+// noteDir: каталоги --attachments-dir по порядку, затем каталог из настроек хранилища.
+func attachmentDirs(noteDir string) []string {
+	dirs := append([]string{}, attachmentsDirs...)
+	if vaultRoot == "" {
+		return dirs
+	}
+	folder := filepath.FromSlash(vaultAttachmentFolder)
+	switch {
+	case vaultAttachmentFolder == "/":
+		dirs = append(dirs, vaultRoot)
+	case vaultAttachmentFolder == "." || vaultAttachmentFolder == "./":
+		dirs = append(dirs, noteDir)
+	case strings.HasPrefix(vaultAttachmentFolder, "./"):
+		dirs = append(dirs, filepath.Join(noteDir, folder))
+	default:
+		dirs = append(dirs, filepath.Join(vaultRoot, folder))
+	}
+	// Пути вида ![[Папка/файл.png]] Obsidian отсчитывает от корня хранилища
+	return append(dirs, vaultRoot)
+}
+
+// findAttachment ищет файл вложения filename (как он записан в заметке) для заметки
+// из каталога noteDir и возвращает путь к нему. Если в каталогах вложений файла нет,
+// он ищется по всему хранилищу, как это делает Obsidian.
+func findAttachment(filename, noteDir string) (string, bool) {
+	for _, dir := range attachmentDirs(noteDir) {
+		path := filepath.Join(dir, filename)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return vaultAttachment(filename)
+}
+
+// attachmentSearchDescription описывает, где искались вложения, для сообщений об ошибках.
+func attachmentSearchDescription(noteDir string) string {
+	return strings.Join(uniqueStrings(append(attachmentDirs(noteDir), attachmentSearchRoot())), ", ")
+}
+
+// attachmentIndex — файлы хранилища, кроме заметок, по имени файла в нижнем регистре.
+// Строится один раз при первом поиске вложения, которого нет в каталогах вложений.
+var attachmentIndex struct {
+	sync.Mutex
+	files map[string][]string
+}
+
+// resetAttachmentIndex очищает индекс файлов хранилища перед повторной конвертацией (--watch).
+func resetAttachmentIndex() {
+	attachmentIndex.Lock()
+	defer attachmentIndex.Unlock()
+	attachmentIndex.files = nil
+}
+
+// attachmentSearchRoot возвращает каталог, по которому ищутся вложения: корень
+// хранилища или, если хранилище не найдено, каталог заметок.
+func attachmentSearchRoot() string {
+	if vaultRoot != "" {
+		return vaultRoot
+	}
+	return notesRoot()
+}
+
+// vaultAttachment ищет вложение filename по всему хранилищу. Как и в Obsidian, путь
+// в ссылке может быть неполным (files/image.png подходит к assets/files/image.png),
+// а из нескольких подходящих файлов выбирается ближайший к корню хранилища.
+func vaultAttachment(filename string) (string, bool) {
+	attachmentIndex.Lock()
+	defer attachmentIndex.Unlock()
+	if attachmentIndex.files == nil {
+		attachmentIndex.files = indexVaultFiles(attachmentSearchRoot())
+	}
+
+	suffix := "/" + strings.ToLower(filepath.ToSlash(filename))
+	var matches []string
+	for _, path := range attachmentIndex.files[strings.ToLower(filepath.Base(filename))] {
+		if strings.HasSuffix("/"+strings.ToLower(filepath.ToSlash(path)), suffix) {
+			matches = append(matches, path)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if depthI, depthJ := strings.Count(matches[i], "/"), strings.Count(matches[j], "/"); depthI != depthJ {
+			return depthI < depthJ
+		}
+		return matches[i] < matches[j]
+	})
+	if len(matches) > 1 {
+		logf(DEBUG, "Вложению '%s' подходят файлы %v, использую %s", filename, matches, matches[0])
+	}
+	return filepath.Join(attachmentSearchRoot(), filepath.FromSlash(matches[0])), true
+}
+
+// indexVaultFiles собирает файлы каталога root, кроме заметок, скрытых каталогов
+// (.obsidian, .trash) и каталога постов: пути относительно root по имени файла.
+func indexVaultFiles(root string) map[string][]string {
+	files := make(map[string][]string)
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && (strings.HasPrefix(entry.Name(), ".") || sameDir(path, *hugoPostsDir)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(entry.Name(), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := strings.ToLower(entry.Name())
+		files[key] = append(files[key], filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		logf(WARNING, "Не удалось проиндексировать файлы хранилища %s: %v", root, err)
+	}
+	logf(DEBUG, "Проиндексированы файлы хранилища %s: %d имен", root, len(files))
+	return files
+}
+
+// uniqueStrings возвращает значения без повторов в исходном порядке.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	var unique []string
+	for _, value := range values {
+		if _, ok := seen[value]; !ok {
+			seen[value] = struct{}{}
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadAttachmentFolderSetting(t *testing.T) {
+	tests := []struct {
+		settings, want string
+	}{
+		{`{"attachmentFolderPath": "Files"}`, "Files"},
+		{`{"attachmentFolderPath": "./assets"}`, "./assets"},
+		{`{"attachmentFolderPath": ""}`, "/"},
+		{`{}`, "/"},
+		{`broken`, "/"},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(root, ".obsidian"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, ".obsidian", "app.json"), []byte(tt.settings), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := readAttachmentFolderSetting(root); got != tt.want {
+			t.Errorf("readAttachmentFolderSetting(%s) = %q, want %q", tt.settings, got, tt.want)
+		}
+	}
+	if got := readAttachmentFolderSetting(t.TempDir()); got != "/" {
+		t.Errorf("readAttachmentFolderSetting without app.json = %q, want /", got)
+	}
+}
+
+func TestAttachmentDirs(t *testing.T) {
+	savedRoot, savedFolder, savedDirs := vaultRoot, vaultAttachmentFolder, attachmentsDirs
+	t.Cleanup(func() { vaultRoot, vaultAttachmentFolder, attachmentsDirs = savedRoot, savedFolder, savedDirs })
+	root := filepath.FromSlash("/vault")
+	noteDir := filepath.Join(root, "Notes")
+
+	tests := []struct {
+		attachments  stringSlice
+		root, folder string
+		want         []string
+	}{
+		{stringSlice{"/files"}, "", "", []string{"/files"}},
+		{stringSlice{"/files", "/more"}, "", "", []string{"/files", "/more"}},
+		{nil, root, "/", []string{root, root}},
+		{nil, root, "./", []string{noteDir, root}},
+		{nil, root, "./assets", []string{filepath.Join(noteDir, "assets"), root}},
+		{stringSlice{"/files"}, root, "Attachments", []string{"/files", filepath.Join(root, "Attachments"), root}},
+	}
+	for _, tt := range tests {
+		attachmentsDirs, vaultRoot, vaultAttachmentFolder = tt.attachments, tt.root, tt.folder
+		if got := attachmentDirs(noteDir); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("attachmentDirs with --attachments-dir=%v, folder %q = %v, want %v", tt.attachments, tt.folder, got, tt.want)
+		}
+	}
+}
+
+func TestFindAttachmentInNoteFolder(t *testing.T) {
+	root := t.TempDir()
+	noteDir := filepath.Join(root, "Notes")
+	if err := os.MkdirAll(filepath.Join(noteDir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(noteDir, "assets", "pic.png")
+	if err := os.WriteFile(image, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	savedRoot, savedFolder, savedDirs := vaultRoot, vaultAttachmentFolder, attachmentsDirs
+	t.Cleanup(func() { vaultRoot, vaultAttachmentFolder, attachmentsDirs = savedRoot, savedFolder, savedDirs })
+	vaultRoot, vaultAttachmentFolder, attachmentsDirs = root, "./assets", nil
+
+	if got, ok := findAttachment("pic.png", noteDir); !ok || got != image {
+		t.Errorf("findAttachment(pic.png) = %q, %t, want %q", got, ok, image)
+	}
+	if got, ok := findAttachment("Notes/assets/pic.png", noteDir); !ok || got != image {
+		t.Errorf("findAttachment with a vault path = %q, %t, want %q", got, ok, image)
+	}
+	if _, ok := findAttachment("missing.png", noteDir); ok {
+		t.Error("findAttachment found a missing file")
+	}
+}
+
+func TestVaultAttachment(t *testing.T) {
+	root := t.TempDir()
+	for _, file := range []string{"deep/assets/files/Image.png", "files/image.png", "Note.md", ".trash/old.png", "other/report.pdf"} {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	savedRoot := vaultRoot
+	vaultRoot = root
+	resetAttachmentIndex()
+	t.Cleanup(func() {
+		vaultRoot = savedRoot
+		resetAttachmentIndex()
+	})
+
+	tests := []struct {
+		filename, want string
+	}{
+		{"image.png", "files/image.png"},
+		{"assets/files/image.png", "deep/assets/files/Image.png"},
+		{"report.pdf", "other/report.pdf"},
+		{"Note.md", ""},
+		{"old.png", ""},
+		{"les/image.png", ""},
+	}
+	for _, tt := range tests {
+		got, ok := vaultAttachment(tt.filename)
+		want := ""
+		if tt.want != "" {
+			want = filepath.Join(root, filepath.FromSlash(tt.want))
+		}
+		if got != want || ok != (tt.want != "") {
+			t.Errorf("vaultAttachment(%q) = %q, %t, want %q", tt.filename, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce — сколько ждать после последнего изменения, прежде чем конвертировать.
+// Редакторы и Obsidian сохраняют файл в несколько приемов.
+const watchDebounce = 300 * time.Millisecond
+
+// watchNotes следит за каталогами заметок и вложений и после каждой серии изменений
+// заново конвертирует измененные заметки и те, что на них ссылаются или встраивают
+// измененные вложения. Работает до Ctrl+C.
+func watchNotes() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("не удалось запустить наблюдение за файлами: %w", err)
+	}
+	defer watcher.Close()
+
+	roots := watchRoots()
+	for _, root := range roots {
+		if err := watchTree(watcher, root); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logf(INFO, "Слежу за изменениями в %s. Для выхода нажмите Ctrl+C.", strings.Join(roots, ", "))
+
+	changed := make(map[string]struct{})
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logf(INFO, "Наблюдение остановлено.")
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) && isDir(event.Name) {
+				if err := watchTree(watcher, event.Name); err != nil {
+					logf(WARNING, "%v", err)
+				}
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			changed[event.Name] = struct{}{}
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logf(WARNING, "Ошибка наблюдения за файлами: %v", err)
+		case <-timer.C:
+			if err := convertChanged(changed); err != nil {
+				logf(ERROR, "Не удалось обработать изменения: %v", err)
+			}
+			changed = make(map[string]struct{})
+		}
+	}
+}
+
+// watchRoots возвращает каталоги для наблюдения: каталог заметок, --attachments-dir
+// и хранилище Obsidian, в котором по его настройкам могут лежать вложения.
+func watchRoots() []string {
+	roots := append([]string{notesRoot()}, attachmentsDirs...)
+	if vaultRoot != "" {
+		roots = append(roots, vaultRoot)
+	}
+	return uniqueStrings(roots)
+}
+
+// watchTree добавляет в наблюдение каталог root и все его подкаталоги, кроме
+// скрытых (.obsidian, .git и т.п.) и каталога постов, если он лежит внутри хранилища:
+// fsnotify не следит за подкаталогами сам.
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != root && (strings.HasPrefix(entry.Name(), ".") || sameDir(path, *hugoPostsDir)) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("не удалось следить за каталогом %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// convertChanged заново индексирует заметки и конвертирует затронутые изменениями.
+func convertChanged(changed map[string]struct{}) error {
+	notePaths, err := notePathsToProcess()
+	if err != nil {
+		return err
+	}
+	resetNoteIndex()
+	resetAttachmentIndex()
+	resetAttachmentNames()
+	resetAttachmentManifest()
+	resetUsedTags()
+	resetNoteErrors()
+	buildNoteIndex(notePaths)
+
+	affected := affectedNotes(notePaths, changed)
+	if *attachmentMode == "manifest" || *tagPagesDir != "" {
+		// Манифест вложений и теги собираются заново по всем заметкам, чтобы
+		// в них не осталось вложений и тегов удаленных и измененных заметок
+		affected = notePaths
+	}
+	if len(affected) == 0 && !*cleanStale {
+		logf(DEBUG, "Изменения не затрагивают заметки: %d файлов", len(changed))
+		return nil
+	}
+	logf(INFO, "--- Изменено файлов: %d, заметок для конвертации: %d ---", len(changed), len(affected))
+	return convertNotes(affected)
+}
+
+// affectedNotes возвращает заметки, которые нужно сконвертировать после изменения
+// файлов changed: измененные заметки, опубликованные заметки со ссылками на них
+// (в ссылках могли измениться каталог поста и заголовки) и заметки, которые
+// ссылаются на измененные вложения.
+func affectedNotes(notePaths []string, changed map[string]struct{}) []string {
+	changedKeys := make(map[string]struct{})
+	var changedAttachments []string
+	for path := range changed {
+		if strings.HasSuffix(path, ".md") {
+			changedKeys[noteKey(noteName(path))] = struct{}{}
+		} else {
+			changedAttachments = append(changedAttachments, filepath.Base(path))
+		}
+	}
+
+	published := make(map[string]struct{}, len(noteIndex))
+	for _, note := range noteIndex {
+		published[note.path] = struct{}{}
+	}
+
+	var affected []string
+	for _, path := range notePaths {
+		if _, ok := changed[path]; ok {
+			affected = append(affected, path)
+			continue
+		}
+		if _, ok := published[path]; !ok {
+			continue
+		}
+		contentBytes, release, err := readNote(path)
+		if err != nil {
+			continue
+		}
+		content := string(contentBytes)
+		release()
+		if linksToAny(content, changedKeys) || embedsAny(content, changed) || containsAny(content, changedAttachments) {
+			affected = append(affected, path)
+		}
+	}
+	return affected
+}
+
+// linksToAny проверяет, ведут ли вики-ссылки текста на одну из заметок keys
+// (по имени или псевдониму).
+func linksToAny(content string, keys map[string]struct{}) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	for _, key := range linkedNotes(content) {
+		if _, ok := keys[key]; ok {
+			return true
+		}
+		if _, ok := keys[aliasIndex[key]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// embedsAny проверяет, встроена ли в текст одна из заметок paths.
+func embedsAny(content string, paths map[string]struct{}) bool {
+	for _, path := range transcludedNotes(content) {
+		if _, ok := paths[path]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny проверяет, встречается ли в тексте одна из подстрок.
+func containsAny(content string, substrings []string) bool {
+	for _, s := range substrings {
+		if strings.Contains(content, s) {
+			return true
+		}
+	}
+	return false
+}
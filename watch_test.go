@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAffectedNotes(t *testing.T) {
+	notePath, _ := attachmentVault(t, "pic.png")
+	vault := filepath.Dir(notePath)
+	notes := map[string]string{
+		"A.md": "See [[B|the other note]].\n",
+		"B.md": "Text\n",
+		"C.md": "![[pic.png]]\n",
+		"D.md": "Unrelated\n",
+	}
+	var notePaths []string
+	for _, name := range []string{"A.md", "B.md", "C.md", "D.md"} {
+		path := filepath.Join(vault, name)
+		if err := os.WriteFile(path, []byte(notes[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		notePaths = append(notePaths, path)
+	}
+
+	savedIndex := noteIndex
+	t.Cleanup(func() { noteIndex = savedIndex })
+	noteIndex = make(map[string]*publishedNote)
+	for _, path := range notePaths {
+		noteIndex[noteKey(noteName(path))] = &publishedNote{path: path, bundle: noteName(path)}
+	}
+
+	tests := []struct {
+		changed string
+		want    []string
+	}{
+		{"B.md", []string{"A.md", "B.md"}},
+		{"pic.png", []string{"C.md"}},
+		{"D.md", []string{"D.md"}},
+	}
+	for _, tt := range tests {
+		got := affectedNotes(notePaths, map[string]struct{}{filepath.Join(vault, tt.changed): {}})
+		var want []string
+		for _, name := range tt.want {
+			want = append(want, filepath.Join(vault, name))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("affectedNotes after changing %s = %v, want %v", tt.changed, got, want)
+		}
+	}
+}
+
+// После пересборки манифест вложений не должен содержать вложения удаленных заметок.
+func TestConvertChangedResetsManifest(t *testing.T) {
+	notePath, _ := attachmentVault(t, "a.png", "b.png")
+	vault := filepath.Dir(notePath)
+	for name, content := range map[string]string{"A.md": "![[a.png]]\n", "B.md": "![[b.png]]\n"} {
+		if err := os.WriteFile(filepath.Join(vault, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	savedNotes, savedPosts, savedNoFilter, savedMode, savedManifest := *notesDir, *hugoPostsDir, *noFilter, *attachmentMode, *manifestPath
+	*notesDir, *hugoPostsDir, *noFilter = vault, t.TempDir(), true
+	*attachmentMode, *manifestPath = "manifest", filepath.Join(t.TempDir(), "attachments.manifest")
+	t.Cleanup(func() {
+		*notesDir, *hugoPostsDir, *noFilter, *attachmentMode, *manifestPath = savedNotes, savedPosts, savedNoFilter, savedMode, savedManifest
+		resetNoteIndex()
+		resetAttachmentManifest()
+	})
+
+	if err := convertChanged(map[string]struct{}{filepath.Join(vault, "A.md"): {}, filepath.Join(vault, "B.md"): {}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(vault, "B.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := convertChanged(map[string]struct{}{filepath.Join(vault, "B.md"): {}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(*manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := string(data)
+	if !strings.Contains(manifest, "a.png") || strings.Contains(manifest, "b.png") {
+		t.Errorf("manifest = %q, want only the attachment of the remaining note", manifest)
+	}
+}